@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// projectURL 项目源码地址
+const projectURL = "https://github.com/Yohann0617/tg-disk"
+
+var (
+	// version 构建时通过 -ldflags "-X main.version=v1.2.3" 注入，未注入时使用 VCS 信息
+	version   = ""
+	startTime = time.Now()
+	// tempMaxAge /gc 命令清理临时目录时使用的过期时间
+	tempMaxAge = 24 * time.Hour
+)
+
+// parseUserIDs 解析环境变量 key 中逗号分隔的 Telegram 用户 ID
+func parseUserIDs(key string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s 格式错误: %s", key, part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// isAdmin CHAT_ID 对应的用户、配对用户和该 profile 的 admin_user_ids 可以使用管理命令
+func (p *profile) isAdmin(userID int64) bool {
+	if userID == p.ChatID || (p.pairedUserID != 0 && userID == p.pairedUserID) {
+		return true
+	}
+	return slices.Contains(p.AdminUserIDs, userID)
+}
+
+// handleAdminCommand 处理私聊中的管理命令，不是管理命令时返回 false。
+// Telegram 的命令菜单不支持短横线，因此同时接受 /pause_uploads 这类写法
+func (p *profile) handleAdminCommand(msg *tgbotapi.Message) bool {
+	args := strings.Fields(msg.Text)
+	if len(args) == 0 {
+		return false
+	}
+	cmd := strings.ReplaceAll(strings.TrimPrefix(args[0], "/"), "_", "-")
+	// 群组中的命令可能带 @机器人用户名 后缀
+	cmd, _, _ = strings.Cut(cmd, "@")
+
+	var reply string
+	switch cmd {
+	case "pause-uploads":
+		p.uploadsPaused.Store(true)
+		reply = "已暂停上传，/resume-uploads 恢复"
+	case "resume-uploads":
+		p.uploadsPaused.Store(false)
+		reply = "已恢复上传"
+	case "set-quota":
+		if len(args) < 2 {
+			reply = "用法：/set-quota 10GB（0 表示不限制）"
+			break
+		}
+		limit, err := parseSize(args[1])
+		if err != nil {
+			reply = err.Error()
+			break
+		}
+		p.quota.setLimit(limit)
+		if limit == 0 {
+			reply = "已取消每日上传额度限制"
+		} else {
+			reply = "每日上传额度已设置为 " + formatSize(limit)
+		}
+	case "gc":
+		removed, reclaimed := sweepTempDirs(tempMaxAge)
+		reply = fmt.Sprintf("已清理 %d 个过期临时目录，回收空间 %s", removed, formatSize(reclaimed))
+	case "status":
+		reply = p.statusText()
+	case "setbase", "set-base":
+		if len(args) < 2 {
+			reply = "用法：/setbase https://你的域名（off 清除）"
+			if base := p.linkBase(); base != "" {
+				reply += "\n当前链接地址：" + base + "（" + p.linkBaseSource() + "）"
+			}
+			break
+		}
+		reply = p.setRuntimeBase(args[1])
+	case "purge":
+		if st := maintenanceStatus(); st.Enabled {
+			reply = "维护模式中，暂不能删除：" + st.Message
+			break
+		}
+		reply = p.purgeCommand(args[1:])
+	case "maintenance":
+		reply = maintenanceCommand(args[1:])
+	case "upload-link":
+		if st := maintenanceStatus(); st.Enabled {
+			reply = "维护模式中，暂不能生成上传链接：" + st.Message
+			break
+		}
+		reply = p.uploadLinkCommand(args[1:])
+	default:
+		return false
+	}
+	_, _ = p.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, reply))
+	return true
+}
+
+// statusText /status 命令回复的运行状态
+func (p *profile) statusText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "版本：%s\n", buildVersion())
+	fmt.Fprintf(&b, "运行时间：%s\n", time.Since(startTime).Round(time.Second))
+	if st := maintenanceStatus(); st.Enabled {
+		b.WriteString("维护模式：开启，只能下载\n")
+	} else if p.uploadsPaused.Load() {
+		b.WriteString("上传：已暂停\n")
+	} else {
+		b.WriteString("上传：正常\n")
+	}
+	if p.srv.uploads.max > 0 {
+		active, queued := p.srv.uploads.status()
+		fmt.Fprintf(&b, "进行中的上传：%d / %d，排队：%d\n", active, p.srv.uploads.max, queued)
+	}
+	used, limit := p.quota.usage()
+	if limit > 0 {
+		fmt.Fprintf(&b, "今日已上传：%s / %s\n", formatSize(used), formatSize(limit))
+	} else {
+		fmt.Fprintf(&b, "今日已上传：%s（不限额度）\n", formatSize(used))
+	}
+	fmt.Fprintf(&b, "分块缓存：%d / %d\n", p.srv.cache.Len(), p.srv.cache.Cap())
+	if used, limit := p.srv.buffers.usage(); limit > 0 {
+		fmt.Fprintf(&b, "传输缓冲：%s / %s，已拒绝 %d 次\n", formatSize(used), formatSize(limit), p.srv.buffers.rejected.Load())
+	}
+	b.WriteString(tuner.statusText())
+	fmt.Fprintf(&b, "临时目录清理：%d 次，共删除 %d 个目录，回收 %s\n",
+		tempGCStats.Runs.Load(), tempGCStats.RemovedDirs.Load(), formatSize(tempGCStats.ReclaimedBytes.Load()))
+	if p.srv.moderation != nil {
+		fmt.Fprintf(&b, "待审核文件：%d\n", len(p.srv.moderation.pending(p.Name)))
+	}
+	if base := p.linkBase(); base != "" {
+		fmt.Fprintf(&b, "链接地址：%s（%s）\n", base, p.linkBaseSource())
+	} else {
+		b.WriteString("链接地址：未设置\n")
+	}
+	fmt.Fprintf(&b, "源码地址：%s", projectURL)
+	return b.String()
+}
+
+// buildVersion 版本号，没有注入时返回提交哈希，都没有时为 dev
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 7 {
+				return s.Value[:7]
+			}
+		}
+	}
+	return "dev"
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentErrorLimit /api/admin/status 保留的最近错误数
+const recentErrorLimit = 20
+
+// RecentError 最近发生的 5xx 响应或告警
+type RecentError struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"` // 请求路径或告警事件
+	Message string    `json:"message"`
+}
+
+var recentErrors = struct {
+	sync.Mutex
+	items []RecentError
+}{}
+
+// recordError 记录最近的错误，超过 recentErrorLimit 时丢弃最早的
+func recordError(source, message string) {
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+	recentErrors.items = append(recentErrors.items, RecentError{Time: time.Now(), Source: source, Message: message})
+	if n := len(recentErrors.items); n > recentErrorLimit {
+		recentErrors.items = append([]RecentError(nil), recentErrors.items[n-recentErrorLimit:]...)
+	}
+}
+
+// latestErrors 最近的错误，最新的在前
+func latestErrors() []RecentError {
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+	list := make([]RecentError, len(recentErrors.items))
+	for i, e := range recentErrors.items {
+		list[len(list)-1-i] = e
+	}
+	return list
+}
+
+// AdminStatus GET /api/admin/status 的响应，tg-disk top 据此渲染
+type AdminStatus struct {
+	Version       string              `json:"version"`
+	UptimeSeconds int64               `json:"uptime_seconds"`
+	Uploads       UploadGateStatus    `json:"uploads"`
+	Transfers     []TransferInfo      `json:"transfers"`
+	Buffers       BufferStatus        `json:"buffers"`
+	Telegram      TelegramLimitStatus `json:"telegram"`
+	Breaker       BreakerStatus       `json:"breaker"`
+	Maintenance   MaintenanceStatus   `json:"maintenance"`
+	Profiles      []ProfileStatus     `json:"profiles"`
+	Errors        []RecentError       `json:"errors"`
+}
+
+type UploadGateStatus struct {
+	Active int `json:"active"`
+	Max    int `json:"max"` // 为 0 时不限制
+	Queued int `json:"queued"`
+}
+
+type BufferStatus struct {
+	Used     int64 `json:"used"`
+	Limit    int64 `json:"limit"`
+	Rejected int64 `json:"rejected"`
+}
+
+type ProfileStatus struct {
+	Name          string `json:"name"`
+	Ready         bool   `json:"ready"`
+	UploadsPaused bool   `json:"uploads_paused"`
+	QuotaUsed     int64  `json:"quota_used"`
+	QuotaLimit    int64  `json:"quota_limit"`
+}
+
+// handleAdminStatus GET /api/admin/status，需要管理员令牌
+func (s *server) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	st := AdminStatus{
+		Version:       buildVersion(),
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+		Transfers:     activeTransfers(),
+		Telegram:      telegramLimitStatus(),
+		Breaker:       s.breaker.status(),
+		Maintenance:   maintenanceStatus(),
+		Errors:        latestErrors(),
+	}
+	st.Uploads.Active, st.Uploads.Queued = s.uploads.status()
+	st.Uploads.Max = s.uploads.max
+	st.Buffers.Used, st.Buffers.Limit = s.buffers.usage()
+	st.Buffers.Rejected = s.buffers.rejected.Load()
+	for _, p := range s.profiles {
+		used, limit := p.quota.usage()
+		st.Profiles = append(st.Profiles, ProfileStatus{
+			Name:          p.Name,
+			Ready:         p.isReady(),
+			UploadsPaused: p.uploadsPaused.Load(),
+			QuotaUsed:     used,
+			QuotaLimit:    limit,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
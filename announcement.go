@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// announcement 网页顶部显示的公告，StartsAt、EndsAt 为空表示不限制
+type announcement struct {
+	Message   string     `json:"message"`
+	Level     string     `json:"level"` // info 或 warning
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// activeAt 公告在 t 时刻是否处于显示时段内
+func (a *announcement) activeAt(t time.Time) bool {
+	if a.StartsAt != nil && t.Before(*a.StartsAt) {
+		return false
+	}
+	return a.EndsAt == nil || t.Before(*a.EndsAt)
+}
+
+// announcementStore 公告保存在 JSON 文件中，同一时间只有一条
+type announcementStore struct {
+	mu   sync.Mutex
+	path string
+	cur  *announcement
+}
+
+func loadAnnouncements(path string) (*announcementStore, error) {
+	s := &announcementStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取公告失败: %v", err)
+	}
+	var a announcement
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("解析公告失败: %v", err)
+	}
+	if a.Message != "" {
+		s.cur = &a
+	}
+	return s, nil
+}
+
+func (s *announcementStore) get() *announcement {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+// set 保存公告，a 为 nil 时清除
+func (s *announcementStore) set(a *announcement) error {
+	if s == nil {
+		return errors.New("未开启公告")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a == nil {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if err := writeJSONFile(s.path, a); err != nil {
+		return err
+	}
+	s.cur = a
+	return nil
+}
+
+// handleAnnouncement GET /api/announcement 返回当前显示时段内的公告，没有时 announcement 为 null；
+// 登录后返回已保存的公告及 active 字段，便于查看尚未开始的公告。
+// PUT 设置公告（需要访问密码），DELETE 清除公告
+func (p *profile) handleAnnouncement(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a := p.srv.announcements.get()
+		active := a != nil && a.activeAt(time.Now())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if p.isAuthenticated(r) {
+			json.NewEncoder(w).Encode(map[string]any{"announcement": a, "active": active})
+			return
+		}
+		if !active {
+			a = nil
+		}
+		json.NewEncoder(w).Encode(map[string]any{"announcement": a})
+	case http.MethodPut, http.MethodDelete:
+		if !p.isAuthenticated(r) {
+			writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+			return
+		}
+		var a *announcement
+		if r.Method == http.MethodPut {
+			a = &announcement{}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(a); err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体不是有效的 JSON: "+err.Error(), nil)
+				return
+			}
+			if msg := validateAnnouncement(a); msg != "" {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, msg, nil)
+				return
+			}
+			a.UpdatedAt = time.Now()
+		}
+		if err := p.srv.announcements.set(a); err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, "保存公告失败: "+err.Error(), nil)
+			return
+		}
+		if a == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]any{"announcement": a, "active": a.activeAt(time.Now())})
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET、PUT、DELETE", nil)
+	}
+}
+
+// validateAnnouncement 检查并规范化公告内容，返回错误提示，合法时返回空字符串
+func validateAnnouncement(a *announcement) string {
+	a.Message = strings.TrimSpace(a.Message)
+	switch {
+	case a.Message == "":
+		return "message 不能为空"
+	case len([]rune(a.Message)) > 1000:
+		return "message 不能超过 1000 个字符"
+	case a.StartsAt != nil && a.EndsAt != nil && !a.EndsAt.After(*a.StartsAt):
+		return "ends_at 必须晚于 starts_at"
+	}
+	switch a.Level {
+	case "":
+		a.Level = "info"
+	case "info", "warning":
+	default:
+		return "level 只能为 info 或 warning"
+	}
+	return ""
+}
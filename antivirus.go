@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// virusScanner 上传内容在发送到 Telegram 之前的病毒扫描钩子
+type virusScanner interface {
+	// Scan 返回检测到的病毒特征名，未检测到时返回空字符串
+	Scan(r io.Reader) (string, error)
+}
+
+// newVirusScanner 根据配置创建扫描器，clamdAddr 优先于 command，都为空时返回 nil
+func newVirusScanner(clamdAddr, command string) (virusScanner, error) {
+	switch {
+	case clamdAddr != "":
+		network, addr := "tcp", clamdAddr
+		if strings.HasPrefix(clamdAddr, "unix://") {
+			network, addr = "unix", strings.TrimPrefix(clamdAddr, "unix://")
+		} else {
+			addr = strings.TrimPrefix(addr, "tcp://")
+		}
+		return &clamdScanner{network: network, addr: addr}, nil
+	case command != "":
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return nil, errors.New("AV_COMMAND 为空")
+		}
+		return &commandScanner{args: args}, nil
+	}
+	return nil, nil
+}
+
+// clamdScanner 通过 clamd 的 INSTREAM 命令扫描
+type clamdScanner struct {
+	network string
+	addr    string
+}
+
+func (c *clamdScanner) Scan(r io.Reader) (string, error) {
+	conn, err := net.DialTimeout(c.network, c.addr, 10*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("连接 clamd 失败: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("发送 clamd 命令失败: %v", err)
+	}
+	buf := make([]byte, 64*1024)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := conn.Write(size); werr != nil {
+				return "", fmt.Errorf("发送数据到 clamd 失败: %v", werr)
+			}
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				return "", fmt.Errorf("发送数据到 clamd 失败: %v", werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("读取上传内容失败: %v", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", fmt.Errorf("发送数据到 clamd 失败: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("读取 clamd 响应失败: %v", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+
+	// 响应形如 "stream: OK" 或 "stream: Eicar-Signature FOUND"
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		sig := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return sig, nil
+	}
+	return "", fmt.Errorf("clamd 返回异常: %s", reply)
+}
+
+// commandScanner 将上传内容通过标准输入交给外部命令（如 clamdscan -），
+// 与 clamscan 约定一致：退出码 0 表示正常，1 表示检测到病毒，其他为扫描出错
+type commandScanner struct {
+	args []string
+}
+
+func (c *commandScanner) Scan(r io.Reader) (string, error) {
+	cmd := exec.Command(c.args[0], c.args[1:]...)
+	cmd.Stdin = r
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err == nil {
+		return "", nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		sig := strings.TrimSpace(out.String())
+		if sig == "" {
+			sig = "unknown"
+		}
+		return sig, nil
+	}
+	return "", fmt.Errorf("执行扫描命令失败: %v %s", err, strings.TrimSpace(out.String()))
+}
+
+// scanFiles 按顺序拼接多个临时文件（分块）后整体扫描，分块经过压缩时先解码
+func scanFiles(scanner virusScanner, codec string, paths ...string) (string, error) {
+	var readers []io.Reader
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("打开临时文件失败: %v", err)
+		}
+		defer f.Close()
+		dr, err := decodeReader(f, codec)
+		if err != nil {
+			return "", fmt.Errorf("解码临时文件失败: %v", err)
+		}
+		readers = append(readers, dr)
+	}
+	return scanner.Scan(io.MultiReader(readers...))
+}
+
+// scanRejected 配置了病毒扫描时扫描上传内容，检测到病毒或扫描出错时写入错误响应并返回 true
+func (p *profile) scanRejected(w http.ResponseWriter, r *http.Request, filename, codec string, paths ...string) bool {
+	if p.srv.scanner == nil {
+		return false
+	}
+	sig, err := scanFiles(p.srv.scanner, codec, paths...)
+	if err != nil {
+		log.Printf("病毒扫描失败: %s，%v", filename, err)
+		http.Error(w, "病毒扫描失败: "+err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	if sig != "" {
+		log.Printf("检测到病毒，已拒绝上传: %s，来源 %s，特征 %s", filename, clientIP(r), sig)
+		http.Error(w, "文件未通过病毒扫描: "+sig, http.StatusUnprocessableEntity)
+		return true
+	}
+	return false
+}
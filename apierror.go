@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// 错误码，客户端应根据 code 而不是 message 判断错误类型
+const (
+	errCodeUnauthorized     = "unauthorized"
+	errCodeForbidden        = "forbidden"
+	errCodeNotFound         = "not_found"
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeTooManyRequests  = "too_many_requests"
+	errCodeBadManifest      = "bad_manifest"
+	errCodeTelegram         = "telegram_error"
+	errCodeUnavailable      = "telegram_unavailable"
+	errCodeInternal         = "internal_error"
+	errCodeGone             = "file_gone"
+	errCodeBadRequest       = "bad_request"
+	errCodeTooLarge         = "too_large"
+	errCodeMaintenance      = "maintenance"
+)
+
+// apiError /api 路由统一的 JSON 错误结构
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// requestID 优先使用请求头中的 X-Request-Id，否则随机生成
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// writeAPIError 输出 {"error": {...}} 形式的错误响应
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string, details any) {
+	// 维护模式下拒绝的写请求是预期行为，不计入最近的错误
+	if status >= http.StatusInternalServerError && code != errCodeMaintenance {
+		recordError(r.URL.Path, message)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]apiError{"error": {
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(r),
+	}})
+}
+
+// writeError /api 路由返回 JSON 错误，其余路由保持纯文本错误，供公共中间件使用
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, r, status, code, message, nil)
+		return
+	}
+	if status >= http.StatusInternalServerError && code != errCodeMaintenance {
+		recordError(r.URL.Path, message)
+	}
+	http.Error(w, message, status)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	// blockedArchiveExts 压缩包内禁止出现的扩展名（小写、不带点），为空时不检查压缩包
+	blockedArchiveExts map[string]bool
+	// archivePolicy 发现禁止的文件时的处理方式：reject 拒绝上传，log 只记录日志
+	archivePolicy = "reject"
+)
+
+// parseBlockedExts 解析逗号分隔的扩展名列表，如 exe,scr,.bat
+func parseBlockedExts(s string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(s, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			exts[ext] = true
+		}
+	}
+	if len(exts) == 0 {
+		return nil
+	}
+	return exts
+}
+
+// archiveRejected 检查 zip/tar 压缩包的文件列表，包含禁止的扩展名且策略为 reject 时写入错误响应并返回 true。
+// 无法解析的压缩包（损坏或加密目录）同样拒绝，避免借此绕过检查
+func archiveRejected(w http.ResponseWriter, r *http.Request, filename, codec string, paths ...string) bool {
+	if blockedArchiveExts == nil {
+		return false
+	}
+	names, err := archiveEntries(filename, codec, paths)
+	if err != nil {
+		log.Printf("解析压缩包失败: %s，%v", filename, err)
+		if archivePolicy == "reject" {
+			http.Error(w, "无法解析压缩包: "+err.Error(), http.StatusUnprocessableEntity)
+			return true
+		}
+		return false
+	}
+	var blocked []string
+	for _, name := range names {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+		if blockedArchiveExts[ext] {
+			blocked = append(blocked, name)
+		}
+	}
+	if len(blocked) == 0 {
+		return false
+	}
+	log.Printf("压缩包包含禁止的文件类型: %s，来源 %s，%s", filename, clientIP(r), strings.Join(blocked, ", "))
+	if archivePolicy != "reject" {
+		return false
+	}
+	http.Error(w, "压缩包中包含禁止的文件类型: "+strings.Join(blocked, ", "), http.StatusUnprocessableEntity)
+	return true
+}
+
+// archiveEntries 按文件名判断压缩包类型并列出其中的文件，不是压缩包时返回空列表
+func archiveEntries(filename, codec string, paths []string) ([]string, error) {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"), strings.HasSuffix(lower, ".jar"):
+		// zip 的目录位于文件末尾，需要随机读取；zip 本身已压缩，上传时不会再 gzip 分块
+		if codec != "" {
+			return nil, fmt.Errorf("不支持检查经过 %s 编码的 zip", codec)
+		}
+		ra, err := openMultiFile(paths)
+		if err != nil {
+			return nil, err
+		}
+		defer ra.Close()
+		zr, err := zip.NewReader(ra, ra.size)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(zr.File))
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return names, nil
+	case strings.HasSuffix(lower, ".tar"), strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		var readers []io.Reader
+		for _, p := range paths {
+			f, err := os.Open(p)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			dr, err := decodeReader(f, codec)
+			if err != nil {
+				return nil, err
+			}
+			readers = append(readers, dr)
+		}
+		var src io.Reader = io.MultiReader(readers...)
+		if !strings.HasSuffix(lower, ".tar") {
+			gz, err := gzip.NewReader(src)
+			if err != nil {
+				return nil, err
+			}
+			src = gz
+		}
+		var names []string
+		tr := tar.NewReader(src)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return names, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, hdr.Name)
+		}
+	}
+	return nil, nil
+}
+
+// multiFile 把按顺序排列的分块文件当作一个整体随机读取
+type multiFile struct {
+	files []*os.File
+	sizes []int64
+	size  int64
+}
+
+func openMultiFile(paths []string) (*multiFile, error) {
+	m := &multiFile{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			m.Close()
+			return nil, err
+		}
+		m.files = append(m.files, f)
+		m.sizes = append(m.sizes, info.Size())
+		m.size += info.Size()
+	}
+	return m, nil
+}
+
+func (m *multiFile) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+	for i, f := range m.files {
+		if off >= m.sizes[i] {
+			off -= m.sizes[i]
+			continue
+		}
+		k, err := f.ReadAt(b[n:], off)
+		n += k
+		if n == len(b) {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		off = 0
+	}
+	return n, io.EOF
+}
+
+func (m *multiFile) Close() error {
+	for _, f := range m.files {
+		f.Close()
+	}
+	return nil
+}
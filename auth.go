@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authCookieName 登录成功后下发的 Cookie，私有模式下浏览器直接打开下载链接时用于鉴权
+const authCookieName = "tgdisk_auth"
+
+// authCookieValue 由访问密码派生的 Cookie 值，Cookie 中不保存明文密码
+func (p *profile) authCookieValue() string {
+	return fileToken(p.AccessPwd, "tg-disk-auth")
+}
+
+// isAuthenticated 请求是否携带了访问密码（pwd 参数或 X-Access-Pwd 请求头）或登录 Cookie
+func (p *profile) isAuthenticated(r *http.Request) bool {
+	pwd := r.Header.Get("X-Access-Pwd")
+	if pwd == "" {
+		pwd = r.URL.Query().Get("pwd")
+	}
+	if pwd != "" && subtle.ConstantTimeCompare([]byte(pwd), []byte(p.AccessPwd)) == 1 {
+		return true
+	}
+	if c, err := r.Cookie(authCookieName); err == nil {
+		return subtle.ConstantTimeCompare([]byte(c.Value), []byte(p.authCookieValue())) == 1
+	}
+	return false
+}
+
+// setAuthCookie 密码校验通过后下发登录 Cookie
+func (p *profile) setAuthCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    p.authCookieValue(),
+		Path:     p.PathPrefix + "/",
+		HttpOnly: true,
+		Secure:   getScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// authorizeDownload 校验下载权限：先校验下载令牌与审核状态，私有模式（或单个文件设置为 private）下还需要已登录，
+// 带 exp 的限时分享链接可以免登录访问单个文件。校验失败时写入错误响应并返回 false
+func (p *profile) authorizeDownload(w http.ResponseWriter, r *http.Request, fileID string) bool {
+	q := r.URL.Query()
+	if !p.checkFileToken(fileID, q) {
+		writeError(w, r, http.StatusForbidden, errCodeForbidden, "缺少或无效的下载令牌")
+		return false
+	}
+	// 匿名上传的文件审核通过前只有管理员（已登录）可以下载
+	switch p.srv.moderation.status(fileID) {
+	case moderationPending:
+		if !p.isAuthenticated(r) {
+			writeError(w, r, http.StatusForbidden, errCodeForbidden, "文件正在等待审核")
+			return false
+		}
+	case moderationRejected:
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "文件未通过审核")
+		return false
+	}
+	if p.srv.reports.isBlocked(fileID) {
+		writeError(w, r, http.StatusUnavailableForLegalReasons, errCodeForbidden, "文件因举报已下架")
+		return false
+	}
+	if p.downloadAuthRequired(fileID) && !p.isAuthenticated(r) && !(p.DownloadTokenSecret != "" && q.Get("exp") != "") {
+		// 浏览器直接打开链接时显示密码页，输入后继续下载
+		if wantsHTML(r) && !strings.HasPrefix(r.URL.Path, "/api/") {
+			p.writePasswordPage(w, r.RequestURI, "")
+			return false
+		}
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "下载需要登录")
+		return false
+	}
+	return true
+}
+
+// withBasicAuth 为所有路由（包括静态页面）加上 HTTP Basic 认证，与应用内的访问密码相互独立，
+// 用于直接暴露在公网时避免被爬虫发现。/readyz 不做校验，方便健康检查
+func withBasicAuth(user, pass string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			u, p, ok := r.BasicAuth()
+			// 两项都比较，避免根据耗时区分用户名是否正确
+			userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(p), []byte(pass)) == 1
+			if !ok || !userOK || !passOK {
+				w.Header().Set("WWW-Authenticate", `Basic realm="tg-disk", charset="UTF-8"`)
+				http.Error(w, "需要认证", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
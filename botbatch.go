@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// batchDelay 最后一个文件到达后等待多久再汇总回复，一次转发多个文件时 Telegram 会在很短时间内逐条推送
+const batchDelay = 2 * time.Second
+
+type batchItem struct {
+	fileID   string
+	fileName string
+}
+
+// linkBatcher 收集同一会话中短时间内收到的多个文件，合并为一条带全部下载链接的回复
+type linkBatcher struct {
+	mu      sync.Mutex
+	pending map[int64][]batchItem
+	timers  map[int64]*time.Timer
+	flush   func(chatID int64, items []batchItem)
+}
+
+func newLinkBatcher(flush func(chatID int64, items []batchItem)) *linkBatcher {
+	return &linkBatcher{
+		pending: make(map[int64][]batchItem),
+		timers:  make(map[int64]*time.Timer),
+		flush:   flush,
+	}
+}
+
+func (b *linkBatcher) add(chatID int64, item batchItem) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[chatID] = append(b.pending[chatID], item)
+	if t, ok := b.timers[chatID]; ok {
+		t.Reset(batchDelay)
+		return
+	}
+	b.timers[chatID] = time.AfterFunc(batchDelay, func() {
+		b.mu.Lock()
+		items := b.pending[chatID]
+		delete(b.pending, chatID)
+		delete(b.timers, chatID)
+		b.mu.Unlock()
+		if len(items) > 0 {
+			b.flush(chatID, items)
+		}
+	})
+}
+
+// sendLinkSummary 回复汇总消息，超过 Telegram 单条消息长度限制时拆分为多条
+func (p *profile) sendLinkSummary(chatID int64, items []batchItem) {
+	const maxMessageLen = 4000
+
+	var msgs []string
+	var b strings.Builder
+	fmt.Fprintf(&b, "已收到 %d 个文件：\n", len(items))
+	for i, item := range items {
+		entry := fmt.Sprintf("\n%d. %s\n%s\n", i+1, item.fileName, p.downloadURL(p.linkBase(), item.fileID, item.fileName))
+		if b.Len()+len(entry) > maxMessageLen {
+			msgs = append(msgs, b.String())
+			b.Reset()
+		}
+		b.WriteString(entry)
+	}
+	msgs = append(msgs, b.String())
+
+	for _, text := range msgs {
+		if _, err := p.bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+			log.Println("发送文件链接汇总失败:", err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errTelegramUnreachable 熔断期间不再请求 Telegram，直接返回该错误
+var errTelegramUnreachable = errors.New("Telegram 暂时无法连接，请稍后重试")
+
+// circuitBreaker Telegram 连续失败（网络错误、超时或 5xx，getUpdates 长轮询除外）达到 threshold 次后熔断 cooldown，
+// 期间新的请求立即失败，而不是每个请求都等到超时、堆积大量 goroutine。
+// 冷却结束后只放行一个探测请求，成功则恢复，失败则继续熔断
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int // 为 0 时不熔断
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+	trips     int64
+	lastErr   string
+}
+
+// newCircuitBreaker threshold 为 0 时不熔断
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow 请求 Telegram 前调用，熔断中返回 errTelegramUnreachable；probe 为 true 表示这是冷却结束后的探测请求
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold == 0 || b.failures < b.threshold {
+		return false, nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false, errTelegramUnreachable
+	}
+	b.probing = true
+	return true, nil
+}
+
+// record 记录请求结果：err 为 nil 且 status 小于 500 时视为成功；请求方取消的请求不计入
+func (b *circuitBreaker) record(probe bool, status int, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if b.threshold == 0 || isCanceled(err) {
+		return
+	}
+	if err == nil && status < http.StatusInternalServerError {
+		if b.failures >= b.threshold {
+			log.Printf("Telegram 已恢复，解除熔断")
+		}
+		b.failures = 0
+		return
+	}
+	if err != nil {
+		b.lastErr = err.Error()
+	} else {
+		b.lastErr = "HTTP " + strconv.Itoa(status)
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		if b.failures == b.threshold {
+			b.trips++
+			log.Printf("Telegram 连续失败 %d 次，熔断 %v: %s", b.failures, b.cooldown, b.lastErr)
+			recordError("telegram", "连续失败，已熔断: "+b.lastErr)
+		}
+	}
+}
+
+// recordPoll 记录 getUpdates 长轮询的结果：空闲的长轮询可能因为代理等原因超时，不计为失败，
+// 但成功返回说明 Telegram 已经可以访问，直接解除熔断
+func (b *circuitBreaker) recordPoll(status int) {
+	if status < http.StatusInternalServerError {
+		b.record(false, status, nil)
+	}
+}
+
+// rejecting 是否处于熔断的冷却期，冷却结束后请求可以进入 allow 作为探测
+func (b *circuitBreaker) rejecting() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold && time.Now().Before(b.openUntil)
+}
+
+// BreakerStatus Telegram 熔断状态
+type BreakerStatus struct {
+	Open      bool       `json:"open"`
+	Until     *time.Time `json:"until,omitempty"`
+	Failures  int        `json:"failures"` // 当前连续失败次数
+	Trips     int64      `json:"trips"`    // 累计熔断次数
+	LastError string     `json:"last_error,omitempty"`
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{Failures: b.failures, Trips: b.trips, LastError: b.lastErr}
+	if b.threshold > 0 && b.failures >= b.threshold {
+		until := b.openUntil
+		st.Open, st.Until = true, &until
+	}
+	return st
+}
+
+// retryAfter 距离下一次探测的秒数，至少为 1
+func (b *circuitBreaker) retryAfter() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(1, int(time.Until(b.openUntil).Seconds()+0.5))
+}
+
+// isOpen 是否处于熔断中（包括等待探测结果）
+func (b *circuitBreaker) isOpen() bool {
+	return b.status().Open
+}
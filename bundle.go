@@ -0,0 +1,381 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-disk/pkg/transfer"
+)
+
+// 备份包（.tgd）是一个 tar 文件，每个文件占一个 files/{n}/ 目录：
+//   - 分块文件默认保存 fileAll.txt 与原样的 blob_{i}（未解码），恢复时直接重新发送分块
+//   - 小文件，或带 -full 导出的分块文件，保存拼接后的完整文件，恢复时按大小重新分块上传
+//
+// 最后写入 bundle.json 记录导出时间与各文件原来的 file_id，仅供查看，恢复时不依赖它
+const bundleIndexName = "bundle.json"
+
+type bundleEntry struct {
+	Dir      string `json:"dir"`
+	FileID   string `json:"file_id"`
+	Filename string `json:"filename"`
+	Kind     string `json:"kind"` // chunks 或 file
+}
+
+type bundleIndex struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"created_at"`
+	Files     []bundleEntry `json:"files"`
+}
+
+// parseInterleaved 解析参数与位置参数混排的命令行，例如 bundle id1 -o out.tgd id2
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// cliProfile 命令行工具使用的 profile，未指定时优先使用单实例配置
+func cliProfile(profiles []*profile, name string, client *http.Client) (*profile, error) {
+	var p *profile
+	for _, candidate := range profiles {
+		if candidate.Name == name || (name == "" && (p == nil || candidate.Name == "default")) {
+			p = candidate
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("找不到 profile %s", name)
+	}
+	if err := p.init(client); err != nil {
+		return nil, fmt.Errorf("初始化 Bot 失败: %v", err)
+	}
+	return p, nil
+}
+
+// runBundle tg-disk bundle <file_id>... -o bundle.tgd：小文件写作 file_id:filename，分块文件只写清单的 file_id
+func runBundle(profiles []*profile, client *http.Client, args []string) int {
+	fs := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	out := fs.String("o", "", "输出文件，例如 backup.tgd")
+	full := fs.Bool("full", false, "分块文件保存拼接后的完整文件，而不是原样的分块")
+	profileName := fs.String("profile", "", "使用的 profile，默认为单实例配置")
+	ids, err := parseInterleaved(fs, args)
+	if err != nil {
+		return 2
+	}
+	if *out == "" || len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: tg-disk bundle <file_id[:filename]>... -o bundle.tgd [-full] [-profile name]")
+		return 2
+	}
+	p, err := cliProfile(profiles, *profileName, client)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建 %s 失败: %v\n", *out, err)
+		return 1
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	index := bundleIndex{Version: 1, CreatedAt: time.Now()}
+	for i, arg := range ids {
+		fileID, filename, _ := strings.Cut(arg, ":")
+		entry, err := p.bundleFile(tw, fmt.Sprintf("files/%d/", i), fileID, filename, *full)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "导出 %s 失败: %v\n", arg, err)
+			return 1
+		}
+		fmt.Printf("已导出 %s（%s）\n", entry.Filename, entry.Kind)
+		index.Files = append(index.Files, entry)
+	}
+	data, _ := json.MarshalIndent(index, "", "  ")
+	if err := writeTarFile(tw, bundleIndexName, data); err != nil {
+		fmt.Fprintf(os.Stderr, "写入 %s 失败: %v\n", *out, err)
+		return 1
+	}
+	if err := tw.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "写入 %s 失败: %v\n", *out, err)
+		return 1
+	}
+	fmt.Printf("共导出 %d 个文件到 %s\n", len(index.Files), *out)
+	return 0
+}
+
+func (p *profile) bundleFile(tw *tar.Writer, dir, fileID, filename string, full bool) (bundleEntry, error) {
+	entry := bundleEntry{Dir: dir, FileID: fileID, Filename: filename, Kind: "file"}
+	if filename != "" && filename != "fileAll.txt" {
+		data, err := downloadBlob(p.bot, fileID)
+		if err != nil {
+			return entry, err
+		}
+		return entry, writeTarFile(tw, dir+path.Base(filename), data)
+	}
+
+	m, err := readManifest(p.bot, fileID)
+	if err != nil {
+		return entry, err
+	}
+	entry.Filename = m.Filename
+	if full {
+		size, err := chunkedSize(p.bot, m)
+		if err != nil {
+			return entry, err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: dir + path.Base(m.Filename), Mode: 0644, Size: size, ModTime: time.Now()}); err != nil {
+			return entry, err
+		}
+		_, err = p.streamChunks(p.bot, tw, func() {}, m.Chunks, m.Codec, threadNumbers)
+		return entry, err
+	}
+
+	entry.Kind = "chunks"
+	if err := writeTarFile(tw, dir+"fileAll.txt", []byte(m.String())); err != nil {
+		return entry, err
+	}
+	for i, fid := range m.Chunks {
+		data, err := p.downloadBlobWithRetry(p.bot, fid)
+		if err != nil {
+			return entry, err
+		}
+		if err := writeTarFile(tw, dir+"blob_"+strconv.Itoa(i), data); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// restoreState 正在恢复的分块文件，分块按 tar 中的顺序逐个重新发送
+type restoreState struct {
+	dir      string
+	manifest *manifest
+	fileIDs  []string
+	uploadID string
+}
+
+// runRestore tg-disk restore bundle.tgd：把备份包中的文件重新上传到当前配置的 CHAT_ID，输出新的 file_id
+func runRestore(profiles []*profile, client *http.Client, args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	profileName := fs.String("profile", "", "使用的 profile，默认为单实例配置")
+	files, err := parseInterleaved(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 {
+		fmt.Fprintln(os.Stderr, "用法: tg-disk restore bundle.tgd [-profile name]")
+		return 2
+	}
+	p, err := cliProfile(profiles, *profileName, client)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开 %s 失败: %v\n", files[0], err)
+		return 1
+	}
+	defer f.Close()
+	tmpDir, err := os.MkdirTemp("", "tgdisk-restore-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建临时目录失败: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var cur *restoreState
+	restored := 0
+	finish := func() error {
+		if cur == nil {
+			return nil
+		}
+		state := cur
+		cur = nil
+		if state.manifest == nil {
+			return nil
+		}
+		for i, fid := range state.fileIDs {
+			if fid == "" {
+				return fmt.Errorf("%s 缺少第 %d 个分块", state.manifest.Filename, i)
+			}
+		}
+		state.manifest.Chunks = state.fileIDs
+		state.manifest.Variants = nil // 变体属于原来的聊天，不随备份恢复
+		msg, err := p.sendManifest(p.ChatID, tmpDir, state.manifest)
+		if err != nil {
+			return err
+		}
+		restored++
+		fmt.Printf("已恢复 %s: %s\n", state.manifest.Filename, msg.Document.FileID)
+		return nil
+	}
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取备份包失败: %v\n", err)
+			return 1
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name == bundleIndexName {
+			continue
+		}
+		dir, name := path.Split(hdr.Name)
+		if cur != nil && cur.dir != dir {
+			if err := finish(); err != nil {
+				fmt.Fprintf(os.Stderr, "恢复失败: %v\n", err)
+				return 1
+			}
+		}
+		if cur == nil {
+			cur = &restoreState{dir: dir}
+		}
+		if err := p.restoreEntry(cur, tr, tmpDir, name, &restored); err != nil {
+			fmt.Fprintf(os.Stderr, "恢复 %s 失败: %v\n", hdr.Name, err)
+			return 1
+		}
+	}
+	if err := finish(); err != nil {
+		fmt.Fprintf(os.Stderr, "恢复失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("共恢复 %d 个文件\n", restored)
+	return 0
+}
+
+func (p *profile) restoreEntry(cur *restoreState, r io.Reader, tmpDir, name string, restored *int) error {
+	switch {
+	case name == "fileAll.txt":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		m, err := transfer.ParseManifest(string(data))
+		if err != nil {
+			return err
+		}
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		cur.manifest, cur.fileIDs, cur.uploadID = m, make([]string, len(m.Chunks)), hex.EncodeToString(b)
+		return nil
+	case strings.HasPrefix(name, "blob_") && cur.manifest != nil:
+		i, err := strconv.Atoi(strings.TrimPrefix(name, "blob_"))
+		if err != nil || i < 0 || i >= len(cur.fileIDs) {
+			return fmt.Errorf("分块序号无效: %s", name)
+		}
+		chunkPath := filepath.Join(tmpDir, name)
+		if err := copyToFile(chunkPath, r); err != nil {
+			return err
+		}
+		defer os.Remove(chunkPath)
+		m := cur.manifest
+		caption := chunkCaption{Upload: cur.uploadID, Name: m.Filename, Index: i, Total: len(m.Chunks), Codec: m.Codec}
+		if m.ChunkSizes != nil {
+			caption.Size = m.ChunkSizes[i]
+		}
+		if m.ChunkHashes != nil {
+			caption.SHA256 = m.ChunkHashes[i]
+		}
+		cur.fileIDs[i], err = telegramBot{p: p}.SendDocument(chunkPath, caption.String())
+		return err
+	}
+
+	// 完整文件：小文件直接发送，大文件重新分块
+	filePath := filepath.Join(tmpDir, name)
+	if err := copyToFile(filePath, r); err != nil {
+		return err
+	}
+	defer os.Remove(filePath)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() <= chunkSize {
+		fileID, err := telegramBot{p: p}.SendDocument(filePath, name)
+		if err != nil {
+			return err
+		}
+		*restored++
+		fmt.Printf("已恢复 %s: %s:%s\n", name, fileID, name)
+		return nil
+	}
+
+	chunkDir, err := os.MkdirTemp(tmpDir, "chunks-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(chunkDir)
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	split, err := transfer.Splitter{ChunkSize: chunkSize, Dir: chunkDir}.Split(src)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	uploadID := hex.EncodeToString(b)
+	uploaded, err := (&transfer.Uploader{
+		Bot:     telegramBot{p: p},
+		Workers: threadNumbers,
+		Caption: func(c transfer.Chunk, total int) string {
+			return chunkCaption{Upload: uploadID, Name: name, Index: c.Index, Total: total, Size: c.Size, SHA256: c.SHA256}.String()
+		},
+	}).Upload(split.Chunks)
+	if err != nil {
+		return err
+	}
+	msg, err := p.sendManifest(p.ChatID, chunkDir, split.Manifest(name, uploaded.FileIDs))
+	if err != nil {
+		return err
+	}
+	*restored++
+	fmt.Printf("已恢复 %s: %s\n", name, msg.Document.FileID)
+	return nil
+}
+
+func copyToFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chunkCache 在内存中保留最近下载过的分块（LRU），
+// 视频拖动进度时播放器会反复发起重叠的 Range 请求，命中缓存即可避免重复从 Telegram 拉取同一分块
+type chunkCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type chunkCacheEntry struct {
+	key  string
+	data []byte
+}
+
+func newChunkCache(capacity int) *chunkCache {
+	return &chunkCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *chunkCache) Get(key string) ([]byte, bool) {
+	if c == nil || c.capacity <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*chunkCacheEntry).data, true
+	}
+	return nil, false
+}
+
+func (c *chunkCache) Put(key string, data []byte) {
+	if c == nil || c.capacity <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*chunkCacheEntry).data = data
+		return
+	}
+	c.items[key] = c.ll.PushFront(&chunkCacheEntry{key: key, data: data})
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*chunkCacheEntry).key)
+	}
+}
+
+// Len 当前缓存的分块数
+func (c *chunkCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Cap 最多缓存的分块数
+func (c *chunkCache) Cap() int {
+	if c == nil {
+		return 0
+	}
+	return c.capacity
+}
+
+// chunkCacheKey 缓存的键：缓存由所有 profile 共用，file_id 只对上传它的 Bot 有效，按 scope（profile 名称）区分，
+// 避免其他 profile 通过同一 file_id 读到缓存内容；/chunk 的 codec 由客户端指定，同一分块按不同 codec 读取的内容不同，也需要分开缓存
+func chunkCacheKey(scope, fileID, codec string) string {
+	return scope + "/" + fileID + "|" + codec
+}
+
+// fetchChunk 下载单个分块并按 codec 解码，优先读取缓存（缓存的是解码后的内容）
+func (p *profile) fetchChunk(bot *tgbotapi.BotAPI, fileID, codec string) ([]byte, error) {
+	key := chunkCacheKey(p.Name, fileID, codec)
+	if data, ok := p.srv.cache.Get(key); ok {
+		return data, nil
+	}
+
+	data, err := downloadBlob(bot, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decodeChunk(data, codec); err != nil {
+		return nil, fmt.Errorf("分块 %s: %v", fileID, err)
+	}
+
+	p.srv.cache.Put(key, data)
+	return data, nil
+}
+
+// downloadBlob 从 Telegram 下载文件的原始内容，不解码也不经过缓存
+func downloadBlob(bot *tgbotapi.BotAPI, fileID string) ([]byte, error) {
+	tgBlob, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("获取分块 %s 失败: %w", fileID, err)
+	}
+	blobURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, tgBlob.FilePath)
+	resp, err := telegramGet(bot, blobURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("下载分块 %s 失败: %w", fileID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载分块 %s 状态码异常: %d", fileID, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取分块 %s 失败: %v", fileID, err)
+	}
+	return data, nil
+}
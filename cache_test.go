@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChunkCacheAcrossProfiles(t *testing.T) {
+	tg := newFakeTelegram()
+	// file_id 只对上传它的 Bot 有效
+	tg.addFile("token-a", "shared-id", []byte("secret of a"))
+	a := &profile{Name: "a", BotToken: "token-a", PathPrefix: "/a"}
+	b := &profile{Name: "b", BotToken: "token-b", PathPrefix: "/b"}
+	newTestServer(t, tg, serverOptions{cache: newChunkCache(4)}, a, b)
+
+	rec := httptest.NewRecorder()
+	a.handleChunk(rec, httptest.NewRequest(http.MethodGet, "/chunk?file_id=shared-id", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "secret of a" {
+		t.Fatalf("profile a 下载分块返回 %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	b.handleChunk(rec, httptest.NewRequest(http.MethodGet, "/chunk?file_id=shared-id", nil))
+	if rec.Code == http.StatusOK {
+		t.Fatalf("profile b 通过相同 file_id 读到了 profile a 缓存的分块: %q", rec.Body.String())
+	}
+	if n := tg.called("token-b", "getFile"); n != 1 {
+		t.Errorf("profile b 调用 getFile %d 次，期望 1 次（不应命中 profile a 的缓存）", n)
+	}
+}
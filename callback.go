@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// callbackRetryDelays 回调失败后的重试间隔
+var callbackRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+// callbackBodyLimit 记录响应内容的上限，上传结果与错误信息都远小于该值
+const callbackBodyLimit = 64 << 10
+
+// uploadCallback 记录上传响应的状态码与内容，处理结束后 POST 到 callback_url：
+// 客户端不必等待上传请求返回或轮询 /api/jobs，断开连接后服务端发送完分块同样会回调
+type uploadCallback struct {
+	http.ResponseWriter
+	secret string // 签名密钥（CALLBACK_SECRET），为空时不接受 callback_url
+	url    string
+	status int
+	body   bytes.Buffer
+}
+
+func (c *uploadCallback) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *uploadCallback) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if room := callbackBodyLimit - c.body.Len(); room > 0 {
+		c.body.Write(p[:min(len(p), room)])
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// setUploadCallback 校验上传请求的 callback_url，为空时不回调。
+// 回调由服务端发起请求，为避免被用来探测内网，匿名上传与上传链接不接受回调
+func setUploadCallback(w http.ResponseWriter, r *http.Request, raw string, anonymous bool) error {
+	if raw == "" {
+		return nil
+	}
+	c, ok := w.(*uploadCallback)
+	if !ok {
+		return nil
+	}
+	if c.secret == "" {
+		return fmt.Errorf("未配置 CALLBACK_SECRET，不支持 callback_url")
+	}
+	if anonymous || uploadLinkFrom(r) != nil {
+		return fmt.Errorf("匿名上传与上传链接不支持 callback_url")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url 格式错误: %s", raw)
+	}
+	c.url = u.String()
+	return nil
+}
+
+// callbackPayload 回调请求体：成功时 result 为上传接口的返回内容，失败时 error 为错误信息
+type callbackPayload struct {
+	Status   string          `json:"status"` // done 或 failed
+	UploadID string          `json:"upload_id,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	HTTPCode int             `json:"http_status"`
+}
+
+// finish 请求处理结束后在后台发送回调，未设置 callback_url 时不做任何事
+func (c *uploadCallback) finish(r *http.Request) {
+	if c.url == "" {
+		return
+	}
+	payload := callbackPayload{Status: "done", UploadID: c.Header().Get("X-Upload-Id"), HTTPCode: c.status}
+	if c.status == http.StatusOK && json.Valid(c.body.Bytes()) {
+		payload.Result = append(json.RawMessage(nil), c.body.Bytes()...)
+	} else {
+		payload.Status = "failed"
+		payload.Error = strings.TrimSpace(c.body.String())
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		reqLog(r, "生成上传回调失败: %v", err)
+		return
+	}
+	go deliverCallback(c.url, c.secret, body, requestID(r))
+}
+
+// deliverCallback POST 回调，失败或返回非 2xx 时按 callbackRetryDelays 重试。
+// X-Tg-Disk-Signature 为 sha256= 加上 HMAC-SHA256(CALLBACK_SECRET, 时间戳 + "." + 请求体) 的十六进制，
+// 时间戳在 X-Tg-Disk-Timestamp 中，接收方可据此拒绝重放的旧请求
+func deliverCallback(u, secret string, body []byte, reqID string) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for attempt := 0; ; attempt++ {
+		err := postCallback(client, u, secret, body)
+		if err == nil {
+			return
+		}
+		if attempt >= len(callbackRetryDelays) {
+			log.Printf("[%s] 上传回调失败，已放弃: %s，%v", reqID, u, err)
+			return
+		}
+		log.Printf("[%s] 上传回调失败，%v 后重试: %s，%v", reqID, callbackRetryDelays[attempt], u, err)
+		time.Sleep(callbackRetryDelays[attempt])
+	}
+}
+
+func postCallback(client *http.Client, u, secret string, body []byte) error {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tg-Disk-Timestamp", ts)
+	req.Header.Set("X-Tg-Disk-Signature", "sha256="+callbackSignature(secret, ts, body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态异常: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func callbackSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
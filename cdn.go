@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// queryLinks 为 true 时（LINK_STYLE=query）生成旧的 /d?file_id=... 形式链接，默认生成路径形式链接
+	queryLinks bool
+	// downloadCacheControl 自定义 /d 成功响应的 Cache-Control（DOWNLOAD_CACHE_CONTROL），为空时由 CDN_MODE 决定
+	downloadCacheControl string
+)
+
+// chunkedPathSegment 路径形式链接中表示分块文件的占位段：/d/{file_id}/-/{文件名}
+const chunkedPathSegment = "-"
+
+// buildPathDownloadURL 生成路径形式的下载链接：小文件为 /d/{file_id}/{filename}，
+// 分块文件为 /d/{file_id}/-/{name}，name 只影响下载工具保存时的默认名称，可以为空
+func buildPathDownloadURL(base, fileID, filename, name string) string {
+	link := strings.TrimRight(base, "/") + "/d/" + url.PathEscape(fileID) + "/"
+	if filename == "" || filename == "fileAll.txt" {
+		return link + chunkedPathSegment + "/" + url.PathEscape(name)
+	}
+	return link + url.PathEscape(filename)
+}
+
+// parseDownloadPath 解析 /d/ 之后的路径形式链接，返回 file_id 与 filename（分块文件为空）。
+// 不含 / 的路径是短链接，ok 为 false
+func parseDownloadPath(rest string) (fileID, filename string, ok bool) {
+	fileID, name, found := strings.Cut(rest, "/")
+	if !found || fileID == "" {
+		return "", "", false
+	}
+	if name == chunkedPathSegment || strings.HasPrefix(name, chunkedPathSegment+"/") {
+		return fileID, "", true
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	return fileID, name, true
+}
+
+// handlePathDownload GET /d/{file_id}/{filename}、/d/{file_id}/-/{文件名}，
+// 换成对应的 file_id、filename 参数后按普通下载处理
+func (p *profile) handlePathDownload(w http.ResponseWriter, r *http.Request, fileID, filename string) {
+	q := r.URL.Query()
+	q.Set("file_id", fileID)
+	if filename != "" {
+		q.Set("filename", filename)
+	} else {
+		q.Del("filename")
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	p.handleDownload(w, r2)
+}
+
+// downloadCacheWriter 为 /d 的成功响应（200、206、304）设置 Cache-Control，错误响应不带缓存头，以免被 CDN 缓存。
+// file_id 对应的内容不会变化，CDN 模式下默认长期缓存；私有实例、下载令牌和待审核的文件只允许浏览器缓存
+func (p *profile) downloadCacheWriter(w http.ResponseWriter, fileID string) http.ResponseWriter {
+	value := downloadCacheControl
+	if value == "" {
+		if !p.srv.cdnMode {
+			return w
+		}
+		value = "public, max-age=31536000, immutable"
+	}
+	if p.downloadAuthRequired(fileID) || p.DownloadTokenSecret != "" || p.srv.moderation.status(fileID) == moderationPending {
+		value = strings.Replace(value, "public", "private", 1)
+		if !strings.Contains(value, "private") && !strings.Contains(value, "no-store") {
+			value = "private, " + value
+		}
+	}
+	return &cacheControlWriter{ResponseWriter: w, value: value}
+}
+
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (c *cacheControlWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		switch status {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+			c.Header().Set("Cache-Control", c.value)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cacheControlWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		// 未显式写响应头时状态码为 200，由下层决定 Content-Type
+		c.wroteHeader = true
+		c.Header().Set("Cache-Control", c.value)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *cacheControlWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// checkReport 配置检查结果，逐项输出到标准输出
+type checkReport struct {
+	failed int
+}
+
+func (c *checkReport) ok(format string, args ...any) {
+	fmt.Printf("  ✔ "+format+"\n", args...)
+}
+
+func (c *checkReport) fail(format string, args ...any) {
+	c.failed++
+	fmt.Printf("  ✘ "+format+"\n", args...)
+}
+
+// runCheck tg-disk check：配置已在 main 中加载完毕，这里逐个验证 Bot Token、存储聊天的发送权限与本地目录，
+// 有失败项时返回非零退出码，可用于部署配置的 CI 检查
+func runCheck(srv *server, client *http.Client) int {
+	report := &checkReport{}
+
+	fmt.Println("本地目录：")
+	checkWritableDir(report, "临时目录", os.TempDir())
+	checkWritableDir(report, "上传日志目录 UPLOAD_WAL_DIR", walDir)
+	if srv.moderation != nil {
+		checkWritableDir(report, "审核队列 MODERATION_FILE 所在目录", filepath.Dir(srv.moderation.path))
+	}
+	if srv.slugs != nil {
+		checkWritableDir(report, "短链接 SHORT_LINKS_FILE 所在目录", filepath.Dir(srv.slugs.path))
+	}
+
+	for _, p := range srv.profiles {
+		fmt.Printf("profile %s：\n", p.Name)
+		if err := p.init(client); err != nil {
+			report.fail("Bot Token 无效或无法连接 Telegram: %v", err)
+			continue
+		}
+		report.ok("Bot Token 有效（@%s）", p.bot.Self.UserName)
+
+		// 发送后立即删除，确认机器人可以向存储聊天发消息
+		msg, err := p.bot.Send(tgbotapi.NewMessage(p.ChatID, "tg-disk 配置检查"))
+		if err != nil {
+			report.fail("无法向 CHAT_ID %d 发送消息: %v", p.ChatID, err)
+		} else {
+			report.ok("可以向 CHAT_ID %d 发送消息", p.ChatID)
+			_, _ = p.bot.Request(tgbotapi.NewDeleteMessage(p.ChatID, msg.MessageID))
+		}
+
+		if p.BaseURL != "" && !strings.HasPrefix(p.BaseURL, "http://") && !strings.HasPrefix(p.BaseURL, "https://") {
+			report.fail("BASE_URL 应以 http:// 或 https:// 开头: %s", p.BaseURL)
+		}
+	}
+
+	if report.failed > 0 {
+		fmt.Printf("检查未通过：%d 项失败\n", report.failed)
+		return 1
+	}
+	fmt.Println("检查通过")
+	return 0
+}
+
+func checkWritableDir(report *checkReport, name, dir string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		report.fail("%s %s 无法创建: %v", name, dir, err)
+		return
+	}
+	f, err := os.CreateTemp(dir, ".tg-disk-check-*")
+	if err != nil {
+		report.fail("%s %s 不可写: %v", name, dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	report.ok("%s %s 可写", name, dir)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// chunkURL 单个分块的下载链接，带上 codec 时由服务端解码后返回原始内容
+func (p *profile) chunkURL(base, fileID, codec string) string {
+	q := url.Values{"file_id": {fileID}}
+	if codec != "" {
+		q.Set("codec", codec)
+	}
+	for k, v := range p.tokenParams(fileID) {
+		q[k] = v
+	}
+	return strings.TrimRight(base, "/") + "/chunk?" + q.Encode()
+}
+
+// handleChunk GET /chunk?file_id=...，返回单个分块，配合 /api/files/{id}/manifest 由浏览器或命令行工具并发拉取。
+// Telegram 的 file_id 对应的内容不会变化，因此允许客户端和 CDN 长期缓存
+func (p *profile) handleChunk(w http.ResponseWriter, r *http.Request) {
+	bot := p.botFor(r)
+	fileID := r.URL.Query().Get("file_id")
+	if fileID == "" {
+		http.Error(w, "缺少 file_id 参数", http.StatusBadRequest)
+		return
+	}
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	codec := r.URL.Query().Get("codec")
+	etag := `"` + fileID + "." + codec + `"`
+	if match := r.Header.Get("If-None-Match"); match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	release, ok := p.reserveBuffers(w, r, chunkSize)
+	if !ok {
+		return
+	}
+	defer release()
+	data, err := p.fetchChunkWithRetry(bot, fileID, codec)
+	if isFileGone(err) {
+		p.writeGone(w, r, fileID)
+		return
+	}
+	if err != nil {
+		if !isCanceled(err) && !errors.Is(err, errTelegramUnreachable) {
+			p.alert(eventBrokenChunk, fileID, "分块下载失败", fmt.Sprintf("file_id: %s，%v", fileID, err))
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", etag)
+	// 私有模式、下载令牌下不允许共享缓存保存内容
+	if p.downloadAuthRequired(fileID) || p.DownloadTokenSecret != "" {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Write(data)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// getChunk 以未登录身份请求 /chunk，返回状态码
+func getChunk(p *profile, fileID string) int {
+	rec := httptest.NewRecorder()
+	p.handleChunk(rec, httptest.NewRequest(http.MethodGet, "/chunk?file_id="+fileID, nil))
+	return rec.Code
+}
+
+func TestChunkOfReportedManifest(t *testing.T) {
+	reports, err := loadReportStore(filepath.Join(t.TempDir(), "reports.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := newFakeTelegram()
+	m := &manifest{Filename: "a.bin", Chunks: []string{"chunk-1", "chunk-2"}, Variants: []uploadVariant{{Name: variantPreview, FileID: "preview-1", Filename: "a_preview.jpg"}}}
+	tg.addFile("token", "manifest-1", []byte(m.String()))
+	for _, id := range []string{"chunk-1", "chunk-2", "preview-1", "other-chunk"} {
+		tg.addFile("token", id, []byte("data-"+id))
+	}
+	p := &profile{Name: "default", BotToken: "token", AccessPwd: "secret"}
+	newTestServer(t, tg, serverOptions{reports: reports}, p)
+
+	it := &reportItem{Profile: p.Name, FileID: "manifest-1", URL: "https://example.com/d/manifest-1/-/a.bin", Reason: "spam", ClientIP: "203.0.113.1"}
+	if _, err := reports.add(it); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.handleAbuseReport(it.ID, "disable"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"chunk-1", "chunk-2", "preview-1"} {
+		if code := getChunk(p, id); code != http.StatusUnavailableForLegalReasons {
+			t.Errorf("下架清单的分块 %s 返回 %d，期望 451", id, code)
+		}
+	}
+	if code := getChunk(p, "other-chunk"); code != http.StatusOK {
+		t.Errorf("其他分块返回 %d，期望 200", code)
+	}
+
+	// 重启后仍然拦截
+	reloaded, err := loadReportStore(reports.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.isBlocked("chunk-2") {
+		t.Error("重新加载举报记录后分块未被拦截")
+	}
+}
+
+func TestChunkOfPendingManifest(t *testing.T) {
+	queue, err := loadModerationQueue(filepath.Join(t.TempDir(), "moderation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := newFakeTelegram()
+	tg.addFile("token", "chunk-1", []byte("data"))
+	p := &profile{Name: "default", BotToken: "token", AccessPwd: "secret"}
+	newTestServer(t, tg, serverOptions{moderation: queue}, p)
+
+	it := &moderationItem{Profile: p.Name, FileID: "manifest-1", Filename: "a.bin", Chunked: true, Parts: []string{"chunk-1"}}
+	if err := queue.add(it); err != nil {
+		t.Fatal(err)
+	}
+	if code := getChunk(p, "chunk-1"); code != http.StatusForbidden {
+		t.Errorf("待审核清单的分块返回 %d，期望 403", code)
+	}
+	if queue.messageID(p.Name, "chunk-1") != 0 {
+		t.Error("分块不应返回清单的消息 ID")
+	}
+
+	if _, err := p.moderate(it.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if code := getChunk(p, "chunk-1"); code != http.StatusOK {
+		t.Errorf("审核通过后分块返回 %d，期望 200", code)
+	}
+}
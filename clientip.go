@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// trustedProxies 受信任的反向代理地址，只有来自这些地址的请求才会读取 X-Forwarded-For / X-Real-IP
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies 解析逗号分隔的 IP 或 CIDR 列表
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			if ip := net.ParseIP(part); ip != nil && ip.To4() != nil {
+				part += "/32"
+			} else {
+				part += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES 格式错误: %s", part)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 获取真实客户端 IP：从 X-Forwarded-For 右侧开始跳过受信任代理，取第一个不受信任的地址
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !isTrustedProxy(remote) {
+		return host
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !isTrustedProxy(ip) || i == 0 {
+				return ip.String()
+			}
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// ipLimiter 限制单个 IP 同时进行的传输数量
+type ipLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[string]int
+}
+
+func newIPLimiter(max int) *ipLimiter {
+	return &ipLimiter{max: max, active: make(map[string]int)}
+}
+
+func (l *ipLimiter) acquire(ip string) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip] >= l.max {
+		return false
+	}
+	l.active[ip]++
+	return true
+}
+
+func (l *ipLimiter) release(ip string) {
+	if l.max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip]--; l.active[ip] <= 0 {
+		delete(l.active, ip)
+	}
+}
+
+var (
+	uploadLimiter   = newIPLimiter(0)
+	downloadLimiter = newIPLimiter(0)
+)
+
+// limitPerIP 超过单 IP 并发上限时返回 429
+func limitPerIP(l *ipLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !l.acquire(ip) {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, r, http.StatusTooManyRequests, errCodeTooManyRequests, "同时进行的传输过多，请稍后重试")
+			return
+		}
+		defer l.release(ip)
+		next(w, r)
+	}
+}
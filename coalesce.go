@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// chunkFlight 一次正在进行的分块下载，同一分块的其他请求等待它完成后共用结果
+type chunkFlight struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var (
+	chunkFlightsMu sync.Mutex
+	chunkFlights   = make(map[string]*chunkFlight)
+	// coalescedFetches 因同一分块正在下载而直接共用结果的次数
+	coalescedFetches atomic.Int64
+)
+
+// coalesceFetch 合并对同一分块的并发下载：多个客户端同时下载同一个大文件时，
+// 每个分块只从 Telegram 拉取一次，结果分发给所有等待的响应。
+// 返回的切片在各请求间共享，调用方不能修改
+func coalesceFetch(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	chunkFlightsMu.Lock()
+	if f, ok := chunkFlights[key]; ok {
+		chunkFlightsMu.Unlock()
+		coalescedFetches.Add(1)
+		<-f.done
+		// 发起下载的请求中途断开时自己重新下载，而不是跟着失败
+		if isCanceled(f.err) {
+			return fetch()
+		}
+		return f.data, f.err
+	}
+	f := &chunkFlight{done: make(chan struct{})}
+	chunkFlights[key] = f
+	chunkFlightsMu.Unlock()
+
+	f.data, f.err = fetch()
+
+	chunkFlightsMu.Lock()
+	delete(chunkFlights, key)
+	chunkFlightsMu.Unlock()
+	close(f.done)
+	return f.data, f.err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// codecGzip 分块在上传前经过 gzip 压缩，下载时需解压
+const codecGzip = "gzip"
+
+// uploadCompression 为 false 时不压缩任何上传内容
+var uploadCompression = true
+
+// shouldCompress 根据文件名推断的类型以及内容嗅探判断是否值得压缩，
+// 图片、视频、压缩包等本身已压缩的内容跳过
+func (p *profile) shouldCompress(filename string, head []byte) bool {
+	if !uploadCompression {
+		return false
+	}
+	if ct := p.srv.mimeTypes.contentTypeFor(filename); ct != "application/octet-stream" {
+		return isCompressible(ct)
+	}
+	return isCompressible(http.DetectContentType(head))
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeChunk 按清单中记录的编码还原分块内容
+func decodeChunk(data []byte, codec string) ([]byte, error) {
+	switch codec {
+	case "":
+		return data, nil
+	case codecGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解压分块失败: %v", err)
+		}
+		defer gz.Close()
+		out, err := io.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("解压分块失败: %v", err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("不支持的分块编码: %s", codec)
+}
+
+// decodeReader 按编码包装读取器，用于病毒扫描等需要原始内容的场景
+func decodeReader(r io.Reader, codec string) (io.Reader, error) {
+	if codec == codecGzip {
+		return gzip.NewReader(r)
+	}
+	return r, nil
+}
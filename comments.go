@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCommentLength 单条备注的最大字符数
+const maxCommentLength = 2000
+
+// comment 文件备注，只追加不修改，按时间顺序保留全部历史
+type comment struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// commentStore 文件备注，按 profile/file_id 保存在 JSON 文件中
+type commentStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string][]comment
+}
+
+func loadCommentStore(path string) (*commentStore, error) {
+	st := &commentStore{path: path, items: make(map[string][]comment)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文件备注失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.items); err != nil {
+		return nil, fmt.Errorf("解析文件备注失败: %v", err)
+	}
+	return st, nil
+}
+
+func (st *commentStore) list(profile, fileID string) []comment {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]comment(nil), st.items[profile+"/"+fileID]...)
+}
+
+// add 追加一条备注，返回带 ID 与时间的备注
+func (st *commentStore) add(profile, fileID, author, text string) (comment, error) {
+	if st == nil {
+		return comment{}, errors.New("未开启文件备注")
+	}
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	c := comment{ID: hex.EncodeToString(b), Author: author, Text: text, CreatedAt: time.Now()}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + fileID
+	old := st.items[key]
+	st.items[key] = append(old[:len(old):len(old)], c)
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		st.items[key] = old
+		if len(old) == 0 {
+			delete(st.items, key)
+		}
+		return comment{}, fmt.Errorf("保存文件备注失败: %v", err)
+	}
+	return c, nil
+}
+
+// handleComments /api/files/{id}/comments：GET 按时间顺序列出备注，权限与下载相同；
+// POST 追加备注，需要访问密码。访问密码是共用的，作者由请求体中的 author 填写
+func (p *profile) handleComments(w http.ResponseWriter, r *http.Request, fileID string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !p.authorizeDownload(w, r, fileID) {
+			return
+		}
+		list := p.srv.comments.list(p.Name, fileID)
+		if list == nil {
+			list = []comment{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		if !p.isAuthenticated(r) {
+			writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+			return
+		}
+		var req struct {
+			Author string `json:"author"`
+			Text   string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体应为 {\"author\":...,\"text\":...}", nil)
+			return
+		}
+		text := strings.TrimSpace(req.Text)
+		if utf8.RuneCountInString(text) > maxCommentLength {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, fmt.Sprintf("备注最多 %d 个字符", maxCommentLength), nil)
+			return
+		}
+		author := strings.TrimSpace(req.Author)
+		if author == "" {
+			author = "匿名"
+		}
+		c, err := p.srv.comments.add(p.Name, fileID, author, text)
+		if err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET、POST", nil)
+	}
+}
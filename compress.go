@@ -0,0 +1,123 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// isCompressible 仅压缩文本类响应，图片、视频、压缩包等本身已压缩的内容直接透传
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+	switch {
+	case contentType == "text/event-stream":
+		// 事件流需要逐条发出，压缩会把事件攒在缓冲区里
+		return false
+	case strings.HasPrefix(contentType, "text/"):
+		return true
+	case contentType == "application/json",
+		contentType == "application/javascript",
+		contentType == "application/xml",
+		contentType == "image/svg+xml",
+		strings.HasSuffix(contentType, "+json"),
+		strings.HasSuffix(contentType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter 在第一次写响应头时根据 Content-Type 决定是否压缩
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.Header()
+	if status == http.StatusOK && h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		// 压缩后的字节与原始内容不同，强 ETag 降级为弱 ETag
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		g.gz = gzipWriterPool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		_ = g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) close() {
+	if g.gz != nil {
+		_ = g.gz.Close()
+		gzipWriterPool.Put(g.gz)
+		g.gz = nil
+	}
+}
+
+// withCompression 按 Accept-Encoding 协商 gzip 压缩 JSON 接口、静态页面和文本类文件下载，
+// Range 请求不压缩，以免偏移量与压缩后的内容对不上。标准库没有 Brotli 编码器，只接受 br 的客户端收到未压缩的响应
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Header.Get("Range") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		if q := strings.ReplaceAll(params, " ", ""); q == "q=0" || q == "q=0.0" {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// manifestETag 分块文件的 ETag：清单记录了整个文件的 SHA-256 时直接使用，
+// 旧清单取清单内容的哈希，清单只写一次，同一个 file_id 的内容不会变化
+func manifestETag(m *manifest) string {
+	if m.SHA256 != "" {
+		return `"` + m.SHA256 + `"`
+	}
+	sum := sha256.Sum256([]byte(m.String()))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified 设置 ETag、Last-Modified（modTime 为零值时不设置），
+// 客户端缓存仍然有效时直接返回 304。ETag 与 If-Range 不一致时去掉 Range 头，按完整下载处理
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && r.Header.Get("Range") != "" && !ifRangeMatches(ifRange, etag, modTime) {
+		r.Header.Del("Range")
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagListMatches(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims == "" || modTime.IsZero() {
+		return false
+	} else if t, err := http.ParseTime(ims); err != nil || modTime.Truncate(time.Second).After(t) {
+		return false
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches If-None-Match 按弱比较匹配，gzip 压缩后的响应 ETag 会变成 W/ 开头
+func etagListMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches If-Range 为 ETag 时需要强匹配，为日期时需要与 Last-Modified 完全一致
+func ifRangeMatches(header, etag string, modTime time.Time) bool {
+	if strings.HasPrefix(header, `"`) || strings.HasPrefix(header, "W/") {
+		return header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
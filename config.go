@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt 读取非负整数环境变量，未设置时返回默认值，格式错误直接退出
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("%s 格式错误，应为非负整数: %s", key, v)
+	}
+	return n
+}
+
+// envDuration 读取时长环境变量（如 30m、24h），未设置时返回默认值，格式错误直接退出
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("%s 格式错误，应为时长（如 30m、24h）: %s", key, v)
+	}
+	return d
+}
+
+// parseSize 解析字节数，支持 KB、MB、GB、TB 后缀（按 1024 进位），如 500MB、10GB
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(s, unit) {
+			mult = 1 << (10 * (i + 1))
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, "B")
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("大小格式错误: %s", s)
+	}
+	return n * mult, nil
+}
+
+// envSize 读取字节数环境变量（如 10GB），未设置时返回默认值，格式错误直接退出
+func envSize(key string, def int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := parseSize(v)
+	if err != nil {
+		log.Fatalf("%s 格式错误，应为大小（如 500MB、10GB）: %s", key, v)
+	}
+	return n
+}
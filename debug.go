@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// checkAdminToken 校验 Authorization: Bearer <token> 或 admin_token 查询参数
+func checkAdminToken(r *http.Request, adminToken string) bool {
+	if adminToken == "" {
+		return false
+	}
+	token := r.URL.Query().Get("admin_token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// requireAdmin 没有携带管理员令牌时返回 401，令牌错误时返回 403，错误格式与其他 /api 接口相同
+func requireAdmin(adminToken string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminToken(r, adminToken) {
+			if r.URL.Query().Get("admin_token") == "" && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要管理员令牌", nil)
+				return
+			}
+			writeAPIError(w, r, http.StatusForbidden, errCodeForbidden, "管理员令牌错误", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// debugHandler /debug/pprof 与 /debug/vars，用于排查大文件下载时的内存问题
+func debugHandler(adminToken string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return requireAdmin(adminToken, mux)
+}
+
+func init() {
+	expvar.Publish("temp_gc", expvar.Func(func() any {
+		return map[string]int64{
+			"runs":            tempGCStats.Runs.Load(),
+			"removed_dirs":    tempGCStats.RemovedDirs.Load(),
+			"reclaimed_bytes": tempGCStats.ReclaimedBytes.Load(),
+		}
+	}))
+	expvar.Publish("chunk_sizes", expvar.Func(func() any {
+		return tuner.snapshot()
+	}))
+}
+
+// publishVars 在 /debug/vars 中公开该实例的缓冲与分块缓存统计，expvar 为进程内共享，只能调用一次
+func (s *server) publishVars() {
+	expvar.Publish("buffer_memory", expvar.Func(func() any {
+		used, limit := s.buffers.usage()
+		return map[string]int64{
+			"used":     used,
+			"limit":    limit,
+			"rejected": s.buffers.rejected.Load(),
+		}
+	}))
+	expvar.Publish("chunk_cache", expvar.Func(func() any {
+		return map[string]int64{
+			"entries":   int64(s.cache.Len()),
+			"capacity":  int64(s.cache.Cap()),
+			"coalesced": coalescedFetches.Load(),
+		}
+	}))
+}
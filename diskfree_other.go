@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+// diskFree 其他平台无法查询剩余空间，总是按空间充足处理
+func diskFree(dir string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskFree 返回 dir 所在磁盘对当前用户可用的字节数
+func diskFree(dir string) (uint64, bool) {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, false
+	}
+	var avail uint64
+	r, _, _ := procGetDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&avail)), 0, 0)
+	if r == 0 {
+		return 0, false
+	}
+	return avail, true
+}
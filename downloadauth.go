@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// 单个文件的下载鉴权设置
+const (
+	downloadAuthDefault = "default" // 按 profile 的 download_auth
+	downloadAuthPrivate = "private" // 总是需要访问密码
+	downloadAuthPublic  = "public"  // 总是免登录下载
+)
+
+// downloadAuthStore 单个文件的下载鉴权设置，按 profile/file_id 保存在 JSON 文件中，没有记录即为 default
+type downloadAuthStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]string
+}
+
+func loadDownloadAuthStore(path string) (*downloadAuthStore, error) {
+	st := &downloadAuthStore{path: path, items: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取下载鉴权设置失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.items); err != nil {
+		return nil, fmt.Errorf("解析下载鉴权设置失败: %v", err)
+	}
+	return st, nil
+}
+
+func (st *downloadAuthStore) get(profile, fileID string) string {
+	if st == nil {
+		return downloadAuthDefault
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if mode, ok := st.items[profile+"/"+fileID]; ok {
+		return mode
+	}
+	return downloadAuthDefault
+}
+
+// set 保存下载鉴权设置，default 删除记录
+func (st *downloadAuthStore) set(profile, fileID, mode string) error {
+	if st == nil {
+		return errors.New("未开启单个文件的下载鉴权设置")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + fileID
+	old, had := st.items[key]
+	if mode == downloadAuthDefault {
+		delete(st.items, key)
+	} else {
+		st.items[key] = mode
+	}
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		if had {
+			st.items[key] = old
+		} else {
+			delete(st.items, key)
+		}
+		return fmt.Errorf("保存下载鉴权设置失败: %v", err)
+	}
+	return nil
+}
+
+// downloadAuthRequired 下载该文件是否需要访问密码：单个文件的设置优先，其次按 profile 的 download_auth
+func (p *profile) downloadAuthRequired(fileID string) bool {
+	switch p.srv.downloadAuth.get(p.Name, fileID) {
+	case downloadAuthPrivate:
+		return true
+	case downloadAuthPublic:
+		return false
+	}
+	return p.DownloadAuth
+}
+
+// handleDownloadAuthSetting /api/files/{id}/auth：GET 返回该文件的下载鉴权设置，
+// PUT 修改（请求体 {"mode":"private|public|default"}），需要访问密码
+func (p *profile) handleDownloadAuthSetting(w http.ResponseWriter, r *http.Request, fileID string) {
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
+			(req.Mode != downloadAuthDefault && req.Mode != downloadAuthPrivate && req.Mode != downloadAuthPublic) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体应为 {\"mode\":\"private|public|default\"}", nil)
+			return
+		}
+		if err := p.srv.downloadAuth.set(p.Name, fileID, req.Mode); err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET、PUT", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mode":     p.srv.downloadAuth.get(p.Name, fileID),
+		"required": p.downloadAuthRequired(fileID),
+	})
+}
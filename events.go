@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 推送给网页的事件类型
+const (
+	eventFileAdded      = "file_added"
+	eventUploadProgress = "upload_progress"
+	eventModerated      = "moderated"
+)
+
+// serverEvent 通过 /api/events 推送的一条事件
+type serverEvent struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// eventHub 每个 profile 一个，订阅者处理不过来时直接丢弃事件，不阻塞上传
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan serverEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan serverEvent]struct{})}
+}
+
+func (h *eventHub) subscribe() chan serverEvent {
+	ch := make(chan serverEvent, 16)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan serverEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) publish(typ string, data any) {
+	if h == nil {
+		return
+	}
+	ev := serverEvent{Type: typ, Data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// handleEvents GET /api/events，以 Server-Sent Events 推送上传完成、上传进度和审核结果，
+// 多个打开的页面无需轮询即可保持同步，需要登录
+func (p *profile) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, "服务器不支持 Flush", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// 关闭 Nginx 的响应缓冲，否则事件会被攒到一起才发出
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := p.events.subscribe()
+	defer p.events.unsubscribe(ch)
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev := <-ch:
+			data, _ := json.Marshal(ev.Data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// messageThumb Telegram 为图片、视频文件消息生成的缩略图 file_id，没有时返回空字符串
+func messageThumb(msg tgbotapi.Message) string {
+	switch {
+	case msg.Document != nil && msg.Document.Thumbnail != nil:
+		return msg.Document.Thumbnail.FileID
+	case msg.Video != nil && msg.Video.Thumbnail != nil:
+		return msg.Video.Thumbnail.FileID
+	}
+	return ""
+}
+
+// galleryItem 相册中的一张照片或一段视频
+type galleryItem struct {
+	mediaItem
+	Kind         string `json:"kind"`
+	DownloadURL  string `json:"download_url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// galleryDay 同一天拍摄的媒体
+type galleryDay struct {
+	Date  string        `json:"date"`
+	Items []galleryItem `json:"items"`
+}
+
+// galleryMonth 不带 month 参数时返回的时间线，每个月的媒体数量
+type galleryMonth struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+}
+
+// handleGallery GET /api/gallery?month=2024-06 按拍摄日期分组返回该月的照片与视频，不带 month 时返回各月数量，
+// GET /api/gallery/thumb/{file_id} 返回缩略图，都需要访问密码（<img> 中可以使用登录 Cookie）
+func (p *profile) handleGallery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET", nil)
+		return
+	}
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	if fileID, ok := strings.CutPrefix(r.URL.Path, "/api/gallery/thumb/"); ok {
+		p.serveGalleryThumb(w, r, fileID)
+		return
+	}
+	if r.URL.Path != "/api/gallery" {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未知接口", nil)
+		return
+	}
+
+	month := r.URL.Query().Get("month")
+	w.Header().Set("Content-Type", "application/json")
+	if month == "" {
+		months := []galleryMonth{}
+		for _, it := range p.srv.mediaIndex.list(p.Name, "", "") {
+			if !p.visibleMedia(it.FileID) {
+				continue
+			}
+			m := it.date()[:7]
+			if n := len(months); n > 0 && months[n-1].Month == m {
+				months[n-1].Count++
+			} else {
+				months = append(months, galleryMonth{Month: m, Count: 1})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"months": months})
+		return
+	}
+	if _, err := time.Parse("2006-01", month); err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "month 格式应为 2006-01", nil)
+		return
+	}
+
+	base := p.requestBase(r)
+	days := []galleryDay{}
+	for _, it := range p.srv.mediaIndex.list(p.Name, month, "") {
+		if !p.visibleMedia(it.FileID) {
+			continue
+		}
+		item := galleryItem{mediaItem: it, Kind: mediaKind(it.Filename), DownloadURL: p.mediaURL(base, it)}
+		if it.Thumb != "" {
+			item.ThumbnailURL = base + "/api/gallery/thumb/" + url.PathEscape(it.FileID)
+		}
+		date := it.date()
+		if n := len(days); n > 0 && days[n-1].Date == date {
+			days[n-1].Items = append(days[n-1].Items, item)
+		} else {
+			days = append(days, galleryDay{Date: date, Items: []galleryItem{item}})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"month": month, "days": days})
+}
+
+// serveGalleryThumb 只返回媒体索引中登记的缩略图，不能借此下载任意 file_id
+func (p *profile) serveGalleryThumb(w http.ResponseWriter, r *http.Request, fileID string) {
+	e, ok := p.srv.mediaIndex.get(p.Name, fileID)
+	if !ok || e.Thumb == "" || !p.visibleMedia(fileID) {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "没有缩略图", nil)
+		return
+	}
+	p.serveTelegramFile(w, r, e.Thumb, "thumb.jpg")
+}
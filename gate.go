@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// eventUploadQueued 上传在队列中等待，data 中的 position 从 1 开始
+const eventUploadQueued = "upload_queued"
+
+var errQueueFull = errors.New("上传队列已满")
+
+// uploadGate 限制全局同时进行的上传数，多出的请求按到达顺序排队，
+// 避免一批上传同时占满临时目录并触发 Telegram 限流
+type uploadGate struct {
+	mu       sync.Mutex
+	max      int // 为 0 时不限制
+	maxQueue int
+	active   int
+	queue    []*gateTicket
+}
+
+type gateTicket struct {
+	ready    chan struct{} // 轮到该请求时关闭
+	position chan int      // 排队位置变化，只保留最新值
+}
+
+func newUploadGate(max, maxQueue int) *uploadGate {
+	return &uploadGate{max: max, maxQueue: maxQueue}
+}
+
+// acquire 获取上传名额，排队期间每次位置变化调用 onPosition，ctx 结束（客户端断开）时退出队列
+func (g *uploadGate) acquire(ctx context.Context, onPosition func(int)) error {
+	if g.max <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	if g.active < g.max && len(g.queue) == 0 {
+		g.active++
+		g.mu.Unlock()
+		return nil
+	}
+	if len(g.queue) >= g.maxQueue {
+		g.mu.Unlock()
+		return errQueueFull
+	}
+	t := &gateTicket{ready: make(chan struct{}), position: make(chan int, 1)}
+	g.queue = append(g.queue, t)
+	pos := len(g.queue)
+	g.mu.Unlock()
+
+	onPosition(pos)
+	for {
+		select {
+		case <-t.ready:
+			return nil
+		case pos := <-t.position:
+			onPosition(pos)
+		case <-ctx.Done():
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			select {
+			case <-t.ready:
+				// 刚好轮到时断开，名额交给下一个
+				g.releaseLocked()
+			default:
+				g.removeLocked(t)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+func (g *uploadGate) release() {
+	if g.max <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.releaseLocked()
+}
+
+// releaseLocked 名额直接交给队首，active 不变
+func (g *uploadGate) releaseLocked() {
+	if len(g.queue) == 0 {
+		g.active--
+		return
+	}
+	close(g.queue[0].ready)
+	g.queue = g.queue[1:]
+	g.notifyLocked()
+}
+
+func (g *uploadGate) removeLocked(t *gateTicket) {
+	for i, q := range g.queue {
+		if q == t {
+			g.queue = append(g.queue[:i], g.queue[i+1:]...)
+			g.notifyLocked()
+			return
+		}
+	}
+}
+
+func (g *uploadGate) notifyLocked() {
+	for i, t := range g.queue {
+		select {
+		case <-t.position:
+		default:
+		}
+		t.position <- i + 1
+	}
+}
+
+// status 当前上传数与排队数
+func (g *uploadGate) status() (active, queued int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active, len(g.queue)
+}
+
+// queueUploads 超过 MAX_ACTIVE_UPLOADS 时排队等待，在读取请求体之前进行，排队的上传不占用临时目录。
+// 开启排队时先校验请求头、查询参数或 Cookie 中的访问密码（表单中的密码要读取请求体后才能校验），
+// 未登录的请求（允许匿名上传的实例除外）直接返回 401，不占用排队名额。
+// 排队位置通过 /api/events 的 upload_queued 事件推送，带上 upload_id 查询参数或 X-Upload-Id 请求头即可对应到具体上传；
+// 响应头 X-Upload-Queue-Position 为进入队列时的位置，没有排队时为 0
+func (p *profile) queueUploads(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.srv.uploads.max > 0 && !p.PublicUpload && !p.uploadAuthorized(r, "") {
+			writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "已开启上传排队，访问密码需要放在 X-Access-Pwd 请求头或 pwd 查询参数中")
+			return
+		}
+		id := r.URL.Query().Get("upload_id")
+		if id == "" {
+			id = r.Header.Get("X-Upload-Id")
+		}
+		queued := 0
+		err := p.srv.uploads.acquire(r.Context(), func(pos int) {
+			if queued == 0 {
+				queued = pos
+			}
+			p.events.publish(eventUploadQueued, map[string]any{"upload_id": id, "position": pos})
+		})
+		w.Header().Set("X-Upload-Queue-Position", strconv.Itoa(queued))
+		if errors.Is(err, errQueueFull) {
+			w.Header().Set("Retry-After", "30")
+			writeError(w, r, http.StatusServiceUnavailable, errCodeTooManyRequests, "上传队列已满，请稍后重试")
+			return
+		}
+		if err != nil {
+			return
+		}
+		defer p.srv.uploads.release()
+		next(w, r)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// isFileGone Telegram 对 getFile 返回 400 且提示 file_id 错误（wrong file_id、invalid file_id）时，
+// 说明文件所在消息已被手动删除或 file_id 无效，重试没有意义。其他 400（例如文件过大）不算失效
+func isFileGone(err error) bool {
+	var te *tgbotapi.Error
+	return errors.As(err, &te) && te.Code == http.StatusBadRequest && strings.Contains(strings.ToLower(te.Message), "file_id")
+}
+
+const (
+	// goneTTL 失效标记的有效期，过期后重新请求 Telegram 确认
+	goneTTL = 10 * time.Minute
+	// goneLimit 最多记录的失效标记数，超过时丢弃最早的，避免随机 file_id 的请求占满内存
+	goneLimit = 10000
+)
+
+type goneEntry struct {
+	key     string
+	expires time.Time
+}
+
+// goneFiles 已确认失效的 profile/file_id，有效期内的请求直接返回 410，不再请求 Telegram。
+// 按 profile 区分：file_id 只对上传它的 Bot 有效，其他 profile 查询失败不影响文件所有者
+var goneFiles = struct {
+	sync.Mutex
+	ll    *list.List // 按标记时间排列，最早的在前
+	items map[string]*list.Element
+}{ll: list.New(), items: make(map[string]*list.Element)}
+
+func (p *profile) markGone(fileID string) {
+	key := p.Name + "/" + fileID
+	now := time.Now()
+	goneFiles.Lock()
+	defer goneFiles.Unlock()
+	if el, ok := goneFiles.items[key]; ok {
+		goneFiles.ll.Remove(el)
+	}
+	goneFiles.items[key] = goneFiles.ll.PushBack(&goneEntry{key: key, expires: now.Add(goneTTL)})
+	for el := goneFiles.ll.Front(); el != nil; el = goneFiles.ll.Front() {
+		e := el.Value.(*goneEntry)
+		if goneFiles.ll.Len() <= goneLimit && now.Before(e.expires) {
+			break
+		}
+		goneFiles.ll.Remove(el)
+		delete(goneFiles.items, e.key)
+	}
+}
+
+func (p *profile) isMarkedGone(fileID string) bool {
+	key := p.Name + "/" + fileID
+	goneFiles.Lock()
+	defer goneFiles.Unlock()
+	el, ok := goneFiles.items[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(el.Value.(*goneEntry).expires) {
+		goneFiles.ll.Remove(el)
+		delete(goneFiles.items, key)
+		return false
+	}
+	return true
+}
+
+// writeGone 文件已失效时返回 410，而不是笼统的 500
+func (p *profile) writeGone(w http.ResponseWriter, r *http.Request, fileID string) {
+	p.markGone(fileID)
+	writeError(w, r, http.StatusGone, errCodeGone, "文件已在 Telegram 中删除或 file_id 无效")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// applyHardening 在读取配置后、创建任何文件之前执行：设置 umask，以 root 启动时切换到 runAs 用户，
+// 切换后仍为 root 且未允许时拒绝启动。Windows 上 Geteuid 返回 -1，不做检查
+func applyHardening(runAs string, allowRoot bool, umask string) error {
+	if umask != "" {
+		mask, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil || mask > 0777 {
+			return fmt.Errorf("UMASK 格式错误，应为八进制数（如 077）: %s", umask)
+		}
+		if err := setUmask(int(mask)); err != nil {
+			return err
+		}
+	}
+	if runAs != "" {
+		if os.Geteuid() != 0 {
+			// 已经是目标用户时（例如 systemd 配置了 User=）不需要切换
+			if u, err := user.Current(); err == nil && (u.Username == runAs || u.Uid == runAs) {
+				return nil
+			}
+			return fmt.Errorf("切换到用户 %s 需要以 root 启动", runAs)
+		}
+		if err := dropPrivileges(runAs); err != nil {
+			return err
+		}
+		log.Printf("已切换到用户 %s", runAs)
+	}
+	if os.Geteuid() == 0 && !allowRoot {
+		return fmt.Errorf("不建议以 root 运行，请通过 -user 指定运行用户，确需以 root 运行时加上 -allow-root")
+	}
+	return nil
+}
+
+// runSystemdUnit tg-disk systemd-unit：按当前可执行文件、工作目录与 -user、UMASK 配置输出 systemd 服务文件，
+// 工作目录下的 .env 与各存储文件照常读写，其余路径只读
+func runSystemdUnit(port, runAs, umask string) int {
+	unit, err := systemdUnit(port, runAs, umask)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(unit)
+	return 0
+}
+
+// serviceTarget 服务运行的可执行文件（已解析符号链接）与工作目录
+func serviceTarget() (exe, dir string, err error) {
+	exe, err = os.Executable()
+	if err != nil {
+		return "", "", fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	dir, err = os.Getwd()
+	if err != nil {
+		return "", "", fmt.Errorf("获取工作目录失败: %v", err)
+	}
+	return exe, dir, nil
+}
+
+func systemdUnit(port, runAs, umask string) (string, error) {
+	exe, dir, err := serviceTarget()
+	if err != nil {
+		return "", err
+	}
+	if runAs == "" {
+		if u, err := user.Current(); err == nil && u.Uid != "0" {
+			runAs = u.Username
+		}
+	}
+	if runAs == "" {
+		return "", fmt.Errorf("请通过 -user 指定服务的运行用户")
+	}
+	if umask == "" {
+		umask = "0077"
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\nDescription=tg-disk\nWants=network-online.target\nAfter=network-online.target\n\n")
+	b.WriteString("[Service]\nType=simple\n")
+	fmt.Fprintf(&b, "User=%s\n", runAs)
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", dir)
+	if port != "" {
+		fmt.Fprintf(&b, "ExecStart=%s -port %s\n", exe, port)
+	} else {
+		fmt.Fprintf(&b, "ExecStart=%s\n", exe)
+	}
+	b.WriteString("Restart=on-failure\nRestartSec=5\n")
+	fmt.Fprintf(&b, "UMask=%s\n", umask)
+	b.WriteString("NoNewPrivileges=yes\nPrivateTmp=yes\nPrivateDevices=yes\nProtectSystem=strict\nProtectHome=read-only\n")
+	b.WriteString("ProtectKernelTunables=yes\nProtectKernelModules=yes\nProtectControlGroups=yes\nRestrictSUIDSGID=yes\nLockPersonality=yes\n")
+	fmt.Fprintf(&b, "ReadWritePaths=%s\n", dir)
+	// 非 root 用户监听 1024 以下端口需要额外授予该能力
+	if n, err := strconv.Atoi(port); err == nil && n > 0 && n < 1024 {
+		b.WriteString("AmbientCapabilities=CAP_NET_BIND_SERVICE\nCapabilityBoundingSet=CAP_NET_BIND_SERVICE\n")
+	} else {
+		b.WriteString("CapabilityBoundingSet=\n")
+	}
+	b.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	return b.String(), nil
+}
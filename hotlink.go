@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// hotlinkToken 带上 hotlink_token=... 参数的链接可以在任何网站引用（HOTLINK_TOKEN）
+var hotlinkToken string
+
+// parseHotlinkHosts 解析 HOTLINK_ALLOWED_HOSTS，逗号分隔的域名列表，统一转为小写，
+// *.example.com 匹配 example.com 及其所有子域名
+func parseHotlinkHosts(s string) []string {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+func hotlinkHostAllowed(allowed []string, host string) bool {
+	for _, h := range allowed {
+		if suffix, ok := strings.CutPrefix(h, "*."); ok {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// refererHost 请求来源网站的域名，优先取 Origin，其次 Referer，都没有时返回空字符串
+func refererHost(r *http.Request) string {
+	for _, v := range []string{r.Header.Get("Origin"), r.Header.Get("Referer")} {
+		if v == "" || v == "null" {
+			continue
+		}
+		if u, err := url.Parse(v); err == nil && u.Host != "" {
+			return strings.ToLower(u.Hostname())
+		}
+	}
+	return ""
+}
+
+// guardHotlink 配置了 HOTLINK_ALLOWED_HOSTS 时拒绝来自其他网站的下载请求。
+// 没有 Origin、Referer 的请求（直接打开、下载工具）、本站页面、已登录的请求和带正确 hotlink_token 的请求不受限制
+func (p *profile) guardHotlink(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(p.srv.hotlinkAllowed) == 0 {
+			next(w, r)
+			return
+		}
+		host := refererHost(r)
+		if host == "" || host == requestHostname(r) || hotlinkHostAllowed(p.srv.hotlinkAllowed, host) || p.isAuthenticated(r) {
+			next(w, r)
+			return
+		}
+		if t := r.URL.Query().Get("hotlink_token"); hotlinkToken != "" && subtle.ConstantTimeCompare([]byte(t), []byte(hotlinkToken)) == 1 {
+			next(w, r)
+			return
+		}
+		reqLog(r, "拒绝外链下载: %s，来源 %s", r.URL.Path, host)
+		writeError(w, r, http.StatusForbidden, errCodeForbidden, "不允许在其他网站引用此下载链接")
+	}
+}
+
+// requestHostname 请求的 Host 去掉端口
+func requestHostname(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// FileInfo 单个文件的元信息，供 info 命令与 /api/files/{id} 使用
+type FileInfo struct {
+	FileID        string      `json:"file_id"`
+	Filename      string      `json:"filename"`
+	Size          int64       `json:"size"`
+	ChunkCount    int         `json:"chunk_count"`
+	SHA256        string      `json:"sha256,omitempty"`
+	UploadedAt    *time.Time  `json:"uploaded_at,omitempty"`
+	MimeType      string      `json:"mime_type"`
+	DownloadCount int64       `json:"download_count"`
+	DownloadURL   string      `json:"download_url,omitempty"`
+	MessageID     int         `json:"message_id,omitempty"`
+	MessageURL    string      `json:"message_url,omitempty"`
+	Source        *provenance `json:"source,omitempty"`
+	Storage       string      `json:"storage,omitempty"`
+	Media         *mediaInfo  `json:"media,omitempty"`       // 上传时提取的图片、视频元数据
+	ShareLinks    []ShareLink `json:"share_links,omitempty"` // 已生成的短链接与未过期的自定义分享链接，只返回给已登录的请求
+}
+
+// fileHashCacheSize 默认缓存的小文件 SHA-256 个数，file_id 对应的内容不会变化，缓存不需要过期
+const fileHashCacheSize = 10000
+
+// downloadCounter 记录自进程启动以来每个文件的下载次数
+type downloadCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+var downloads = &downloadCounter{counts: make(map[string]int64)}
+
+func (c *downloadCounter) Inc(fileID string) {
+	c.mu.Lock()
+	c.counts[fileID]++
+	c.mu.Unlock()
+}
+
+func (c *downloadCounter) Get(fileID string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[fileID]
+}
+
+// buildDownloadURL 生成下载链接，filename 为空或为 fileAll.txt 时表示分块大文件
+func buildDownloadURL(base, fileID, filename string) string {
+	base = strings.TrimRight(base, "/")
+	if filename == "" || filename == "fileAll.txt" {
+		return fmt.Sprintf("%s/d?file_id=%s", base, url.QueryEscape(fileID))
+	}
+	return fmt.Sprintf("%s/d?file_id=%s&filename=%s", base, url.QueryEscape(fileID), url.QueryEscape(filename))
+}
+
+// messageLink 生成 Telegram 消息跳转链接，私聊消息没有公开链接，返回空字符串
+func messageLink(chat *tgbotapi.Chat, messageID int) string {
+	if chat == nil || messageID == 0 {
+		return ""
+	}
+	if chat.UserName != "" && !chat.IsPrivate() {
+		return fmt.Sprintf("https://t.me/%s/%d", chat.UserName, messageID)
+	}
+	// 频道与超级群组的 ID 形如 -100xxxxxxxxxx，链接中使用去掉 -100 前缀的部分
+	if id := strconv.FormatInt(chat.ID, 10); strings.HasPrefix(id, "-100") {
+		return fmt.Sprintf("https://t.me/c/%s/%d", strings.TrimPrefix(id, "-100"), messageID)
+	}
+	return ""
+}
+
+// requestBase 根据当前请求推断服务的外部访问地址
+func (p *profile) requestBase(r *http.Request) string {
+	return fmt.Sprintf("%s://%s%s", getScheme(r), r.Host, p.PathPrefix)
+}
+
+// fileInfo 查询文件信息，ctx 取消时停止请求 Telegram。filename 为空或为 fileAll.txt 时按分块清单解析；
+// 清单中记录了 SHA-256 时直接返回，旧清单需要下载全部分块计算，仅在 withHash 为 true 时计算。
+// 小文件的 SHA-256 同样只在 withHash 为 true 时下载计算，结果按 profile/file_id 缓存
+func (p *profile) fileInfo(ctx context.Context, fileID, filename string, withHash bool) (*FileInfo, error) {
+	bot := withContext(ctx, p.bot)
+	info := &FileInfo{FileID: fileID, DownloadCount: downloads.Get(fileID)}
+	if e, ok := p.srv.mediaIndex.get(p.Name, fileID); ok {
+		info.Media = &e.mediaInfo
+	}
+
+	if filename != "" && filename != "fileAll.txt" {
+		tgFile, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+		if err != nil {
+			return nil, fmt.Errorf("获取文件失败: %w", err)
+		}
+		info.Filename = filename
+		info.Size = int64(tgFile.FileSize)
+		info.ChunkCount = 1
+		info.MimeType = p.srv.mimeTypes.contentTypeFor(filename)
+
+		key := p.Name + "/" + fileID
+		if sum, ok := p.srv.hashes.Get(key); ok {
+			info.SHA256 = string(sum)
+			return info, nil
+		}
+		if !withHash {
+			return info, nil
+		}
+		resp, err := telegramGet(bot, tgFile.Link(bot.Token), nil)
+		if err != nil {
+			return nil, fmt.Errorf("下载失败: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("下载返回状态异常: %d", resp.StatusCode)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, resp.Body); err != nil {
+			return nil, fmt.Errorf("计算 SHA-256 失败: %v", err)
+		}
+		info.SHA256 = hex.EncodeToString(h.Sum(nil))
+		p.srv.hashes.Put(key, []byte(info.SHA256))
+		return info, nil
+	}
+
+	m, err := readManifest(bot, fileID)
+	if err != nil {
+		return nil, err
+	}
+	size, err := chunkedSize(bot, m)
+	if err != nil {
+		return nil, err
+	}
+	info.Filename = m.Filename
+	info.Size = size
+	info.ChunkCount = len(m.Chunks)
+	info.MimeType = p.srv.mimeTypes.contentTypeFor(m.Filename)
+	info.SHA256 = m.SHA256
+	info.Source = m.Source
+	info.Storage = m.Storage
+	if !m.UploadedAt.IsZero() {
+		info.UploadedAt = &m.UploadedAt
+	}
+
+	if withHash && info.SHA256 == "" {
+		h := sha256.New()
+		for _, fid := range m.Chunks {
+			data, err := p.fetchChunk(bot, fid, m.Codec)
+			if err != nil {
+				return nil, err
+			}
+			h.Write(data)
+		}
+		info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return info, nil
+}
+
+// handleFileInfo GET /api/files/{id}，小文件需带 filename 参数；没有缓存的哈希时，大文件需带 sha256=1 才计算，
+// 小文件在已登录或带 sha256=1 时计算。已登录的请求同时返回该文件的短链接与分享链接；
+// /api/files/{id}/manifest、/api/files/{id}/checksum、/api/files/{id}/sidecars 分别交给 handleManifestInfo、handleChecksum、handleSidecars，
+// /api/files/{id}/preview、/api/files/{id}/auth 为单个文件的预览与下载鉴权设置
+func (p *profile) handleFileInfo(w http.ResponseWriter, r *http.Request) {
+	fileID := strings.TrimPrefix(r.URL.Path, "/api/files/")
+	if id, rest, ok := strings.Cut(fileID, "/sidecars"); ok && id != "" && !strings.Contains(id, "/") &&
+		(rest == "" || (strings.HasPrefix(rest, "/") && !strings.Contains(rest[1:], "/"))) {
+		p.handleSidecars(w, r, id, strings.TrimPrefix(rest, "/"))
+		return
+	}
+	if id, ok := strings.CutSuffix(fileID, "/comments"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handleComments(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(fileID, "/preview"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handlePreviewSetting(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(fileID, "/auth"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handleDownloadAuthSetting(w, r, id)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET", nil)
+		return
+	}
+	if id, ok := strings.CutSuffix(fileID, "/manifest"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handleManifestInfo(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(fileID, "/metalink"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handleMetalink(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(fileID, "/checksum"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handleChecksum(w, r, id)
+		return
+	}
+	if fileID == "" || strings.Contains(fileID, "/") {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "文件不存在", nil)
+		return
+	}
+	// 返回的下载链接带有令牌，因此查询信息与下载使用相同的权限校验
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	filename := r.URL.Query().Get("filename")
+	small := filename != "" && filename != "fileAll.txt"
+	authenticated := p.isAuthenticated(r)
+
+	info, err := p.fileInfo(r.Context(), fileID, filename, r.URL.Query().Get("sha256") == "1" || (small && authenticated))
+	if err != nil {
+		p.writeInfoError(w, r, fileID, err)
+		return
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = p.requestBase(r)
+	}
+	if small {
+		info.DownloadURL = p.downloadURL(base, fileID, filename)
+	} else {
+		info.DownloadURL = p.chunkedDownloadURL(base, fileID, info.Filename)
+	}
+	if authenticated {
+		info.ShareLinks = p.shareLinks(base, fileID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// writeInfoError 读取文件信息失败时按错误类型返回 400、410 或 502
+func (p *profile) writeInfoError(w http.ResponseWriter, r *http.Request, fileID string, err error) {
+	switch {
+	case errors.Is(err, errBadManifest):
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadManifest, err.Error(), nil)
+	case isFileGone(err):
+		p.writeGone(w, r, fileID)
+	default:
+		writeAPIError(w, r, http.StatusBadGateway, errCodeTelegram, err.Error(), nil)
+	}
+}
+
+// ChunkInfo 清单中单个分块的信息，download_url 返回解码后的分块内容
+type ChunkInfo struct {
+	Index       int    `json:"index"`
+	FileID      string `json:"file_id"`
+	Offset      int64  `json:"offset"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	DownloadURL string `json:"download_url"`
+}
+
+// ManifestInfo GET /api/files/{id}/manifest 的返回结果
+type ManifestInfo struct {
+	FileID   string      `json:"file_id"`
+	Filename string      `json:"filename"`
+	Size     int64       `json:"size"`
+	SHA256   string      `json:"sha256,omitempty"`
+	Codec    string      `json:"codec,omitempty"`
+	Source   *provenance `json:"source,omitempty"`
+	Chunks   []ChunkInfo `json:"chunks"`
+}
+
+// handleManifestInfo 返回分块列表，外部下载工具可以并发拉取各个分块后在本地按 offset 拼接；
+// 旧清单没有记录分块大小时 offset、size 按 chunkSize 推算，没有记录分块哈希时 sha256 为空
+func (p *profile) handleManifestInfo(w http.ResponseWriter, r *http.Request, fileID string) {
+	bot := p.botFor(r)
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	m, err := readManifest(bot, fileID)
+	if err != nil {
+		p.writeInfoError(w, r, fileID, err)
+		return
+	}
+	size, err := chunkedSize(bot, m)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadGateway, errCodeTelegram, err.Error(), nil)
+		return
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = p.requestBase(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.manifestInfo(base, fileID, m, size))
+}
+
+// manifestInfo 由清单生成分块列表，各分块的下载链接以 base 开头
+func (p *profile) manifestInfo(base, fileID string, m *manifest, size int64) ManifestInfo {
+	info := ManifestInfo{FileID: fileID, Filename: m.Filename, Size: size, SHA256: m.SHA256, Codec: m.Codec, Source: m.Source}
+	offsets := chunkOffsets(m, size)
+	for i, fid := range m.Chunks {
+		c := ChunkInfo{
+			Index:       i,
+			FileID:      fid,
+			Offset:      offsets[i],
+			Size:        offsets[i+1] - offsets[i],
+			DownloadURL: p.chunkURL(base, fid, m.Codec),
+		}
+		if m.ChunkHashes != nil {
+			c.SHA256 = m.ChunkHashes[i]
+		}
+		info.Chunks = append(info.Chunks, c)
+	}
+	return info
+}
+
+// formatFileInfo 生成 info 命令回复的文本
+func formatFileInfo(info *FileInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "文件 [%s] 信息：\n", info.Filename)
+	fmt.Fprintf(&b, "大小：%s（%d 字节）\n", formatSize(info.Size), info.Size)
+	fmt.Fprintf(&b, "分块数：%d\n", info.ChunkCount)
+	fmt.Fprintf(&b, "类型：%s\n", info.MimeType)
+	if info.SHA256 != "" {
+		fmt.Fprintf(&b, "SHA-256：%s\n", info.SHA256)
+	}
+	if info.UploadedAt != nil {
+		fmt.Fprintf(&b, "上传时间：%s\n", info.UploadedAt.Format("2006-01-02 15:04:05"))
+	}
+	if info.Source != nil {
+		fmt.Fprintf(&b, "来源：%s\n", info.Source.String())
+	}
+	if info.Storage != "" {
+		fmt.Fprintf(&b, "存储会话：%s\n", info.Storage)
+	}
+	if m := info.Media; m != nil {
+		if m.Width > 0 {
+			fmt.Fprintf(&b, "尺寸：%d×%d\n", m.Width, m.Height)
+		}
+		if m.Duration > 0 {
+			fmt.Fprintf(&b, "时长：%s\n", (time.Duration(m.Duration) * time.Second).String())
+		}
+		if m.TakenAt != "" {
+			fmt.Fprintf(&b, "拍摄时间：%s\n", strings.Replace(m.TakenAt, "T", " ", 1))
+		}
+	}
+	fmt.Fprintf(&b, "下载次数：%d\n", info.DownloadCount)
+	if info.MessageURL != "" {
+		fmt.Fprintf(&b, "消息链接：%s\n", info.MessageURL)
+	}
+	for _, l := range info.ShareLinks {
+		if l.ExpiresAt != nil {
+			fmt.Fprintf(&b, "分享链接：%s（%s 前有效）\n", l.URL, l.ExpiresAt.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Fprintf(&b, "短链接：%s\n", l.URL)
+		}
+	}
+	if info.DownloadURL != "" {
+		fmt.Fprintf(&b, "下载链接：\n%s", info.DownloadURL)
+	}
+	return b.String()
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobLogMaxEntries 单个任务最多保留的日志条数
+const jobLogMaxEntries = 1000
+
+// jobEntry 上传任务的一条日志，chunk 为分块序号，与具体分块无关时省略
+type jobEntry struct {
+	Time       time.Time `json:"time"`
+	Level      string    `json:"level"` // info 或 error
+	Chunk      *int      `json:"chunk,omitempty"`
+	Message    string    `json:"message"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+}
+
+// jobLog 一次分块上传的日志，任务 ID 即 upload_id，上传响应的 X-Upload-Id 头中返回
+type jobLog struct {
+	mu       sync.Mutex
+	ID       string     `json:"id"`
+	Filename string     `json:"filename"`
+	Status   string     `json:"status"` // running、done、failed
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Entries  []jobEntry `json:"entries"`
+}
+
+func (j *jobLog) add(level string, chunk int, d time.Duration, format string, args ...any) {
+	if j == nil {
+		return
+	}
+	e := jobEntry{Time: time.Now(), Level: level, Message: fmt.Sprintf(format, args...), DurationMS: d.Milliseconds()}
+	if chunk >= 0 {
+		e.Chunk = &chunk
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.Entries) < jobLogMaxEntries {
+		j.Entries = append(j.Entries, e)
+	}
+}
+
+// chunk 记录分块的发送结果
+func (j *jobLog) chunk(index int, d time.Duration, err error) {
+	if err != nil {
+		j.add("error", index, d, "发送失败: %v", err)
+		return
+	}
+	j.add("info", index, d, "已发送")
+}
+
+func (j *jobLog) finish(err error) {
+	if j == nil {
+		return
+	}
+	now := time.Now()
+	status := "done"
+	if err != nil {
+		j.add("error", -1, 0, "上传失败: %v", err)
+		status = "failed"
+	} else {
+		j.add("info", -1, now.Sub(j.Started), "上传完成")
+	}
+	j.mu.Lock()
+	j.Status, j.Finished = status, &now
+	j.mu.Unlock()
+}
+
+// jobStore 在内存中保留最近的任务日志，超过上限时丢弃最早的任务
+type jobStore struct {
+	mu    sync.Mutex
+	max   int
+	order []string
+	jobs  map[string]*jobLog
+}
+
+func newJobStore(max int) *jobStore {
+	return &jobStore{max: max, jobs: make(map[string]*jobLog)}
+}
+
+// start 开始记录任务，同一 upload_id 续传时继续追加到原来的日志，每次提交记下请求 ID
+func (s *jobStore) start(profile, id, filename, requestID string) *jobLog {
+	if s.max <= 0 {
+		return nil
+	}
+	key := profile + "/" + id
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[key]; ok {
+		j.mu.Lock()
+		j.Status, j.Finished = "running", nil
+		j.mu.Unlock()
+		j.add("info", -1, 0, "重新提交，请求 ID %s", requestID)
+		return j
+	}
+	j := &jobLog{ID: id, Filename: filename, Status: "running", Started: time.Now()}
+	j.add("info", -1, 0, "开始上传 %s，请求 ID %s", filename, requestID)
+	s.jobs[key] = j
+	s.order = append(s.order, key)
+	for len(s.order) > s.max {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return j
+}
+
+func (s *jobStore) get(profile, id string) *jobLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[profile+"/"+id]
+}
+
+// handleJobLog GET /api/jobs/{id}/log，返回上传任务的日志，带 format=text 时返回纯文本，需要登录
+func (p *profile) handleJobLog(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/log")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "任务不存在", nil)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET", nil)
+		return
+	}
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	j := p.srv.jobs.get(p.Name, id)
+	if j == nil {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "任务不存在或日志已过期", nil)
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if r.URL.Query().Get("format") != "text" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="upload-%s.log"`, id))
+	fmt.Fprintf(w, "任务 %s：%s（%s）\n", j.ID, j.Filename, j.Status)
+	for _, e := range j.Entries {
+		line := e.Time.Format("2006-01-02 15:04:05.000") + " " + strings.ToUpper(e.Level)
+		if e.Chunk != nil {
+			line += fmt.Sprintf(" 分块 %d", *e.Chunk)
+		}
+		line += " " + e.Message
+		if e.DurationMS > 0 {
+			line += fmt.Sprintf("（%d ms）", e.DurationMS)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// linkBase 机器人回复链接时使用的服务地址：依次取 /setbase 设置的地址、BASE_URL、最近一次登录后访问网页时的地址，
+// 都没有时返回空字符串
+func (p *profile) linkBase() string {
+	if v := p.runtimeBase.Load(); v != nil {
+		return *v
+	}
+	if p.BaseURL != "" {
+		return p.BaseURL
+	}
+	if v := p.seenBase.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+// linkBaseSource linkBase 的来源，供 /setbase、/status 展示
+func (p *profile) linkBaseSource() string {
+	switch {
+	case p.runtimeBase.Load() != nil:
+		return "/setbase"
+	case p.BaseURL != "":
+		return "BASE_URL"
+	case p.seenBase.Load() != nil:
+		return "网页访问"
+	}
+	return ""
+}
+
+// rememberBase 未配置 BASE_URL 时记下已登录请求的外部访问地址。
+// 只记录带访问密码或登录 Cookie 的请求，避免他人伪造 Host 头让机器人回复错误的链接
+func (p *profile) rememberBase(next http.Handler) http.Handler {
+	if p.BaseURL != "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "" && p.isAuthenticated(r) {
+			if base := p.requestBase(r); p.seenBase.Load() == nil || *p.seenBase.Load() != base {
+				p.seenBase.Store(&base)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setRuntimeBase 处理 /setbase 命令，地址需以 http:// 或 https:// 开头，off 表示清除
+func (p *profile) setRuntimeBase(value string) string {
+	if value == "off" {
+		p.runtimeBase.Store(nil)
+		if base := p.linkBase(); base != "" {
+			return "已清除，当前链接地址：" + base + "（" + p.linkBaseSource() + "）"
+		}
+		return "已清除，当前没有可用的链接地址"
+	}
+	if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return "地址应以 http:// 或 https:// 开头"
+	}
+	base := strings.TrimRight(value, "/")
+	p.runtimeBase.Store(&base)
+	return "链接地址已设置为 " + base + "，重启后恢复为 BASE_URL"
+}
+
+// baseURLMissing 没有可用的链接地址时机器人回复的提示
+const baseURLMissing = "未配置 BASE_URL，也没有登录后访问过网页，无法生成完整URL链接，可发送 /setbase https://你的域名 设置"
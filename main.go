@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -18,7 +22,9 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"tg-disk/pkg/transfer"
+	"time"
 )
 
 //go:embed static/*
@@ -37,14 +43,31 @@ func (s staticFS) Open(name string) (http.File, error) {
 	return s.fs.Open(name)
 }
 
-var (
-	bot           *tgbotapi.BotAPI
-	chatID        int64
-	accessPwd     string
-	threadNumbers = 4 // 由于 TG API 限制最大并发数，所以线程数设置为4
-)
+var threadNumbers = 4 // 由于 TG API 限制最大并发数，所以线程数设置为4
+
+const chunkSize = 20 * 1024 * 1024 // Telegram Bot API 下载文件上限为 20MB
 
 func main() {
+	// tg-disk check 只验证配置，bundle / restore 导出、导入备份包，systemd-unit 输出服务文件，
+	// service install|uninstall|start|stop 管理开机运行的服务，top 显示运行中服务的状态，都不启动服务
+	command, serviceAction := "", ""
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check", "bundle", "restore", "systemd-unit", "top":
+			command = os.Args[1]
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "service":
+			command = os.Args[1]
+			if len(os.Args) > 2 {
+				serviceAction = os.Args[2]
+				os.Args = append(os.Args[:1], os.Args[3:]...)
+			} else {
+				os.Args = os.Args[:1]
+			}
+		}
+	}
+	checkMode := command != ""
+
 	// 定义命令行参数（默认值为空）
 	portFlag := flag.String("port", "", "服务端口")
 	botTokenFlag := flag.String("bot_token", "", "Telegram Bot Token")
@@ -52,8 +75,29 @@ func main() {
 	proxyFlag := flag.String("proxy", "", "HTTP 代理地址")
 	chatIDFlag := flag.String("chat_id", "", "Telegram Chat ID")
 	baseURLFlag := flag.String("base_url", "", "服务的基础 URL，例如 https://yourdomain.com")
+	debugFlag := flag.Bool("debug", false, "开启 /debug/pprof 与 /debug/vars 调试接口，需要同时配置 admin_token")
+	adminTokenFlag := flag.String("admin_token", "", "管理员令牌")
+	profilesFlag := flag.String("profiles", "", "多租户配置文件路径（JSON），每个 profile 拥有独立的 Bot、Chat 和密码")
+	userFlag := flag.String("user", "", "以 root 启动时切换到的运行用户")
+	allowRootFlag := flag.Bool("allow-root", false, "允许以 root 运行")
+	workdirFlag := flag.String("workdir", "", "工作目录，.env 与各存储文件相对该目录读写")
+	logFlag := flag.String("log", "", "日志追加写入的文件，默认输出到标准错误")
+	urlFlag := flag.String("url", "", "tg-disk top 连接的服务地址，默认 http://127.0.0.1:端口")
 	flag.Parse()
 
+	if *workdirFlag != "" {
+		if err := os.Chdir(*workdirFlag); err != nil {
+			log.Fatal("切换工作目录失败:", err)
+		}
+	}
+	if *logFlag != "" {
+		f, err := os.OpenFile(*logFlag, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			log.Fatal("打开日志文件失败:", err)
+		}
+		log.SetOutput(f)
+	}
+
 	envLoaded := false
 
 	// 尝试加载 .env 文件
@@ -91,159 +135,695 @@ func main() {
 	overrideEnv("PROXY", *proxyFlag)
 	overrideEnv("CHAT_ID", *chatIDFlag)
 	overrideEnv("BASE_URL", *baseURLFlag)
+	overrideEnv("PROFILES_FILE", *profilesFlag)
+	overrideEnv("ADMIN_TOKEN", *adminTokenFlag)
+	overrideEnv("RUN_AS_USER", *userFlag)
+	if *debugFlag {
+		overrideEnv("DEBUG", "true")
+	}
+	if *allowRootFlag {
+		overrideEnv("ALLOW_ROOT", "true")
+	}
+
+	if command == "systemd-unit" {
+		os.Exit(runSystemdUnit(os.Getenv("PORT"), os.Getenv("RUN_AS_USER"), os.Getenv("UMASK")))
+	}
+	if command == "top" {
+		base := *urlFlag
+		if base == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			base = "http://127.0.0.1:" + port
+		}
+		os.Exit(runTop(base, os.Getenv("ADMIN_TOKEN"), os.Getenv("BASIC_AUTH_USER"), os.Getenv("BASIC_AUTH_PASS")))
+	}
+	if command == "service" {
+		os.Exit(runService(serviceAction, os.Getenv("PORT"), os.Getenv("RUN_AS_USER"), os.Getenv("UMASK")))
+	}
+	// 创建任何文件之前设置 umask 并放弃 root 权限
+	if err := applyHardening(os.Getenv("RUN_AS_USER"), os.Getenv("ALLOW_ROOT") == "true", os.Getenv("UMASK")); err != nil {
+		log.Fatal(err)
+	}
 
 	// 读取最终环境变量
 	port := os.Getenv("PORT")
 	botToken := os.Getenv("BOT_TOKEN")
-	accessPwd = os.Getenv("ACCESS_PWD")
+	accessPwd := os.Getenv("ACCESS_PWD")
 	proxyStr := os.Getenv("PROXY")
 	chatIDStr := os.Getenv("CHAT_ID")
 	baseURL := os.Getenv("BASE_URL")
-
-	// 检查必填
-	if port == "" && !envLoaded {
-		log.Fatal("未找到 .env 文件，必须通过 -port 指定服务端口")
+	profilesFile := os.Getenv("PROFILES_FILE")
+	tokenSecret := os.Getenv("DOWNLOAD_TOKEN_SECRET")
+	downloadAuth := os.Getenv("DOWNLOAD_AUTH") == "true"
+	publicUpload := os.Getenv("PUBLIC_UPLOAD") == "true"
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	debug := os.Getenv("DEBUG") == "true"
+
+	opts := serverOptions{
+		adminToken: adminToken,
+		// 分块缓存数量，默认缓存最近 4 个分块，设置为 0 关闭
+		cache:           newChunkCache(envInt("CHUNK_CACHE_SIZE", 4)),
+		jobs:            newJobStore(envInt("JOB_LOG_LIMIT", 100)),
+		uploads:         newUploadGate(envInt("MAX_ACTIVE_UPLOADS", 0), envInt("UPLOAD_QUEUE_SIZE", 100)),
+		buffers:         newMemoryBudget(envSize("MAX_BUFFER_MEMORY", 0)),
+		breaker:         newCircuitBreaker(envInt("TELEGRAM_BREAKER_THRESHOLD", 5), envDuration("TELEGRAM_BREAKER_COOLDOWN", 30*time.Second)),
+		mimeTypes:       newMimeTypes(),
+		telegramTimeout: envDuration("TELEGRAM_TIMEOUT", 0),
+		chunkRetries:    envInt("CHUNK_RETRIES", 3),
+		callbackSecret:  os.Getenv("CALLBACK_SECRET"),
+		cdnMode:         os.Getenv("CDN_MODE") == "true",
+		hotlinkAllowed:  parseHotlinkHosts(os.Getenv("HOTLINK_ALLOWED_HOSTS")),
 	}
-	if botToken == "" || accessPwd == "" || chatIDStr == "" {
-		log.Fatal("缺少必要配置，请通过 .env 或命令行设置 bot_token、access_pwd、chat_id")
+	uploadCompression = os.Getenv("UPLOAD_COMPRESSION") != "off"
+	blockedArchiveExts = parseBlockedExts(os.Getenv("ARCHIVE_BLOCKED_EXTS"))
+	if v := os.Getenv("ARCHIVE_POLICY"); v != "" {
+		archivePolicy = v
+	}
+	if err := opts.mimeTypes.parseMimeOverrides(os.Getenv("MIME_TYPES")); err != nil {
+		log.Fatal(err)
+	}
+	if v, ok := os.LookupEnv("PREVIEWABLE_TYPES"); ok {
+		opts.mimeTypes.parsePreviewableTypes(v)
+	}
+	opts.mimeTypes.forceDownload = os.Getenv("FORCE_DOWNLOAD") == "true"
+	switch v := os.Getenv("ACTIVE_CONTENT_POLICY"); v {
+	case "":
+	case "attachment", "sandbox", "inline":
+		activeContentPolicy = v
+	default:
+		log.Fatalf("ACTIVE_CONTENT_POLICY 只能为 attachment、sandbox 或 inline: %s", v)
+	}
+	verifyUploads = os.Getenv("VERIFY_UPLOADS") == "true"
+	autoTuneChunks = os.Getenv("CHUNK_SIZE_AUTO") == "true"
+	photoPreview = os.Getenv("PHOTO_PREVIEW") == "on"
+	previewCommand = strings.Fields(os.Getenv("PREVIEW_COMMAND"))
+	if v, ok := os.LookupEnv("NOTIFY_CHANNELS"); ok {
+		list, err := newNotifiers(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifiers = list
+	}
+	// 低优先级上传限速，突发允许一个分块大小
+	backgroundBandwidth = newTokenBucket(float64(envSize("BACKGROUND_UPLOAD_RATE", 0)), chunkSize)
+	backgroundChunkRate = newTokenBucket(float64(envInt("BACKGROUND_CHUNKS_PER_MINUTE", 0))/60, 1)
+	if v := os.Getenv("UPLOAD_WAL_DIR"); v != "" {
+		walDir = v
 	}
 
 	var err error
-	chatID, err = strconv.ParseInt(chatIDStr, 10, 64)
+	opts.scanner, err = newVirusScanner(os.Getenv("AV_CLAMD"), os.Getenv("AV_COMMAND"))
 	if err != nil {
-		log.Fatal("CHAT_ID 格式错误，应为数字:", err)
+		log.Fatal(err)
 	}
 
+	trustedProxies, err = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	uploadLimiter = newIPLimiter(envInt("MAX_UPLOADS_PER_IP", 0))
+	downloadLimiter = newIPLimiter(envInt("MAX_DOWNLOADS_PER_IP", 0))
+
+	// 清理异常退出后残留的临时上传目录
+	tempMaxAge = envDuration("TEMP_MAX_AGE", tempMaxAge)
+	if !checkMode {
+		go runTempGC(tempMaxAge, envDuration("TEMP_GC_INTERVAL", time.Hour))
+	}
+
+	// 只用于默认 profile，多租户配置中的 profile 通过 admin_user_ids、allowed_user_ids 单独配置
+	adminUserIDs, err := parseUserIDs("ADMIN_USER_IDS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	startupMessage = strings.ReplaceAll(os.Getenv("STARTUP_MESSAGE"), `\n`, "\n")
+	if v := os.Getenv("STARTUP_CHAT_ID"); v != "" {
+		if startupChatID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			log.Fatal("STARTUP_CHAT_ID 格式错误，应为数字:", err)
+		}
+	}
+	telegramLogin = os.Getenv("TELEGRAM_LOGIN") == "true"
+	allowedUserIDs, err := parseUserIDs("ALLOWED_USER_IDS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 每日上传额度，可通过 /set-quota 命令在运行时调整
+	opts.quotaLimit = envSize("UPLOAD_QUOTA", 0)
+	// 以维护模式启动，例如迁移期间需要重启时，可通过 /maintenance off 或管理接口关闭
+	if os.Getenv("MAINTENANCE_MODE") == "true" {
+		setMaintenance(true, os.Getenv("MAINTENANCE_MESSAGE"))
+		log.Println("已开启维护模式，只能下载")
+	}
+
+	// 检查必填
+	if port == "" && !envLoaded {
+		log.Fatal("未找到 .env 文件，必须通过 -port 指定服务端口")
+	}
+
+	var client *http.Client
 	if proxyStr != "" {
 		proxyURL, err := url.Parse(proxyStr)
 		if err != nil {
 			log.Fatal("代理地址格式错误:", err)
 		}
 
-		client := &http.Client{
+		client = &http.Client{
 			Transport: &http.Transport{
 				Proxy: http.ProxyURL(proxyURL),
 			},
 		}
-		bot, err = tgbotapi.NewBotAPIWithClient(botToken, tgbotapi.APIEndpoint, client)
-		if err != nil {
-			log.Fatal("初始化 Bot 失败:", err)
-		}
 		http.DefaultTransport = &http.Transport{
 			Proxy: http.ProxyURL(proxyURL),
 		}
-	} else {
-		bot, err = tgbotapi.NewBotAPI(botToken)
+	}
+
+	// 镜像模式只转发请求并缓存分块，不需要 Bot 配置
+	if origin := os.Getenv("MIRROR_ORIGIN"); origin != "" && !checkMode {
+		m, err := newMirror(origin, os.Getenv("MIRROR_TOKEN"), client, opts.cache, opts.mimeTypes)
 		if err != nil {
-			log.Fatal("初始化 Bot 失败:", err)
+			log.Fatal(err)
+		}
+		if port == "" {
+			port = "8080"
 		}
+		log.Printf("镜像模式，源站 %s -> http://127.0.0.1:%s", origin, port)
+		log.Fatal(http.ListenAndServe(":"+port, withRequestID(withCompression(m))))
 	}
 
-	go func() {
-		_, _ = bot.Send(tgbotapi.NewMessage(chatID, "🤖tg-disk服务启动成功🎉🎉\n\n"+
-			"指定文件回复get获取URL链接\n源码地址：https://github.com/Yohann0617/tg-disk"))
-
-		u := tgbotapi.NewUpdate(0)
-		u.Timeout = 60
-		updates := bot.GetUpdatesChan(u)
+	var profiles []*profile
+	if profilesFile != "" {
+		var err error
+		profiles, err = loadProfiles(profilesFile, &profile{DownloadTokenSecret: tokenSecret, DownloadAuth: downloadAuth, PublicUpload: publicUpload})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// 未使用多租户配置，或同时配置了单实例参数时，作为挂载在根路径的默认 profile
+	if profilesFile == "" || botToken != "" || chatIDStr != "" {
+		// 未配置 CHAT_ID 时使用之前的配对结果，没有配对结果则进入配对模式
+		pairPath := os.Getenv("PAIRING_FILE")
+		if pairPath == "" {
+			pairPath = "pairing.json"
+		}
+		var paired *pairingState
+		if chatIDStr == "" && botToken != "" {
+			if paired, err = loadPairing(pairPath); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if botToken == "" || accessPwd == "" || (chatIDStr == "" && paired == nil && checkMode) {
+			log.Fatal("缺少必要配置，请通过 .env 或命令行设置 bot_token、access_pwd、chat_id")
+		}
+		def := &profile{
+			Name:      "default",
+			BotToken:  botToken,
+			AccessPwd: accessPwd,
+			BaseURL:   baseURL,
+
+			DownloadTokenSecret: tokenSecret,
+			DownloadAuth:        downloadAuth,
+			PublicUpload:        publicUpload,
+			AdminUserIDs:        adminUserIDs,
+			AllowedUserIDs:      allowedUserIDs,
+		}
+		if def.StorageChats, err = parseStorageChats(os.Getenv("STORAGE_CHATS")); err != nil {
+			log.Fatal(err)
+		}
+		switch {
+		case chatIDStr != "":
+			if def.ChatID, err = strconv.ParseInt(chatIDStr, 10, 64); err != nil {
+				log.Fatal("CHAT_ID 格式错误，应为数字:", err)
+			}
+		case paired != nil:
+			def.ChatID, def.pairedUserID = paired.ChatID, paired.UserID
+			log.Printf("使用配对结果 %s: chat_id=%d", pairPath, paired.ChatID)
+		default:
+			def.pairCode, def.pairPath = newPairingCode(), pairPath
+		}
+		profiles = append(profiles, def)
+	}
 
-		for update := range updates {
-			if update.Message == nil || update.Message.ReplyToMessage == nil {
-				continue
+	for _, p := range profiles {
+		if p.PublicUpload && opts.moderation == nil {
+			path := os.Getenv("MODERATION_FILE")
+			if path == "" {
+				path = "moderation.json"
 			}
-			if update.Message.From.ID != chatID {
-				_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, "您无权限使用此机器人"))
-				continue
+			if opts.moderation, err = loadModerationQueue(path); err != nil {
+				log.Fatal(err)
 			}
+		}
+	}
 
-			// 只处理私聊
-			msgText := strings.TrimSpace(update.Message.Text)
-			if update.Message.Chat.IsPrivate() && (msgText == "get" || msgText == "/get") {
-				if baseURL == "" {
-					msg := tgbotapi.NewMessage(update.Message.From.ID, "未配置 BASE_URL 参数，无法获取完整URL链接")
-					_, _ = bot.Send(msg)
-					continue
-				}
+	switch style := os.Getenv("LINK_STYLE"); style {
+	case "", "path":
+	case "query":
+		queryLinks = true
+	default:
+		log.Fatalf("LINK_STYLE 只能为 path 或 query: %s", style)
+	}
+	downloadCacheControl = os.Getenv("DOWNLOAD_CACHE_CONTROL")
+	hotlinkToken = os.Getenv("HOTLINK_TOKEN")
 
-				var msg *tgbotapi.Message
-				if update.Message != nil {
-					msg = update.Message
-				}
+	if os.Getenv("SHORT_LINKS") == "true" {
+		path := os.Getenv("SHORT_LINKS_FILE")
+		if path == "" {
+			path = "short_links.json"
+		}
+		if opts.slugs, err = loadSlugStore(path); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-				var fileID, fileName string
-				replyToMessage := msg.ReplyToMessage
-
-				switch {
-				case replyToMessage.Document != nil && replyToMessage.Document.FileID != "":
-					fileID = replyToMessage.Document.FileID
-					fileName = replyToMessage.Document.FileName
-				case replyToMessage.Video != nil && replyToMessage.Video.FileID != "":
-					fileID = replyToMessage.Video.FileID
-					fileName = replyToMessage.Video.FileName
-				case replyToMessage.Audio != nil && replyToMessage.Audio.FileID != "":
-					fileID = replyToMessage.Audio.FileID
-					fileName = replyToMessage.Audio.FileName
-				case replyToMessage.Animation != nil && replyToMessage.Animation.FileID != "":
-					fileID = replyToMessage.Animation.FileID
-					fileName = replyToMessage.Animation.FileName
-				case replyToMessage.Sticker != nil && replyToMessage.Sticker.FileID != "":
-					fileID = replyToMessage.Sticker.FileID
-					fileName = replyToMessage.Sticker.Emoji
-				}
+	sharePath := os.Getenv("SHARE_LINKS_FILE")
+	if sharePath == "" {
+		sharePath = "share_links.json"
+	}
+	if opts.shareSlugs, err = loadSlugStore(sharePath); err != nil {
+		log.Fatal(err)
+	}
 
-				var downloadURL string
-				if fileName == "fileAll.txt" {
-					downloadURL = fmt.Sprintf("%s/d?file_id=%s", strings.TrimRight(baseURL, "/"), fileID)
-				} else {
-					downloadURL = fmt.Sprintf("%s/d?file_id=%s&filename=%s",
-						strings.TrimRight(baseURL, "/"), fileID, url.QueryEscape(fileName))
-				}
+	announcementPath := os.Getenv("ANNOUNCEMENT_FILE")
+	if announcementPath == "" {
+		announcementPath = "announcement.json"
+	}
+	if opts.announcements, err = loadAnnouncements(announcementPath); err != nil {
+		log.Fatal(err)
+	}
 
-				var msgRsp tgbotapi.MessageConfig
-				if fileID != "" {
-					msgRsp = tgbotapi.NewMessage(update.Message.From.ID, "文件 ["+fileName+"] 下载链接：\n"+downloadURL)
-				} else {
-					msgRsp = tgbotapi.NewMessage(update.Message.From.ID, "无法获取文件ID")
-				}
-				_, err := bot.Send(msgRsp)
-				if err != nil {
-					log.Println(err)
-				}
-			}
-		}
-	}()
+	mediaPath := os.Getenv("MEDIA_INDEX_FILE")
+	if mediaPath == "" {
+		mediaPath = "media_index.json"
+	}
+	if opts.mediaIndex, err = loadMediaStore(mediaPath); err != nil {
+		log.Fatal(err)
+	}
+
+	sidecarPath := os.Getenv("SIDECARS_FILE")
+	if sidecarPath == "" {
+		sidecarPath = "sidecars.json"
+	}
+	if opts.sidecars, err = loadSidecarStore(sidecarPath); err != nil {
+		log.Fatal(err)
+	}
+
+	reportPath := os.Getenv("REPORTS_FILE")
+	if reportPath == "" {
+		reportPath = "reports.json"
+	}
+	if opts.reports, err = loadReportStore(reportPath); err != nil {
+		log.Fatal(err)
+	}
+
+	uploadLinkPath := os.Getenv("UPLOAD_LINKS_FILE")
+	if uploadLinkPath == "" {
+		uploadLinkPath = "upload_links.json"
+	}
+	if opts.uploadLinks, err = loadUploadLinkStore(uploadLinkPath); err != nil {
+		log.Fatal(err)
+	}
+
+	previewPath := os.Getenv("PREVIEW_OVERRIDES_FILE")
+	if previewPath == "" {
+		previewPath = "preview_overrides.json"
+	}
+	if opts.previewOverrides, err = loadPreviewOverrideStore(previewPath); err != nil {
+		log.Fatal(err)
+	}
+
+	downloadAuthPath := os.Getenv("DOWNLOAD_AUTH_OVERRIDES_FILE")
+	if downloadAuthPath == "" {
+		downloadAuthPath = "download_auth.json"
+	}
+	if opts.downloadAuth, err = loadDownloadAuthStore(downloadAuthPath); err != nil {
+		log.Fatal(err)
+	}
+
+	commentPath := os.Getenv("COMMENTS_FILE")
+	if commentPath == "" {
+		commentPath = "comments.json"
+	}
+	if opts.comments, err = loadCommentStore(commentPath); err != nil {
+		log.Fatal(err)
+	}
 
 	httpFS, err := fs.Sub(embeddedFiles, "static")
 	if err != nil {
 		log.Fatal(err)
 	}
-	http.Handle("/", http.FileServer(staticFS{http.FS(httpFS)}))
-	http.HandleFunc("/verify", handleVerify)
-	http.HandleFunc("/upload", handleUpload)
-	http.HandleFunc("/d", handleDownload)
+	opts.static = http.FileServer(staticFS{http.FS(httpFS)})
+	if debug {
+		if adminToken == "" {
+			log.Fatal("开启 debug 时必须配置 admin_token")
+		}
+		opts.debug = true
+		log.Println("已开启调试接口 /debug/pprof、/debug/vars")
+	}
+	if opts.basicUser, opts.basicPass = os.Getenv("BASIC_AUTH_USER"), os.Getenv("BASIC_AUTH_PASS"); opts.basicUser != "" || opts.basicPass != "" {
+		if opts.basicUser == "" || opts.basicPass == "" {
+			log.Fatal("BASIC_AUTH_USER 与 BASIC_AUTH_PASS 需要同时配置")
+		}
+		log.Println("已开启 HTTP Basic 认证")
+	}
+	srv, err := newServer(profiles, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// check、bundle、restore 同样通过服务实例使用分块缓存、熔断器等组件，但不启动服务
+	switch command {
+	case "check":
+		os.Exit(runCheck(srv, client))
+	case "bundle":
+		os.Exit(runBundle(profiles, client, flag.Args()))
+	case "restore":
+		os.Exit(runRestore(profiles, client, flag.Args()))
+	}
+
+	srv.publishVars()
+	srv.start(client)
 
 	if port == "" {
 		port = "8080" // fallback
 	}
 	log.Printf("🎉🎉 The service is started successfully -> http://127.0.0.1:%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, srv))
+}
+
+func (p *profile) routes(static http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", static)
+	mux.HandleFunc("/verify", p.handleVerify)
+	mux.HandleFunc("/auth/telegram", p.requireBot(p.handleTelegramLogin))
+	mux.HandleFunc("/api/login-options", p.requireBot(p.handleLoginOptions))
+	mux.HandleFunc("/upload", p.requireBot(limitPerIP(uploadLimiter, p.queueUploads(trackTransfer("upload", p.handleUpload)))))
+	mux.HandleFunc("/d", p.guardHotlink(p.requireBot(limitPerIP(downloadLimiter, trackTransfer("download", p.handleDownload)))))
+	mux.HandleFunc("/d/", p.guardHotlink(p.requireBot(limitPerIP(downloadLimiter, trackTransfer("download", p.handleShortLink)))))
+	mux.HandleFunc("/s/", p.requireBot(limitPerIP(downloadLimiter, trackTransfer("download", p.handleShareSlug))))
+	mux.HandleFunc("/chunk", p.requireBot(trackTransfer("download", p.handleChunk)))
+	mux.HandleFunc("/watch/", p.requireBot(limitPerIP(downloadLimiter, p.handleWatch)))
+	mux.HandleFunc("/subtitle", p.requireBot(p.handleSubtitle))
+	mux.HandleFunc("/api/files/", p.requireBot(p.handleFileInfo))
+	mux.HandleFunc("/api/events", p.handleEvents)
+	mux.HandleFunc("/api/jobs/", p.handleJobLog)
+	mux.HandleFunc("/api/moderation", p.requireBot(p.handleModeration))
+	mux.HandleFunc("/api/moderation/", p.requireBot(p.handleModeration))
+	mux.HandleFunc("/api/media", p.handleMedia)
+	mux.HandleFunc("/api/gallery", p.requireBot(p.handleGallery))
+	mux.HandleFunc("/api/gallery/", p.requireBot(p.handleGallery))
+	mux.HandleFunc("/api/report", p.requireBot(p.handleReport))
+	mux.HandleFunc("/api/reports", p.requireBot(p.handleReports))
+	mux.HandleFunc("/api/reports/", p.requireBot(p.handleReports))
+	mux.HandleFunc("/api/announcement", p.handleAnnouncement)
+	mux.HandleFunc("/api/speedtest/", p.handleSpeedtest)
+	mux.HandleFunc("/api/upload-links", p.handleUploadLinks)
+	mux.HandleFunc("/api/upload-links/", p.handleUploadLinks)
+	mux.HandleFunc("/u/", p.handleUploadLink)
+	return mux
+}
+
+const defaultStartupMessage = "🤖tg-disk服务启动成功🎉🎉\n\n" +
+	"指定文件回复get获取URL链接，回复info查看文件信息\n直接发送或转发文件给机器人可批量获取URL链接\n版本、运行状态可通过 /status 查看"
+
+var (
+	// startupMessage 启动时发送的消息，为空时使用默认文本，off 表示不发送
+	startupMessage string
+	// startupChatID 启动消息发送到的聊天，为 0 时发送到 CHAT_ID
+	startupChatID int64
+)
+
+// listenUpdates 处理机器人消息：回复指定文件 get 获取下载链接
+func (p *profile) listenUpdates() {
+	bot := p.bot
+	chatID := p.ChatID
+	// CHAT_ID 对应的用户和配对时发送 /pair 的用户可以获取链接
+	isOwner := func(userID int64) bool {
+		return userID == chatID || (p.pairedUserID != 0 && userID == p.pairedUserID)
+	}
+
+	if startupMessage != "off" {
+		text := startupMessage
+		if text == "" {
+			text = defaultStartupMessage
+		}
+		target := startupChatID
+		if target == 0 {
+			target = chatID
+		}
+		startupMsg := tgbotapi.NewMessage(target, text)
+		for attempt := 1; attempt <= 3; attempt++ {
+			_, err := bot.Send(startupMsg)
+			if err == nil {
+				break
+			}
+			log.Printf("发送启动消息失败（第 %d 次）: %v", attempt, err)
+			time.Sleep(time.Duration(attempt) * 5 * time.Second)
+		}
+	}
+
+	// 直接发送或转发给机器人的文件，汇总后一次性回复下载链接
+	batcher := newLinkBatcher(p.sendLinkSummary)
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	updates := bot.GetUpdatesChan(u)
+
+	for update := range updates {
+		if update.CallbackQuery != nil {
+			if strings.HasPrefix(update.CallbackQuery.Data, "report-") {
+				p.handleReportCallback(update.CallbackQuery)
+			} else {
+				p.handleModerationCallback(update.CallbackQuery)
+			}
+			continue
+		}
+		if update.Message == nil || update.Message.From == nil {
+			continue
+		}
+		if update.Message.ReplyToMessage == nil {
+			if update.Message.Chat.IsPrivate() && p.isAdmin(update.Message.From.ID) && p.handleAdminCommand(update.Message) {
+				continue
+			}
+			if isOwner(update.Message.From.ID) && update.Message.Chat.IsPrivate() && p.linkBase() != "" {
+				if fileID, fileName := messageFile(update.Message); fileID != "" {
+					batcher.add(update.Message.Chat.ID, batchItem{fileID: fileID, fileName: fileName})
+				}
+			}
+			continue
+		}
+		if !isOwner(update.Message.From.ID) {
+			_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, "您无权限使用此机器人"))
+			continue
+		}
+
+		// 只处理私聊
+		if !update.Message.Chat.IsPrivate() {
+			continue
+		}
+		args := strings.Fields(update.Message.Text)
+		if len(args) == 0 {
+			continue
+		}
+		baseURL := p.linkBase()
+		switch args[0] {
+		case "get", "/get":
+			if baseURL == "" {
+				msg := tgbotapi.NewMessage(update.Message.From.ID, baseURLMissing)
+				_, _ = bot.Send(msg)
+				continue
+			}
+
+			fileID, fileName := messageFile(update.Message.ReplyToMessage)
+			downloadURL := p.downloadURL(baseURL, fileID, fileName)
+			if fileName == "fileAll.txt" {
+				// fileAll.txt 消息的说明文字是原始文件名
+				downloadURL = p.chunkedDownloadURL(baseURL, fileID, update.Message.ReplyToMessage.Caption)
+			}
+
+			var msgRsp tgbotapi.MessageConfig
+			if fileID != "" {
+				msgRsp = tgbotapi.NewMessage(update.Message.From.ID, "文件 ["+fileName+"] 下载链接：\n"+downloadURL)
+			} else {
+				msgRsp = tgbotapi.NewMessage(update.Message.From.ID, "无法获取文件ID")
+			}
+			_, err := bot.Send(msgRsp)
+			if err != nil {
+				log.Println(err)
+			}
+		case "share", "/share":
+			if baseURL == "" {
+				_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, baseURLMissing))
+				continue
+			}
+			fileID, fileName := messageFile(update.Message.ReplyToMessage)
+			if fileID == "" {
+				_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, "无法获取文件ID"))
+				continue
+			}
+			// 默认有效期 7 天，例如 share 12h、share 30d；可再带上自定义链接，例如 share 30d holiday-photos
+			ttl := 7 * 24 * time.Hour
+			slug := ""
+			if len(args) > 1 {
+				var err error
+				if ttl, err = parseTTL(args[1]); err != nil {
+					_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, err.Error()))
+					continue
+				}
+			}
+			if len(args) > 2 {
+				slug = strings.ToLower(args[2])
+			}
+			var link string
+			var expAt time.Time
+			var err error
+			if slug != "" {
+				link, expAt, err = p.vanityShareURL(baseURL, fileID, fileName, slug, ttl)
+			} else {
+				link, expAt, err = p.shareURL(baseURL, fileID, fileName, ttl)
+			}
+			if err != nil {
+				_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, err.Error()))
+				continue
+			}
+			_, err = bot.Send(tgbotapi.NewMessage(update.Message.From.ID,
+				fmt.Sprintf("文件 [%s] 限时链接（%s 前有效）：\n%s", fileName, expAt.Format("2006-01-02 15:04:05"), link)))
+			if err != nil {
+				log.Println(err)
+			}
+		case "info", "/info":
+			replyToMessage := update.Message.ReplyToMessage
+			fileID, fileName := messageFile(replyToMessage)
+			if fileID == "" {
+				_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, "无法获取文件ID"))
+				continue
+			}
+			// 小文件的哈希需要下载后计算（有缓存），分块文件只显示清单中记录的哈希
+			info, err := p.fileInfo(context.Background(), fileID, fileName, fileName != "" && fileName != "fileAll.txt")
+			if err != nil {
+				_, _ = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, "获取文件信息失败: "+err.Error()))
+				continue
+			}
+			if info.Source == nil {
+				info.Source = messageProvenance(replyToMessage)
+			}
+			uploadedAt := replyToMessage.Time()
+			info.UploadedAt = &uploadedAt
+			info.MessageID = replyToMessage.MessageID
+			info.MessageURL = messageLink(replyToMessage.Chat, replyToMessage.MessageID)
+			if baseURL != "" && fileName == "fileAll.txt" {
+				info.DownloadURL = p.chunkedDownloadURL(baseURL, fileID, info.Filename)
+			} else if baseURL != "" {
+				info.DownloadURL = p.downloadURL(baseURL, fileID, fileName)
+			}
+			if baseURL != "" {
+				info.ShareLinks = p.shareLinks(baseURL, fileID)
+			}
+			_, err = bot.Send(tgbotapi.NewMessage(update.Message.From.ID, formatFileInfo(info)))
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// messageFile 取出消息（通常是被回复的消息）中的文件 ID 和文件名
+func messageFile(msg *tgbotapi.Message) (fileID, fileName string) {
+	switch {
+	case msg.Document != nil && msg.Document.FileID != "":
+		fileID = msg.Document.FileID
+		fileName = msg.Document.FileName
+	case msg.Video != nil && msg.Video.FileID != "":
+		fileID = msg.Video.FileID
+		fileName = msg.Video.FileName
+	case msg.Audio != nil && msg.Audio.FileID != "":
+		fileID = msg.Audio.FileID
+		fileName = msg.Audio.FileName
+	case msg.Animation != nil && msg.Animation.FileID != "":
+		fileID = msg.Animation.FileID
+		fileName = msg.Animation.FileName
+	case msg.Sticker != nil && msg.Sticker.FileID != "":
+		fileID = msg.Sticker.FileID
+		fileName = msg.Sticker.Emoji
+	}
+	return fileID, fileName
 }
 
 type UploadResult struct {
-	Filename    string `json:"filename"`
-	FileID      string `json:"file_id"`
-	DownloadURL string `json:"download_url"`
+	Filename    string     `json:"filename"`
+	FileID      string     `json:"file_id"`
+	DownloadURL string     `json:"download_url"`
+	MessageID   int        `json:"message_id"`            // 文件（或 fileAll.txt）所在消息 ID
+	MessageURL  string     `json:"message_url,omitempty"` // 存储在频道/超级群组时可直接跳转的消息链接
+	SHA256      string     `json:"sha256"`                // 服务端计算的文件 SHA-256
+	Storage     string     `json:"storage,omitempty"`     // 上传时选择的存储会话名称
+	Media       *mediaInfo `json:"media,omitempty"`       // 图片尺寸、拍摄时间或视频时长
+
+	ResumedChunks int               `json:"resumed_chunks,omitempty"` // 续传时复用的已上传分块数
+	Variants      map[string]string `json:"variants,omitempty"`       // 变体名到下载链接
+	Pending       bool              `json:"pending,omitempty"`        // 匿名上传，审核通过前无法下载
+	UploadPath    string            `json:"upload_path"`              // disk：先写入临时目录；streaming：临时空间不足，边读边发送
+
+	parts []string // 返回的是清单时，清单引用的分块与变体，匿名上传时随清单一起等待审核
 }
 
-func handleUpload(w http.ResponseWriter, r *http.Request) {
+// hashMismatch 客户端提交了 sha256 且与服务端计算结果不一致时写入 422 并返回 true
+func hashMismatch(w http.ResponseWriter, expected, actual string) bool {
+	if expected == "" || expected == actual {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("SHA-256 校验失败，客户端: %s，服务端: %s", expected, actual), http.StatusUnprocessableEntity)
+	return true
+}
+
+// quotaExceeded 今日上传额度不足时告警并返回 507。在校验密码之后调用，未授权的请求不会触发额度告警
+func (p *profile) quotaExceeded(w http.ResponseWriter, r *http.Request) bool {
+	if p.quota.allow(r.ContentLength) {
+		return false
+	}
+	used, limit := p.quota.usage()
+	p.alert(eventQuotaBreach, "", "每日上传额度已用完", fmt.Sprintf("今日已上传 %s，额度 %s，来自 %s 的上传被拒绝", formatSize(used), formatSize(limit), clientIP(r)))
+	http.Error(w, "今日上传额度已用完", http.StatusInsufficientStorage)
+	return true
+}
+
+func (p *profile) handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
 		return
 	}
-	if r.FormValue("pwd") != accessPwd {
+	if p.uploadsPaused.Load() {
+		http.Error(w, "上传已暂停，请稍后再试", http.StatusServiceUnavailable)
+		return
+	}
+	// 带 callback_url 时处理结束后把结果或错误 POST 到该地址
+	cb := &uploadCallback{ResponseWriter: w, secret: p.srv.callbackSecret}
+	defer cb.finish(r)
+	w = cb
+	if needsStreaming(r.ContentLength) {
+		p.handleStreamingUpload(w, r)
+		return
+	}
+	// 公开模式下允许不带密码上传，文件进入审核队列；通过 Telegram 登录的用户只带 Cookie，通过上传链接上传的不需要密码
+	anonymous := !p.uploadAuthorized(r, r.FormValue("pwd"))
+	if anonymous && !p.PublicUpload {
 		http.Error(w, "密码错误", http.StatusUnauthorized)
 		return
 	}
+	if p.quotaExceeded(w, r) {
+		return
+	}
+	if err := setUploadCallback(w, r, r.FormValue("callback_url"), anonymous); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	storage := r.FormValue("storage")
+	chatID, err := p.storageChat(storage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	filesize := r.ContentLength
 	file, header, err := r.FormFile("file")
@@ -261,11 +841,14 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	defer os.RemoveAll(tmpDir)
 
 	origFilename := header.Filename
-	const chunkSize = 20 * 1024 * 1024
-	var fileIDs []string
+	lowPriority := isLowPriority(r)
+
+	// 客户端可提交 sha256 字段，服务端计算的哈希不一致时拒绝上传，用于发现代理等环节造成的损坏
+	expectedHash := strings.ToLower(strings.TrimSpace(r.FormValue("sha256")))
 
 	// 小文件直接上传
 	if filesize > 0 && filesize <= chunkSize {
+		hasher := sha256.New()
 		tmpPath := filepath.Join(tmpDir, origFilename)
 		tmp, err := os.Create(tmpPath)
 		if err != nil {
@@ -274,18 +857,29 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		}
 		defer tmp.Close()
 
-		_, err = io.Copy(tmp, file)
+		written, err := io.Copy(io.MultiWriter(tmp, hasher), file)
 		if err != nil {
 			http.Error(w, "写入临时文件失败: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		fileHash := hex.EncodeToString(hasher.Sum(nil))
+		if hashMismatch(w, expectedHash, fileHash) {
+			return
+		}
+		if p.scanRejected(w, r, origFilename, "", tmpPath) || archiveRejected(w, r, origFilename, "", tmpPath) {
+			return
+		}
 
 		var fileId string
+		if lowPriority {
+			throttleBackground(written)
+		}
 		doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(tmpPath))
-		doc.Caption = origFilename
-		msg, err := bot.Send(doc)
+		doc.Caption = origFilename + "\n" + uploadProvenance(r, anonymous).String()
+		msg, err := p.bot.Send(doc)
 		if err != nil {
-			log.Println("上传到 Telegram 失败: "+err.Error(), err)
+			reqLog(r, "上传到 Telegram 失败: %v", err)
+			p.alert(eventUploadFailed, origFilename, "文件上传失败", fmt.Sprintf("%s: %v", origFilename, err))
 			http.Error(w, "上传到 Telegram 失败: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -296,120 +890,220 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		} else if msg.Audio != nil {
 			fileId = msg.Audio.FileID
 		}
+		if err := verifyBlobFile(p.bot, fileId, tmpPath); err != nil {
+			p.alert(eventUploadFailed, origFilename, "文件上传失败", fmt.Sprintf("%s: %v", origFilename, err))
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
 
-		downloadURL := fmt.Sprintf("%s://%s/d?file_id=%s&filename=%s",
-			getScheme(r), r.Host, fileId, origFilename)
+		downloadURL := p.downloadURL(p.requestBase(r), fileId, origFilename)
 
 		result := UploadResult{
 			Filename:    origFilename,
 			FileID:      fileId,
 			DownloadURL: downloadURL,
+			MessageID:   msg.MessageID,
+			MessageURL:  messageLink(msg.Chat, msg.MessageID),
+			SHA256:      fileHash,
+			Storage:     storage,
+			UploadPath:  "disk",
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
+
+		// 生成了预览等变体时，额外保存一份单分块的清单记录各个版本，返回的链接改为指向清单
+		if variants := p.uploadVariants(chatID, tmpPath, origFilename, written); len(variants) > 0 {
+			source := uploadProvenance(r, anonymous)
+			meta := &manifest{Filename: origFilename, Chunks: []string{fileId}, SHA256: fileHash, Size: written, ChunkSizes: []int64{written}, ChunkHashes: []string{fileHash}, Variants: variants, Storage: storage}
+			meta.Source = &source
+			if metaMsg, err := p.sendManifest(chatID, tmpDir, meta); err != nil {
+				reqLog(r, "保存变体清单失败: %s，%v", origFilename, err)
+			} else {
+				result.FileID = metaMsg.Document.FileID
+				result.DownloadURL = p.chunkedDownloadURL(p.requestBase(r), result.FileID, origFilename)
+				result.Variants = p.variantURLs(r, result.FileID, variants)
+				result.parts = manifestParts(meta)
+			}
+		}
+		p.recordMediaInfo(r, &result, result.FileID != fileId, messageThumb(msg), tmpPath)
+		p.finishUpload(w, r, &result, written, anonymous, result.FileID != fileId)
 		return
 	}
 
-	// 读取文件并分块写入临时文件
-	chunkPaths := []string{}
-	buf := make([]byte, chunkSize)
-	index := 0
-	for {
-		n, err := io.ReadFull(file, buf)
-		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
-			http.Error(w, "读取文件失败: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if n == 0 {
-			break
-		}
-		chunkPath := filepath.Join(tmpDir, fmt.Sprintf("blob_%d", index))
-		if err := os.WriteFile(chunkPath, buf[:n], 0644); err != nil {
-			http.Error(w, "写入临时分块失败: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		chunkPaths = append(chunkPaths, chunkPath)
-		index++
-		if err == io.EOF || n < chunkSize {
-			break
-		}
+	// 读取文件并分块写入临时文件，根据第一块内容决定整个文件是否压缩，文本、日志等可显著减少占用
+	size := uploadChunkSize(r.FormValue("upload_id"))
+	splitter := transfer.Splitter{
+		ChunkSize: size,
+		Dir:       tmpDir,
+		Codec: func(first []byte) string {
+			if p.shouldCompress(origFilename, first) {
+				return codecGzip
+			}
+			return ""
+		},
+		Encode: func(_ string, data []byte) ([]byte, error) { return gzipBytes(data) },
+	}
+	// 切分时内存中只有一个分块，之后从临时文件发送
+	release, ok := p.reserveBuffers(w, r, int64(size))
+	if !ok {
+		return
+	}
+	split, err := splitter.Split(file)
+	release()
+	if errors.Is(err, transfer.ErrEmptyFile) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	codec := split.Codec
+	chunkPaths := make([]string, len(split.Chunks))
+	for i, c := range split.Chunks {
+		chunkPaths[i] = c.Path
+	}
+
+	if hashMismatch(w, expectedHash, split.SHA256) {
+		return
+	}
+	if p.scanRejected(w, r, origFilename, codec, chunkPaths...) || archiveRejected(w, r, origFilename, codec, chunkPaths...) {
+		return
 	}
 
+	// 带 upload_id 时记录每个分块的上传结果，中断后重新提交同一文件只需发送未确认的分块
+	uploadID, wal, done, err := p.beginUpload(r.FormValue("upload_id"), chatID)
+	if err != nil {
+		writeUploadIDError(w, err)
+		return
+	}
+	defer done()
+
+	// 任务日志通过 /api/jobs/{upload_id}/log 查看
+	w.Header().Set("X-Upload-Id", uploadID)
+	job := p.srv.jobs.start(p.Name, uploadID, origFilename, requestID(r))
+	job.add("info", -1, 0, "共 %d 个分块（每块 %s），%s，编码 %q", len(split.Chunks), formatSize(int64(size)), formatSize(split.Size), codec)
+
 	// 并发上传分块
-	type uploadResult struct {
-		Index  int
-		FileID string
-		Err    error
-	}
-	results := make([]uploadResult, len(chunkPaths))
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, threadNumbers)
-
-	for i, chunkPath := range chunkPaths {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(i int, path string) {
-			defer wg.Done()
-			defer func() { <-sem }()
-			doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
-			doc.Caption = "blob"
-			msg, err := bot.Send(doc)
-			if err != nil {
-				results[i] = uploadResult{Index: i, Err: fmt.Errorf("上传失败: %v", err)}
-				return
+	var sent atomic.Int32
+	uploader := transfer.Uploader{
+		Bot:     telegramBot{p: p, chatID: chatID, uploadID: uploadID},
+		Workers: threadNumbers,
+		Caption: func(c transfer.Chunk, total int) string {
+			return chunkCaption{Upload: uploadID, Name: origFilename, Index: c.Index, Total: total, Size: c.Size, Codec: codec, SHA256: c.SHA256}.String()
+		},
+		Resume: func(c transfer.Chunk) (string, bool) {
+			fid, ok := wal.lookup(c.Index, c.SHA256, codec)
+			if ok {
+				job.add("info", c.Index, 0, "续传，复用已上传的分块")
 			}
-			if msg.Document == nil {
-				results[i] = uploadResult{Index: i, Err: fmt.Errorf("上传后未返回 Document")}
-				return
+			return fid, ok
+		},
+		OnResult: func(c transfer.Chunk, err error, elapsed time.Duration) {
+			job.chunk(c.Index, elapsed, err)
+			tuner.record(size, c.Size, elapsed, err)
+		},
+		AfterSend: func(c transfer.Chunk, fileID string) error {
+			if err := verifyBlobFile(p.bot, fileID, c.Path); err != nil {
+				return err
+			}
+			p.events.publish(eventUploadProgress, map[string]any{"upload_id": uploadID, "filename": origFilename, "chunks_sent": sent.Add(1), "chunks_total": len(split.Chunks)})
+			if err := wal.record(walEntry{Index: c.Index, SHA256: c.SHA256, Codec: codec, FileID: fileID}); err != nil {
+				reqLog(r, "写入上传日志失败（分块 %d）: %v", c.Index, err)
 			}
-			results[i] = uploadResult{Index: i, FileID: msg.Document.FileID}
-		}(i, chunkPath)
+			return nil
+		},
 	}
-	wg.Wait()
-
-	// 检查结果
-	for _, res := range results {
-		if res.Err != nil {
-			http.Error(w, fmt.Sprintf("第 %d 个分块上传失败: %v", res.Index, res.Err), http.StatusInternalServerError)
-			return
+	if lowPriority {
+		uploader.Workers = 1
+		uploader.BeforeSend = func(c transfer.Chunk) {
+			if info, err := os.Stat(c.Path); err == nil {
+				throttleBackground(info.Size())
+			}
 		}
-		fileIDs = append(fileIDs, res.FileID)
+	}
+	uploaded, err := uploader.Upload(split.Chunks)
+	if err != nil {
+		job.finish(err)
+		p.alert(eventUploadFailed, origFilename, "文件上传失败", fmt.Sprintf("%s: %v", origFilename, err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	// 构建 fileAll.txt
-	builder := strings.Builder{}
-	builder.WriteString(origFilename + "\n")
-	for _, fid := range fileIDs {
-		builder.WriteString(fid + "\n")
+	fileHash, totalSize := split.SHA256, split.Size
+	meta := split.Manifest(origFilename, uploaded.FileIDs)
+	source := uploadProvenance(r, anonymous)
+	meta.Source = &source
+	meta.Storage = storage
+
+	// 视频预览需要完整文件，只有未压缩的分块可以直接拼接
+	if codec == "" && p.wantsVariants(origFilename, totalSize) {
+		fullPath := filepath.Join(tmpDir, "full"+filepath.Ext(origFilename))
+		if err := joinChunkFiles(fullPath, chunkPaths); err != nil {
+			reqLog(r, "拼接分块失败，跳过生成预览: %v", err)
+		} else {
+			meta.Variants = p.uploadVariants(chatID, fullPath, origFilename, totalSize)
+		}
 	}
 
-	metaPath := filepath.Join(tmpDir, "fileAll.txt")
-	if err := os.WriteFile(metaPath, []byte(builder.String()), 0644); err != nil {
-		http.Error(w, "写入 fileAll.txt 失败: "+err.Error(), http.StatusInternalServerError)
+	msg, err := p.sendManifest(chatID, tmpDir, meta)
+	if err != nil {
+		p.alert(eventUploadFailed, origFilename, "文件上传失败", fmt.Sprintf("%s: %v", origFilename, err))
+		job.finish(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 上传 fileAll.txt
-	metaDoc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(metaPath))
-	metaDoc.Caption = origFilename
-	msg, err := bot.Send(metaDoc)
-	if err != nil || msg.Document == nil {
-		http.Error(w, "上传 fileAll.txt 失败: "+err.Error(), http.StatusInternalServerError)
-		return
+	wal.remove()
+	p.forgetChunkMessages(uploadID, chatID)
+	job.finish(nil)
+	reqLog(r, "分块上传完成: %s，共 %d 个分块，耗时 %v", origFilename, len(chunkPaths), uploaded.Elapsed.Round(time.Millisecond))
+	if uploaded.Resumed > 0 {
+		reqLog(r, "续传完成: %s，跳过已上传的 %d/%d 个分块", origFilename, uploaded.Resumed, len(chunkPaths))
 	}
 
 	fileID := msg.Document.FileID
-	downloadURL := fmt.Sprintf("%s://%s/d?file_id=%s", getScheme(r), r.Host, fileID)
+	downloadURL := p.chunkedDownloadURL(p.requestBase(r), fileID, origFilename)
 	result := UploadResult{
-		Filename:    origFilename,
-		FileID:      fileID,
-		DownloadURL: downloadURL,
+		Filename:      origFilename,
+		FileID:        fileID,
+		DownloadURL:   downloadURL,
+		MessageID:     msg.MessageID,
+		MessageURL:    messageLink(msg.Chat, msg.MessageID),
+		SHA256:        fileHash,
+		ResumedChunks: uploaded.Resumed,
+		Storage:       storage,
+		UploadPath:    "disk",
+		Variants:      p.variantURLs(r, fileID, meta.Variants),
+		parts:         manifestParts(meta),
+	}
+	if codec == "" {
+		p.recordMediaInfo(r, &result, true, "", chunkPaths...)
+	}
+	p.finishUpload(w, r, &result, totalSize, anonymous, true)
+}
+
+// finishUpload 上传成功后计入额度，匿名上传加入审核队列，其余推送上传完成事件，最后返回结果
+func (p *profile) finishUpload(w http.ResponseWriter, r *http.Request, result *UploadResult, size int64, anonymous, chunked bool) {
+	p.quota.add(size)
+	if anonymous {
+		if err := p.holdForReview(r, result, chunked); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		p.events.publish(eventFileAdded, *result)
 	}
 	w.Header().Set("Content-Type", "application/json")
+	// 上传链接只能上传，不返回下载链接
+	if uploadLinkFrom(r) != nil {
+		json.NewEncoder(w).Encode(map[string]string{"filename": result.Filename, "sha256": result.SHA256})
+		return
+	}
 	json.NewEncoder(w).Encode(result)
 }
 
-func handleDownload(w http.ResponseWriter, r *http.Request) {
+func (p *profile) handleDownload(w http.ResponseWriter, r *http.Request) {
+	bot := p.botFor(r)
 	fileID := r.URL.Query().Get("file_id")
 	filename := r.URL.Query().Get("filename")
 
@@ -417,178 +1111,122 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "缺少 file_id 参数", http.StatusBadRequest)
 		return
 	}
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	if p.isMarkedGone(fileID) {
+		p.writeGone(w, r, fileID)
+		return
+	}
+	w = p.downloadCacheWriter(w, fileID)
+	// 播放器拖动进度产生的后续 Range 请求不重复计数
+	if rng := r.Header.Get("Range"); rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+		downloads.Inc(fileID)
+	}
 
 	// filename 参数存在，表示是小文件，直接下载
 	if filename != "" {
-		tgFile, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
-		if err != nil {
-			http.Error(w, "获取文件失败: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, tgFile.FilePath)
-		resp, err := http.Get(url)
-		if err != nil {
-			http.Error(w, "下载失败: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
-
-		ext := filepath.Ext(filename)
-		contentType := mime.TypeByExtension(ext)
-
-		switch contentType {
-		case "":
-			if strings.Contains(strings.ToLower(ext), ".mp3") {
-				contentType = "audio/mpeg"
-			} else if strings.Contains(strings.ToLower(ext), ".flac") {
-				contentType = "audio/x-flac"
-			} else if strings.Contains(strings.ToLower(ext), ".mp4") {
-				contentType = "video/mp4"
-			} else {
-				contentType = "application/octet-stream"
-			}
-		case "image/gif":
-			contentType = "video/mp4"
-		default:
-
-		}
-
-		w.Header().Set("Content-Type", contentType)
-		// 仅在不能预览时强制下载
-		if !isPreviewable(contentType) {
-			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-		}
-		w.Header().Set("Accept-Ranges", "bytes")
-		io.Copy(w, resp.Body)
+		p.serveTelegramFile(w, r, fileID, filename)
 		return
 	}
 
 	// 否则为 fileAll.txt 模式（大文件组合下载）
-	tgFile, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
-	if err != nil {
-		http.Error(w, "获取 fileAll.txt 失败: "+err.Error(), http.StatusInternalServerError)
+	m, err := readManifest(bot, fileID)
+	if isFileGone(err) {
+		p.writeGone(w, r, fileID)
 		return
 	}
-	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, tgFile.FilePath)
-	resp, err := http.Get(url)
 	if err != nil {
-		http.Error(w, "下载 fileAll.txt 失败: "+err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errBadManifest) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		http.Error(w, fmt.Sprintf("下载 fileAll.txt 返回状态异常: %d", resp.StatusCode), http.StatusInternalServerError)
+	// 按 variant 参数选择预览等其他版本，变体都是单个 Telegram 文件
+	if name := r.URL.Query().Get("variant"); name != "" {
+		for _, v := range m.Variants {
+			if v.Name == name {
+				p.serveTelegramFile(w, r, v.FileID, v.Filename)
+				return
+			}
+		}
+		http.Error(w, "该文件没有 "+name+" 版本", http.StatusNotFound)
 		return
 	}
 
-	linesBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "读取 fileAll.txt 失败: "+err.Error(), http.StatusInternalServerError)
+	origFilename := m.Filename
+	blobFileIDs := m.Chunks
+
+	if notModified(w, r, manifestETag(m), m.UploadedAt) {
 		return
 	}
 
-	linesStr := strings.Split(strings.TrimSpace(string(linesBytes)), "\n")
+	// 大文件默认强制下载，PDF 默认内联以便浏览器边下载边预览，带 inline=1 时按文件类型内联展示
+	contentType := p.srv.mimeTypes.contentTypeFor(origFilename)
+	if p.srv.mimeTypes.setDisposition(w, r, origFilename, p.previewByDefault(fileID, origFilename, contentType, true)) {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
 
-	// 去掉空行
-	var cleanLines []string
-	for _, line := range linesStr {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			cleanLines = append(cleanLines, line)
+	// 带 Range 的请求（如视频拖动进度、PDF 按页加载）只拉取覆盖的分块，逐个拉取
+	if r.Header.Get("Range") != "" {
+		release, ok := p.reserveBuffers(w, r, chunkSize)
+		if !ok {
+			return
+		}
+		defer release()
+		if err := p.serveChunkedRange(bot, w, r, m); err != nil {
+			p.alertBrokenChunk(fileID, origFilename, err)
 		}
+		return
 	}
 
-	if len(cleanLines) < 2 {
-		http.Error(w, "fileAll.txt 格式错误，至少应有文件名和一个分块ID", http.StatusBadRequest)
+	// 完整响应也带上 Content-Length，浏览器的 PDF 阅读器据此与 Accept-Ranges 判断能否改用范围请求按需加载
+	if size, err := chunkedSize(bot, m); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	origFilename := cleanLines[0]
-	blobFileIDs := cleanLines[1:]
-
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", origFilename))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Accept-Ranges", "bytes")
-
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "服务器不支持 Flush", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("开始下载合并大文件，文件名: %s，共 %d 个分块", origFilename, len(blobFileIDs))
-
-	// 并发下载每个块，顺序写入
-	type result struct {
-		index int
-		data  []byte
-		err   error
-	}
-
-	var (
-		wg          sync.WaitGroup
-		sem         = make(chan struct{}, threadNumbers)
-		partData    = make([][]byte, len(blobFileIDs))
-		downloadErr error
-	)
-
-	for i, fid := range blobFileIDs {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(index int, fileID string) {
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			tgBlob, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
-			if err != nil {
-				downloadErr = fmt.Errorf("获取分块 %s 失败: %v", fileID, err)
-				return
-			}
-			blobURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, tgBlob.FilePath)
-			resp, err := http.Get(blobURL)
-			if err != nil {
-				downloadErr = fmt.Errorf("下载分块 %s 失败: %v", fileID, err)
-				return
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				downloadErr = fmt.Errorf("下载分块 %s 状态码异常: %d", fileID, resp.StatusCode)
-				return
-			}
-
-			data, err := io.ReadAll(resp.Body)
-			if err != nil {
-				downloadErr = fmt.Errorf("读取分块 %s 失败: %v", fileID, err)
-				return
-			}
-
-			partData[index] = data
-		}(i, fid)
-	}
-
-	wg.Wait()
-
-	if downloadErr != nil {
-		http.Error(w, downloadErr.Error(), http.StatusInternalServerError)
+	// 内存中最多同时保留 threadNumbers 个分块
+	release, ok := p.reserveBuffers(w, r, int64(min(threadNumbers, len(blobFileIDs)))*chunkSize)
+	if !ok {
 		return
 	}
-
-	for i, data := range partData {
-		log.Printf("写入分块 %d/%d 字节数: %d", i+1, len(partData), len(data))
-		_, err := w.Write(data)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("写入响应失败（分块 %d）: %v", i, err), http.StatusInternalServerError)
-			return
+	defer release()
+
+	reqLog(r, "开始下载合并大文件，文件名: %s，共 %d 个分块", origFilename, len(blobFileIDs))
+
+	// 并发下载分块，按顺序边下载边写出，不必等全部分块下载完
+	if written, err := p.streamChunks(bot, w, flusher.Flush, blobFileIDs, m.Codec, threadNumbers); err != nil {
+		reqLog(r, "大文件下载失败: %s，%v", origFilename, err)
+		p.alertBrokenChunk(fileID, origFilename, err)
+		if written == 0 && isFileGone(err) {
+			p.writeGone(w, r, fileID)
+		} else if written == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
-		flusher.Flush()
+		// 已经写出部分内容时只能中断连接
+		return
 	}
 
-	log.Printf("大文件合并下载完成: %s", origFilename)
+	reqLog(r, "大文件合并下载完成: %s", origFilename)
 }
 
-func handleVerify(w http.ResponseWriter, r *http.Request) {
+func (p *profile) handleVerify(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
 		return
@@ -597,9 +1235,21 @@ func handleVerify(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "解析表单失败", http.StatusBadRequest)
 		return
 	}
-	if r.FormValue("pwd") == accessPwd {
+	// 从下载密码页提交时带有 next，校验通过后跳回原下载链接
+	next := r.FormValue("next")
+	if next != "" && !safeRedirect(next) {
+		next = ""
+	}
+	if r.FormValue("pwd") == p.AccessPwd {
+		p.setAuthCookie(w, r)
+		if next != "" {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
+	} else if next != "" {
+		p.writePasswordPage(w, next, "密码错误")
 	} else {
 		http.Error(w, "密码错误", http.StatusUnauthorized)
 	}
@@ -616,11 +1266,94 @@ func getScheme(r *http.Request) string {
 	return "http"
 }
 
-func isPreviewable(contentType string) bool {
-	return strings.HasPrefix(contentType, "image/") ||
-		strings.HasPrefix(contentType, "video/") ||
-		strings.HasPrefix(contentType, "audio/") ||
-		contentType == "application/pdf"
+// serveTelegramFile 转发单个 Telegram 文件，filename 决定 Content-Type 与下载文件名
+func (p *profile) serveTelegramFile(w http.ResponseWriter, r *http.Request, fileID, filename string) {
+	bot := p.botFor(r)
+	tgFile, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if isFileGone(err) {
+		p.writeGone(w, r, fileID)
+		return
+	}
+	if err != nil {
+		http.Error(w, "获取文件失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Telegram 文件内容不会变化，file_unique_id 即可作为 ETag；小文件没有记录上传时间
+	if tgFile.FileUniqueID != "" && notModified(w, r, `"`+tgFile.FileUniqueID+`"`, time.Time{}) {
+		return
+	}
+	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, tgFile.FilePath)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		http.Error(w, "下载失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// 转发 Range 头，PDF、视频等小文件同样支持拖动进度和断点续传
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := bot.Client.Do(req)
+	if err != nil {
+		http.Error(w, "下载失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPartialContent:
+		w.Header().Set("Content-Range", resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		w.Header().Set("Content-Range", resp.Header.Get("Content-Range"))
+		http.Error(w, "Range 参数无效", http.StatusRequestedRangeNotSatisfiable)
+		return
+	default:
+		http.Error(w, fmt.Sprintf("下载返回状态异常: %d", resp.StatusCode), http.StatusBadGateway)
+		return
+	}
+
+	contentType := p.srv.mimeTypes.contentTypeFor(filename)
+	w.Header().Set("Content-Type", contentType)
+	// 默认仅在不能预览时强制下载
+	p.srv.mimeTypes.setDisposition(w, r, filename, p.previewByDefault(fileID, filename, contentType, false))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, resp.Body)
+}
+
+// setDisposition 设置 Content-Disposition：dl=1 强制下载，inline=1 强制内联，
+// 都未指定时由 previewable 决定，开启 FORCE_DOWNLOAD 时总是下载，HTML、SVG 等按 ACTIVE_CONTENT_POLICY 处理；
+// download_as 可替换响应中的文件名。返回是否内联展示
+func (t *mimeTypes) setDisposition(w http.ResponseWriter, r *http.Request, filename string, previewable bool) bool {
+	q := r.URL.Query()
+	inline := previewable
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	attachOnly := guardActiveContent(w, t.contentTypeFor(filename))
+	switch {
+	case t.forceDownload, attachOnly, q.Get("dl") == "1":
+		inline = false
+	case q.Get("inline") == "1":
+		inline = true
+	}
+	name := filename
+	if v := q.Get("download_as"); v != "" {
+		name = filepath.Base(v)
+	}
+
+	if inline {
+		if q.Get("download_as") != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+		}
+		return true
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	return false
 }
 
 func GetMaxConcurrency() int {
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaintenanceMessage 未填写说明时返回给客户端的提示
+const defaultMaintenanceMessage = "服务维护中，暂时只能下载，请稍后再试"
+
+// maintenanceRetryAfter 维护模式下 503 响应的 Retry-After（秒）
+const maintenanceRetryAfter = "300"
+
+// MaintenanceStatus 只读维护模式的状态，对整个实例（所有 profile）生效
+type MaintenanceStatus struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+var maintenance struct {
+	sync.Mutex
+	MaintenanceStatus
+}
+
+// setMaintenance 开启或关闭维护模式，message 为空时使用默认提示
+func setMaintenance(enabled bool, message string) MaintenanceStatus {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	if !enabled {
+		maintenance.MaintenanceStatus = MaintenanceStatus{}
+		return maintenance.MaintenanceStatus
+	}
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	maintenance.Message = message
+	// 已在维护中时只更新说明，开始时间不变
+	if !maintenance.Enabled {
+		now := time.Now()
+		maintenance.Enabled, maintenance.Since = true, &now
+	}
+	return maintenance.MaintenanceStatus
+}
+
+func maintenanceStatus() MaintenanceStatus {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	return maintenance.MaintenanceStatus
+}
+
+// maintenanceExempt 维护模式下仍允许的写请求：登录与测速不修改任何数据
+func maintenanceExempt(path string) bool {
+	return path == "/verify" || path == "/auth/telegram" || strings.HasPrefix(path, "/api/speedtest/")
+}
+
+// guardMaintenance 维护模式下拒绝上传、删除等写请求并返回 503，下载与查询不受影响
+func guardMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if st := maintenanceStatus(); st.Enabled && !maintenanceExempt(r.URL.Path) {
+				w.Header().Set("Retry-After", maintenanceRetryAfter)
+				writeError(w, r, http.StatusServiceUnavailable, errCodeMaintenance, st.Message)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminMaintenance GET /api/admin/maintenance 查询维护模式，
+// POST 请求体为 {"enabled": true, "message": "迁移中"} 开启或关闭，需要管理员令牌
+func handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Enabled bool   `json:"enabled"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体应为 {\"enabled\": true, \"message\": \"...\"}", nil)
+			return
+		}
+		setMaintenance(req.Enabled, strings.TrimSpace(req.Message))
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET、POST", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceStatus())
+}
+
+// maintenanceCommand /maintenance on [说明]、/maintenance off，不带参数时查看当前状态
+func maintenanceCommand(args []string) string {
+	if len(args) == 0 {
+		st := maintenanceStatus()
+		if !st.Enabled {
+			return "维护模式：关闭\n用法：/maintenance on [说明]、/maintenance off"
+		}
+		return "维护模式：开启（" + st.Since.Format("2006-01-02 15:04:05") + " 起）\n说明：" + st.Message
+	}
+	switch args[0] {
+	case "on":
+		st := setMaintenance(true, strings.Join(args[1:], " "))
+		return "已开启维护模式，上传、删除等写操作返回 503，机器人暂不生成上传链接、不处理审核与举报，下载不受影响\n说明：" + st.Message
+	case "off":
+		setMaintenance(false, "")
+		return "已关闭维护模式"
+	}
+	return "用法：/maintenance on [说明]、/maintenance off"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"tg-disk/pkg/transfer"
+)
+
+// errBadManifest fileAll.txt 内容不符合格式
+var errBadManifest = transfer.ErrBadManifest
+
+// manifest 大文件分块上传后生成的 fileAll.txt，格式见 transfer.Manifest
+type manifest = transfer.Manifest
+
+// sendManifest 将清单写入 tmpDir 下的 fileAll.txt 并发送到存储会话 chatID，未记录上传时间时记为当前时间
+func (p *profile) sendManifest(chatID int64, tmpDir string, m *manifest) (tgbotapi.Message, error) {
+	if m.UploadedAt.IsZero() {
+		m.UploadedAt = time.Now().Truncate(time.Second)
+	}
+	metaPath := filepath.Join(tmpDir, "fileAll.txt")
+	if err := os.WriteFile(metaPath, []byte(m.String()), 0644); err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("写入 fileAll.txt 失败: %v", err)
+	}
+	metaDoc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(metaPath))
+	metaDoc.Caption = m.Filename
+	msg, err := p.bot.Send(metaDoc)
+	if err != nil {
+		return msg, fmt.Errorf("上传 fileAll.txt 失败: %v", err)
+	}
+	if msg.Document == nil {
+		return msg, errors.New("上传 fileAll.txt 失败: 未返回 Document")
+	}
+	return msg, nil
+}
+
+// telegramBot 把分块发送到存储会话 chatID（为 0 时为 CHAT_ID），uploadID 非空时记录发出的消息，供 /purge 清理失败的上传
+type telegramBot struct {
+	p        *profile
+	chatID   int64
+	uploadID string
+}
+
+func (b telegramBot) SendDocument(path, caption string) (string, error) {
+	chatID := b.chatID
+	if chatID == 0 {
+		chatID = b.p.ChatID
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+	doc.Caption = caption
+	msg, err := b.p.bot.Send(doc)
+	if err != nil {
+		return "", fmt.Errorf("上传失败: %v", err)
+	}
+	if b.uploadID != "" {
+		b.p.recordChunkMessage(b.uploadID, chatID, msg.MessageID)
+	}
+	if msg.Document == nil {
+		return "", errors.New("上传后未返回 Document")
+	}
+	return msg.Document.FileID, nil
+}
+
+// readManifest 从 Telegram 下载并解析 fileAll.txt
+func readManifest(bot *tgbotapi.BotAPI, fileID string) (*manifest, error) {
+	tgFile, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("获取 fileAll.txt 失败: %w", err)
+	}
+	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, tgFile.FilePath)
+	resp, err := telegramGet(bot, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("下载 fileAll.txt 失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载 fileAll.txt 返回状态异常: %d", resp.StatusCode)
+	}
+
+	linesBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取 fileAll.txt 失败: %v", err)
+	}
+	return transfer.ParseManifest(string(linesBytes))
+}
+
+// manifestParts 清单引用的所有 Telegram 文件：各个分块与变体，下架或审核清单时需要一并拦截
+func manifestParts(m *manifest) []string {
+	parts := append([]string(nil), m.Chunks...)
+	for _, v := range m.Variants {
+		parts = append(parts, v.FileID)
+	}
+	return parts
+}
+
+// chunkCaption 分块消息的说明文字
+type chunkCaption = transfer.Caption
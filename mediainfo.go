@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mediaTimeLayout 拍摄时间的格式，照片的 EXIF 时间没有时区，按相机的本地时间原样保存
+const mediaTimeLayout = "2006-01-02T15:04:05"
+
+// mediaInfo 上传时从图片、视频中提取的元数据，无法识别的字段为空
+type mediaInfo struct {
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	TakenAt  string  `json:"taken_at,omitempty"` // EXIF 拍摄时间或视频的创建时间
+	Duration float64 `json:"duration,omitempty"` // 视频时长（秒）
+}
+
+// mediaKind 按扩展名区分照片与视频，其他文件返回空字符串
+func mediaKind(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return "photo"
+	case ".mp4", ".m4v", ".mov":
+		return "video"
+	}
+	return ""
+}
+
+// extractMediaInfo 读取图片尺寸与 EXIF 拍摄时间，或 MP4/MOV 的时长、画面尺寸与创建时间；
+// 文件损坏或格式不支持时返回 nil，不影响上传
+func extractMediaInfo(filename string, ra io.ReaderAt, size int64) *mediaInfo {
+	var info mediaInfo
+	switch mediaKind(filename) {
+	case "photo":
+		cfg, _, err := image.DecodeConfig(io.NewSectionReader(ra, 0, size))
+		if err != nil {
+			return nil
+		}
+		info.Width, info.Height = cfg.Width, cfg.Height
+		if ext := strings.ToLower(filepath.Ext(filename)); ext == ".jpg" || ext == ".jpeg" {
+			taken, orientation := jpegExif(io.NewSectionReader(ra, 0, size))
+			info.TakenAt = taken
+			// 方向 5-8 表示旋转了 90 度，显示尺寸宽高互换
+			if orientation >= 5 && orientation <= 8 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+		}
+	case "video":
+		if !mp4Info(ra, size, &info) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &info
+}
+
+// jpegExif 从 JPEG 的 APP1 段中读取拍摄时间（DateTimeOriginal，没有时使用 DateTime）与方向
+func jpegExif(r io.Reader) (taken string, orientation int) {
+	var marker [2]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return "", 0
+	}
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil || hdr[0] != 0xFF {
+			return "", 0
+		}
+		// 到达图像数据时还没有 EXIF
+		if hdr[1] == 0xDA || hdr[1] == 0xD9 {
+			return "", 0
+		}
+		n := int(binary.BigEndian.Uint16(hdr[2:])) - 2
+		if n < 0 {
+			return "", 0
+		}
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return "", 0
+		}
+		if hdr[1] == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseExif(seg[6:])
+		}
+	}
+}
+
+// parseExif 解析 TIFF 结构的 EXIF 数据
+func parseExif(tiff []byte) (taken string, orientation int) {
+	if len(tiff) < 8 {
+		return "", 0
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return "", 0
+	}
+	ascii := func(count, offset uint32) string {
+		if count <= 4 || uint64(offset)+uint64(count) > uint64(len(tiff)) {
+			return ""
+		}
+		return strings.TrimRight(string(tiff[offset:offset+count]), "\x00 ")
+	}
+	var dateTime, original string
+	var exifIFD uint32
+	readIFD := func(offset uint32, fn func(tag uint16, count, value uint32, raw []byte)) {
+		if uint64(offset)+2 > uint64(len(tiff)) {
+			return
+		}
+		n := int(bo.Uint16(tiff[offset:]))
+		for i := 0; i < n; i++ {
+			e := uint64(offset) + 2 + uint64(i)*12
+			if e+12 > uint64(len(tiff)) {
+				return
+			}
+			entry := tiff[e : e+12]
+			fn(bo.Uint16(entry), bo.Uint32(entry[4:]), bo.Uint32(entry[8:]), entry[8:])
+		}
+	}
+	readIFD(bo.Uint32(tiff[4:]), func(tag uint16, count, value uint32, raw []byte) {
+		switch tag {
+		case 0x0112: // Orientation，SHORT 类型，值在前两个字节
+			orientation = int(bo.Uint16(raw))
+		case 0x0132: // DateTime
+			dateTime = ascii(count, value)
+		case 0x8769: // Exif IFD 指针
+			exifIFD = value
+		}
+	})
+	if exifIFD != 0 {
+		readIFD(exifIFD, func(tag uint16, count, value uint32, _ []byte) {
+			if tag == 0x9003 { // DateTimeOriginal
+				original = ascii(count, value)
+			}
+		})
+	}
+	for _, s := range []string{original, dateTime} {
+		if t, err := time.Parse("2006:01:02 15:04:05", s); err == nil {
+			return t.Format(mediaTimeLayout), orientation
+		}
+	}
+	return "", orientation
+}
+
+// mp4MoovLimit moov 的读取上限，正常视频的 moov 远小于该值
+const mp4MoovLimit = 32 << 20
+
+// mp4Info 从 moov/mvhd 读取时长与创建时间，从第一个有画面的 trak/tkhd 读取尺寸。
+// moov 可能位于文件末尾，因此按盒子偏移跳读，不需要读取整个文件
+func mp4Info(ra io.ReaderAt, size int64, info *mediaInfo) bool {
+	var moov []byte
+	for off := int64(0); off+8 <= size; {
+		typ, start, end, ok := mp4Box(ra, off, size)
+		if !ok {
+			return false
+		}
+		if typ == "moov" {
+			if end-start > mp4MoovLimit {
+				return false
+			}
+			moov = make([]byte, end-start)
+			if _, err := ra.ReadAt(moov, start); err != nil {
+				return false
+			}
+			break
+		}
+		off = end
+	}
+	if moov == nil {
+		return false
+	}
+	r := bytes.NewReader(moov)
+	found := false
+	eachBox(r, int64(len(moov)), func(typ string, body []byte) {
+		switch typ {
+		case "mvhd":
+			found = parseMvhd(body, info)
+		case "trak":
+			if info.Width == 0 {
+				eachBox(bytes.NewReader(body), int64(len(body)), func(typ string, body []byte) {
+					if typ == "tkhd" {
+						parseTkhd(body, info)
+					}
+				})
+			}
+		}
+	})
+	return found
+}
+
+// mp4Box 读取 off 处盒子的类型与内容范围
+func mp4Box(ra io.ReaderAt, off, size int64) (typ string, start, end int64, ok bool) {
+	var hdr [16]byte
+	if _, err := ra.ReadAt(hdr[:8], off); err != nil {
+		return "", 0, 0, false
+	}
+	n := int64(binary.BigEndian.Uint32(hdr[:4]))
+	typ, start = string(hdr[4:8]), off+8
+	switch n {
+	case 0: // 直到文件末尾
+		n = size - off
+	case 1: // 64 位长度
+		if _, err := ra.ReadAt(hdr[8:16], off+8); err != nil {
+			return "", 0, 0, false
+		}
+		n, start = int64(binary.BigEndian.Uint64(hdr[8:16])), off+16
+	}
+	if n < start-off || off+n > size {
+		return "", 0, 0, false
+	}
+	return typ, start, off + n, true
+}
+
+// eachBox 遍历内存中的一层盒子
+func eachBox(ra *bytes.Reader, size int64, fn func(typ string, body []byte)) {
+	for off := int64(0); off+8 <= size; {
+		typ, start, end, ok := mp4Box(ra, off, size)
+		if !ok {
+			return
+		}
+		body := make([]byte, end-start)
+		if _, err := ra.ReadAt(body, start); err != nil {
+			return
+		}
+		fn(typ, body)
+		off = end
+	}
+}
+
+// mp4Epoch MP4 时间字段的起点
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func parseMvhd(b []byte, info *mediaInfo) bool {
+	var created, timescale, duration uint64
+	switch {
+	case len(b) >= 20 && b[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(b[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(b[12:]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:]))
+	case len(b) >= 32 && b[0] == 1:
+		created = binary.BigEndian.Uint64(b[4:])
+		timescale = uint64(binary.BigEndian.Uint32(b[20:]))
+		duration = binary.BigEndian.Uint64(b[24:])
+	default:
+		return false
+	}
+	if timescale > 0 {
+		info.Duration = float64(duration) / float64(timescale)
+	}
+	// 很多设备不写创建时间（为 0），2000 年以前的值也视为无效
+	if t := mp4Epoch.Add(time.Duration(created) * time.Second); created > 0 && t.Year() >= 2000 && t.Before(time.Now().Add(24*time.Hour)) {
+		info.TakenAt = t.Format(mediaTimeLayout)
+	}
+	return true
+}
+
+func parseTkhd(b []byte, info *mediaInfo) {
+	// 宽高为 16.16 定点数，位于 tkhd 末尾，版本 1 的时间字段多 12 字节
+	off := 76
+	if len(b) > 0 && b[0] == 1 {
+		off = 88
+	}
+	if len(b) < off+8 {
+		return
+	}
+	if w, h := int(binary.BigEndian.Uint32(b[off:])>>16), int(binary.BigEndian.Uint32(b[off+4:])>>16); w > 0 && h > 0 {
+		info.Width, info.Height = w, h
+	}
+}
+
+// chunkFiles 把按顺序切分的分块临时文件当作一个文件随机读取
+type chunkFiles struct {
+	files []*os.File
+	sizes []int64
+}
+
+func openChunkFiles(paths []string) (*chunkFiles, int64, error) {
+	c := &chunkFiles{}
+	var total int64
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			c.Close()
+			return nil, 0, err
+		}
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			c.Close()
+			return nil, 0, err
+		}
+		c.files, c.sizes = append(c.files, f), append(c.sizes, st.Size())
+		total += st.Size()
+	}
+	return c, total, nil
+}
+
+func (c *chunkFiles) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for i, f := range c.files {
+		if off >= c.sizes[i] {
+			off -= c.sizes[i]
+			continue
+		}
+		m, err := f.ReadAt(p[n:min(len(p), n+int(c.sizes[i]-off))], off)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		off = 0
+	}
+	return n, io.EOF
+}
+
+func (c *chunkFiles) Close() {
+	for _, f := range c.files {
+		f.Close()
+	}
+}
+
+// mediaEntry 媒体索引中的一项
+type mediaEntry struct {
+	mediaInfo
+	Filename   string    `json:"filename"`
+	Chunked    bool      `json:"chunked"`
+	Thumb      string    `json:"thumb,omitempty"` // Telegram 为文件生成的缩略图 file_id
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// date 用于按日期筛选：有拍摄时间时取拍摄日期，否则取上传日期
+func (e mediaEntry) date() string {
+	if len(e.TakenAt) >= 10 {
+		return e.TakenAt[:10]
+	}
+	return e.UploadedAt.Local().Format("2006-01-02")
+}
+
+// mediaStore 上传时提取的媒体元数据，按 profile/file_id 保存在 JSON 文件中
+type mediaStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]mediaEntry
+}
+
+func loadMediaStore(path string) (*mediaStore, error) {
+	st := &mediaStore{path: path, items: make(map[string]mediaEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取媒体索引失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.items); err != nil {
+		return nil, fmt.Errorf("解析媒体索引失败: %v", err)
+	}
+	return st, nil
+}
+
+func (st *mediaStore) get(profile, fileID string) (mediaEntry, bool) {
+	if st == nil {
+		return mediaEntry{}, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.items[profile+"/"+fileID]
+	return e, ok
+}
+
+func (st *mediaStore) put(profile, fileID string, e mediaEntry) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + fileID
+	old, had := st.items[key]
+	st.items[key] = e
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		if had {
+			st.items[key] = old
+		} else {
+			delete(st.items, key)
+		}
+		return fmt.Errorf("保存媒体索引失败: %v", err)
+	}
+	return nil
+}
+
+// mediaItem 媒体列表中的一项
+type mediaItem struct {
+	FileID string `json:"file_id"`
+	mediaEntry
+}
+
+// list 返回 profile 下符合条件的媒体，按日期排序；month 为 2006-01 格式，kind 为 photo 或 video，为空时不筛选
+func (st *mediaStore) list(profile, month, kind string) []mediaItem {
+	list := []mediaItem{}
+	if st == nil {
+		return list
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, e := range st.items {
+		prof, fileID, _ := strings.Cut(key, "/")
+		if prof != profile || (month != "" && !strings.HasPrefix(e.date(), month+"-")) || (kind != "" && mediaKind(e.Filename) != kind) {
+			continue
+		}
+		list = append(list, mediaItem{FileID: fileID, mediaEntry: e})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		di, dj := list[i].TakenAt, list[j].TakenAt
+		if di == "" {
+			di = list[i].UploadedAt.Local().Format(mediaTimeLayout)
+		}
+		if dj == "" {
+			dj = list[j].UploadedAt.Local().Format(mediaTimeLayout)
+		}
+		return di < dj
+	})
+	return list
+}
+
+// recordMediaInfo 上传完成后从临时文件提取媒体元数据，写入上传结果与媒体索引；
+// thumb 为 Telegram 生成的缩略图（没有时为空），paths 为按顺序的未压缩分块，不是图片或视频时不做任何事
+func (p *profile) recordMediaInfo(r *http.Request, result *UploadResult, chunked bool, thumb string, paths ...string) {
+	if p.srv.mediaIndex == nil || mediaKind(result.Filename) == "" {
+		return
+	}
+	files, size, err := openChunkFiles(paths)
+	if err != nil {
+		reqLog(r, "读取媒体元数据失败: %s，%v", result.Filename, err)
+		return
+	}
+	defer files.Close()
+	info := extractMediaInfo(result.Filename, files, size)
+	if info == nil {
+		return
+	}
+	result.Media = info
+	e := mediaEntry{mediaInfo: *info, Filename: result.Filename, Chunked: chunked, Thumb: thumb, UploadedAt: time.Now()}
+	if err := p.srv.mediaIndex.put(p.Name, result.FileID, e); err != nil {
+		reqLog(r, "%v", err)
+	}
+}
+
+// mediaURL 媒体对应的下载链接
+func (p *profile) mediaURL(base string, it mediaItem) string {
+	if it.Chunked {
+		return p.chunkedDownloadURL(base, it.FileID, it.Filename)
+	}
+	return p.downloadURL(base, it.FileID, it.Filename)
+}
+
+// visibleMedia 审核通过且未被举报下架的媒体才出现在列表中
+func (p *profile) visibleMedia(fileID string) bool {
+	return p.srv.moderation.status(fileID) == "" && !p.srv.reports.isBlocked(fileID)
+}
+
+// handleMedia GET /api/media?month=2023-08&type=photo 按拍摄日期（没有时按上传日期）列出上传过的图片与视频，需要访问密码
+func (p *profile) handleMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET", nil)
+		return
+	}
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	q := r.URL.Query()
+	month, kind := q.Get("month"), q.Get("type")
+	if _, err := time.Parse("2006-01", month); month != "" && err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "month 格式应为 2006-01", nil)
+		return
+	}
+	if kind != "" && kind != "photo" && kind != "video" {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "type 只能为 photo 或 video", nil)
+		return
+	}
+	type listed struct {
+		mediaItem
+		DownloadURL string `json:"download_url"`
+	}
+	base := p.requestBase(r)
+	files := []listed{}
+	for _, it := range p.srv.mediaIndex.list(p.Name, month, kind) {
+		if p.visibleMedia(it.FileID) {
+			files = append(files, listed{it, p.mediaURL(base, it)})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// memoryBudget 所有传输在内存中持有的分块缓冲的上限。每个传输开始前按预计的峰值占用预留，
+// 超过上限时直接拒绝，由客户端稍后重试，而不是等到内存耗尽被 OOM killer 结束进程。
+// 只统计传输中的分块，不包括分块缓存（CHUNK_CACHE_SIZE）
+type memoryBudget struct {
+	mu       sync.Mutex
+	limit    int64 // 为 0 时不限制
+	used     int64
+	rejected atomic.Int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit}
+}
+
+// reserve 预留 n 字节，成功时返回释放函数；单个传输的预留超过上限时只要没有其他传输就允许，避免大分块永远无法传输
+func (b *memoryBudget) reserve(n int64) (func(), bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.used > 0 && b.used+n > b.limit {
+		b.rejected.Add(1)
+		return nil, false
+	}
+	b.used += n
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.used -= n
+			b.mu.Unlock()
+		})
+	}, true
+}
+
+// usage 当前预留的字节数与上限
+func (b *memoryBudget) usage() (used, limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used, b.limit
+}
+
+// reserveBuffers 为传输预留 n 字节缓冲，超过 MAX_BUFFER_MEMORY 时写入 503 并返回 false
+func (p *profile) reserveBuffers(w http.ResponseWriter, r *http.Request, n int64) (func(), bool) {
+	release, ok := p.srv.buffers.reserve(n)
+	if !ok {
+		reqLog(r, "内存缓冲已达上限，拒绝传输（需要 %s）", formatSize(n))
+		// 调用方可能已经设置了文件的 Content-Length
+		w.Header().Del("Content-Length")
+		w.Header().Set("Retry-After", "15")
+		writeError(w, r, http.StatusServiceUnavailable, errCodeTooManyRequests, "服务器繁忙，请稍后重试")
+	}
+	return release, ok
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// metalink Metalink 4（RFC 5854）文件，只描述一个文件
+type metalink struct {
+	XMLName   xml.Name     `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string       `xml:"generator"`
+	File      metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name   string          `xml:"name,attr"`
+	Size   int64           `xml:"size"`
+	Hash   *metalinkHash   `xml:"hash,omitempty"`
+	Pieces *metalinkPieces `xml:"pieces,omitempty"`
+	URLs   []string        `xml:"url"`
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkPieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+// handleMetalink GET /api/files/{id}/metalink，权限与下载相同：
+// 默认返回 Metalink 4 文件，指向支持 Range 的完整下载链接，并以分块 SHA-256 作为分段校验值，
+// aria2c 可以多连接并发下载、逐段校验并断点续传；
+// format=aria2 时返回 aria2c -i 使用的输入文件，逐个列出分块链接与校验值，下载后需要按顺序拼接
+func (p *profile) handleMetalink(w http.ResponseWriter, r *http.Request, fileID string) {
+	bot := p.botFor(r)
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	m, err := readManifest(bot, fileID)
+	if err != nil {
+		p.writeInfoError(w, r, fileID, err)
+		return
+	}
+	size, err := chunkedSize(bot, m)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadGateway, errCodeTelegram, err.Error(), nil)
+		return
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = p.requestBase(r)
+	}
+	info := p.manifestInfo(base, fileID, m, size)
+	name := filepath.Base(info.Filename)
+
+	if r.URL.Query().Get("format") == "aria2" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".aria2.txt"}))
+		w.Write([]byte(aria2Input(info)))
+		return
+	}
+
+	file := metalinkFile{Name: name, Size: info.Size, URLs: []string{p.chunkedDownloadURL(base, fileID, info.Filename)}}
+	if info.SHA256 != "" {
+		file.Hash = &metalinkHash{Type: "sha-256", Value: info.SHA256}
+	}
+	file.Pieces = metalinkPiecesFor(info.Chunks)
+	data, err := xml.MarshalIndent(metalink{Generator: "tg-disk", File: file}, "", "  ")
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/metalink4+xml")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".meta4"}))
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// metalinkPiecesFor 分块哈希作为分段校验值，要求除最后一块外大小相同且都记录了哈希，否则返回 nil
+func metalinkPiecesFor(chunks []ChunkInfo) *metalinkPieces {
+	if len(chunks) == 0 {
+		return nil
+	}
+	pieces := &metalinkPieces{Length: chunks[0].Size, Type: "sha-256"}
+	for i, c := range chunks {
+		if c.SHA256 == "" || (i < len(chunks)-1 && c.Size != pieces.Length) || c.Size > pieces.Length {
+			return nil
+		}
+		pieces.Hashes = append(pieces.Hashes, c.SHA256)
+	}
+	return pieces
+}
+
+// aria2Input aria2c 输入文件，每个分块保存为 {文件名}.partNNN，带有 SHA-256 时由 aria2c 校验
+func aria2Input(info ManifestInfo) string {
+	name := filepath.Base(info.Filename)
+	width := len(fmt.Sprint(len(info.Chunks) - 1))
+	if width < 3 {
+		width = 3
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s，共 %d 个分块，用 aria2c -i 下载后按顺序拼接：cat %q.part* > %q\n", name, len(info.Chunks), name, name)
+	for _, c := range info.Chunks {
+		b.WriteString(c.DownloadURL + "\n")
+		fmt.Fprintf(&b, "  out=%s.part%0*d\n", name, width, c.Index)
+		if c.SHA256 != "" {
+			fmt.Fprintf(&b, "  checksum=sha-256=%s\n", c.SHA256)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// activeContentPolicy HTML、SVG 等可以执行脚本的文件的处理方式：attachment 总是下载，
+// sandbox 允许内联但加上 CSP sandbox，inline 不做限制（只适合可信的私有实例）
+var activeContentPolicy = "attachment"
+
+// mimeTypes 下载时的 Content-Type 与内联展示规则，由服务实例与镜像各自持有
+type mimeTypes struct {
+	// mimeOverrides 扩展名（小写、带点）到 Content-Type 的覆盖表，优先于系统 MIME 表。
+	// 默认把 gif 当作 mp4 返回（Telegram 会把 gif 转成 mp4 存储），可通过 MIME_TYPES=gif=image/gif 取消
+	mimeOverrides map[string]string
+	// previewRules 默认内联展示的规则，可通过 PREVIEWABLE_TYPES 替换
+	previewRules []previewRule
+	// forceDownload 为 true 时所有下载都以附件形式返回，忽略预览规则、单个文件的设置与 inline=1
+	forceDownload bool
+}
+
+// newMimeTypes 返回默认规则
+func newMimeTypes() *mimeTypes {
+	return &mimeTypes{
+		mimeOverrides: map[string]string{".gif": "video/mp4"},
+		previewRules:  []previewRule{{pattern: "image/*"}, {pattern: "video/*"}, {pattern: "audio/*"}, {pattern: "application/pdf"}},
+	}
+}
+
+// parseMimeOverrides 解析 MIME_TYPES，格式为逗号分隔的 扩展名=类型，例如 md=text/plain,gif=image/gif
+func (t *mimeTypes) parseMimeOverrides(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ext, typ, ok := strings.Cut(pair, "=")
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		typ = strings.TrimSpace(typ)
+		if !ok || ext == "" || !strings.Contains(typ, "/") {
+			return fmt.Errorf("MIME_TYPES 格式错误，应为 扩展名=类型: %s", pair)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		t.mimeOverrides[ext] = typ
+	}
+	return nil
+}
+
+// contentTypeFor 根据文件扩展名推断下载时返回的 Content-Type
+func (t *mimeTypes) contentTypeFor(filename string) string {
+	ext := filepath.Ext(filename)
+	if typ, ok := t.mimeOverrides[strings.ToLower(ext)]; ok {
+		return typ
+	}
+	contentType := mime.TypeByExtension(ext)
+
+	switch contentType {
+	case "":
+		if strings.Contains(strings.ToLower(ext), ".mp3") {
+			contentType = "audio/mpeg"
+		} else if strings.Contains(strings.ToLower(ext), ".flac") {
+			contentType = "audio/x-flac"
+		} else if strings.Contains(strings.ToLower(ext), ".mp4") {
+			contentType = "video/mp4"
+		} else {
+			contentType = "application/octet-stream"
+		}
+	}
+	return contentType
+}
+
+// previewRule 一条预览规则：pattern 为 MIME 类型（支持 image/* 通配）或以 . 开头的扩展名，deny 表示不内联
+type previewRule struct {
+	pattern string
+	deny    bool
+}
+
+func (rule previewRule) match(ext, contentType string) bool {
+	if strings.HasPrefix(rule.pattern, ".") {
+		return ext == rule.pattern
+	}
+	if prefix, ok := strings.CutSuffix(rule.pattern, "/*"); ok {
+		return strings.HasPrefix(contentType, prefix+"/")
+	}
+	return contentType == rule.pattern
+}
+
+// parsePreviewableTypes 解析 PREVIEWABLE_TYPES，逗号分隔的 MIME 类型或扩展名，前面加 - 表示不内联，
+// 例如 image/*,video/*,.md,-image/svg+xml。设置后替换默认规则
+func (t *mimeTypes) parsePreviewableTypes(s string) {
+	var rules []previewRule
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		rule := previewRule{}
+		if rest, ok := strings.CutPrefix(v, "-"); ok {
+			v, rule.deny = rest, true
+		}
+		if v != "" {
+			rule.pattern = v
+			rules = append(rules, rule)
+		}
+	}
+	t.previewRules = rules
+}
+
+// isPreviewable 按预览规则判断文件是否默认内联展示，多条规则匹配时以最后一条为准
+func (t *mimeTypes) isPreviewable(filename, contentType string) bool {
+	contentType, _, _ = strings.Cut(strings.ToLower(contentType), ";")
+	contentType = strings.TrimSpace(contentType)
+	ext := strings.ToLower(filepath.Ext(filename))
+	previewable := false
+	for _, rule := range t.previewRules {
+		if rule.match(ext, contentType) {
+			previewable = !rule.deny
+		}
+	}
+	return previewable
+}
+
+// isInlineChunked 分块大文件是否默认内联展示：只有 PDF，浏览器的阅读器会按需发起范围请求，
+// 不必先下载整个文件；视频等其他类型仍默认下载，需要时带 inline=1
+func (t *mimeTypes) isInlineChunked(filename, contentType string) bool {
+	ct, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	return strings.TrimSpace(ct) == "application/pdf" && t.isPreviewable(filename, contentType)
+}
+
+// isActiveContent 是否为浏览器会执行其中脚本的类型，以本站域名内联展示时可被用于 XSS
+func isActiveContent(contentType string) bool {
+	contentType, _, _ = strings.Cut(strings.ToLower(contentType), ";")
+	switch strings.TrimSpace(contentType) {
+	case "text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml", "text/xsl":
+		return true
+	}
+	return false
+}
+
+// guardActiveContent 按 ACTIVE_CONTENT_POLICY 为 HTML、SVG 等响应加上 CSP sandbox，返回是否必须作为附件下载
+func guardActiveContent(w http.ResponseWriter, contentType string) bool {
+	if !isActiveContent(contentType) || activeContentPolicy == "inline" {
+		return false
+	}
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	return activeContentPolicy != "sandbox"
+}
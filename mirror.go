@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// mirror 只读镜像模式：把请求转发给另一个 tg-disk 实例（源站），分块大文件的下载改为
+// 通过源站的 /api/files/{id}/manifest 与 /chunk 拉取分块并缓存在本地，适合部署在离下载者较近的地方。
+// 下载权限（令牌、私有模式、审核状态）仍由源站在返回清单时校验
+type mirror struct {
+	origin *url.URL
+	token  string // 源站的访问密码，源站开启 DOWNLOAD_AUTH 时需要
+	client *http.Client
+	proxy  *httputil.ReverseProxy
+	cache  *chunkCache
+	types  *mimeTypes
+}
+
+func newMirror(origin, token string, client *http.Client, cache *chunkCache, types *mimeTypes) (*mirror, error) {
+	u, err := url.Parse(strings.TrimRight(origin, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("MIRROR_ORIGIN 格式错误: %s", origin)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = u.Host
+	}
+	if client.Transport != nil {
+		proxy.Transport = client.Transport
+	}
+	return &mirror{origin: u, token: token, client: client, proxy: proxy, cache: cache, types: types}, nil
+}
+
+func (m *mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.URL.Path == "/d" && q.Get("file_id") != "" && q.Get("variant") == "" &&
+		(q.Get("filename") == "" || q.Get("filename") == "fileAll.txt") {
+		m.serveChunked(w, r, q.Get("file_id"))
+		return
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/d/"); ok && q.Get("variant") == "" {
+		if fileID, filename, ok := parseDownloadPath(rest); ok && filename == "" {
+			m.serveChunked(w, r, fileID)
+			return
+		}
+	}
+	m.proxy.ServeHTTP(w, r)
+}
+
+// get 请求源站，带上访问密码
+func (m *mirror) get(rawURL string, r *http.Request) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.token != "" {
+		req.Header.Set("X-Access-Pwd", m.token)
+	}
+	return m.client.Do(req)
+}
+
+// manifest 从源站获取分块列表，原样带上下载链接中的令牌参数，由源站校验权限。
+// 源站返回错误时写回相同的状态码和内容，返回 nil
+func (m *mirror) manifest(w http.ResponseWriter, r *http.Request, fileID string) *ManifestInfo {
+	q := r.URL.Query()
+	q.Del("file_id")
+	u := m.origin.String() + "/api/files/" + url.PathEscape(fileID) + "/manifest?" + q.Encode()
+	resp, err := m.get(u, r)
+	if err != nil {
+		http.Error(w, "请求源站失败: "+err.Error(), http.StatusBadGateway)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return nil
+	}
+	var info ManifestInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		http.Error(w, "解析源站清单失败: "+err.Error(), http.StatusBadGateway)
+		return nil
+	}
+	return &info
+}
+
+// chunk 读取分块，优先使用本地缓存。源站返回的是按 codec 解码后的内容，缓存键按源站区分
+func (m *mirror) chunk(r *http.Request, c ChunkInfo, codec string) ([]byte, error) {
+	key := chunkCacheKey(m.origin.Host, c.FileID, codec)
+	if data, ok := m.cache.Get(key); ok {
+		return data, nil
+	}
+	resp, err := m.get(c.DownloadURL, r)
+	if err != nil {
+		return nil, fmt.Errorf("下载分块 %d 失败: %v", c.Index, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载分块 %d 状态码异常: %d", c.Index, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取分块 %d 失败: %v", c.Index, err)
+	}
+	if int64(len(data)) != c.Size {
+		return nil, fmt.Errorf("分块 %d 大小不符: 期望 %d，实际 %d", c.Index, c.Size, len(data))
+	}
+	m.cache.Put(key, data)
+	return data, nil
+}
+
+// serveChunked 按源站清单拼接分块，支持单段 Range
+func (m *mirror) serveChunked(w http.ResponseWriter, r *http.Request, fileID string) {
+	info := m.manifest(w, r, fileID)
+	if info == nil {
+		return
+	}
+	contentType := m.types.contentTypeFor(info.Filename)
+	if m.types.setDisposition(w, r, info.Filename, m.types.isInlineChunked(info.Filename, contentType)) {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	start, end := int64(0), info.Size-1
+	if rng := r.Header.Get("Range"); rng != "" {
+		var ok bool
+		if start, end, ok = parseRange(rng, info.Size); !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			http.Error(w, "Range 参数无效", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	for _, c := range info.Chunks {
+		if c.Offset+c.Size <= start || c.Offset > end {
+			continue
+		}
+		data, err := m.chunk(r, c, info.Codec)
+		if err != nil {
+			// 响应头已发出，只能中断连接
+			log.Printf("镜像下载失败: %s，%v", info.Filename, err)
+			return
+		}
+		from, to := int64(0), int64(len(data))
+		if start > c.Offset {
+			from = start - c.Offset
+		}
+		if end+1-c.Offset < to {
+			to = end + 1 - c.Offset
+		}
+		if _, err := w.Write(data[from:to]); err != nil {
+			return
+		}
+	}
+}
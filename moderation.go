@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 审核状态，通过审核的文件直接从队列中移除
+const (
+	moderationPending  = "pending"
+	moderationRejected = "rejected"
+)
+
+var errModerationNotFound = errors.New("审核记录不存在或已处理")
+
+// moderationItem 公开模式下匿名上传、等待审核的文件
+type moderationItem struct {
+	ID        string    `json:"id"` // 短 ID，用于内联按钮的回调数据（Telegram 限制 64 字节，放不下 file_id）
+	Profile   string    `json:"profile"`
+	FileID    string    `json:"file_id"`
+	Filename  string    `json:"filename"`
+	Chunked   bool      `json:"chunked"`
+	Parts     []string  `json:"parts,omitempty"` // 分块文件清单引用的分块与变体，与清单一起拦截下载
+	MessageID int       `json:"message_id"`
+	ClientIP  string    `json:"client_ip"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// moderationQueue 审核队列，保存在 JSON 文件中，重启后待审核和已拒绝的文件仍不能下载
+type moderationQueue struct {
+	mu     sync.Mutex
+	path   string
+	items  map[string]*moderationItem
+	byFile map[string]*moderationItem // 文件及其分块、变体的 file_id -> 审核记录
+}
+
+func loadModerationQueue(path string) (*moderationQueue, error) {
+	q := &moderationQueue{path: path, items: make(map[string]*moderationItem), byFile: make(map[string]*moderationItem)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取审核队列失败: %v", err)
+	}
+	var items []*moderationItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("解析审核队列失败: %v", err)
+	}
+	for _, it := range items {
+		q.index(it)
+	}
+	return q, nil
+}
+
+// index 登记审核记录，调用方需持有锁
+func (q *moderationQueue) index(it *moderationItem) {
+	q.items[it.ID] = it
+	q.byFile[it.FileID] = it
+	for _, part := range it.Parts {
+		q.byFile[part] = it
+	}
+}
+
+// save 保存审核队列，调用方需持有锁
+func (q *moderationQueue) save() error {
+	items := make([]*moderationItem, 0, len(q.items))
+	for _, it := range q.items {
+		items = append(items, it)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return writeJSONFile(q.path, items)
+}
+
+func (q *moderationQueue) add(it *moderationItem) error {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	it.ID = hex.EncodeToString(b)
+	it.Status = moderationPending
+	it.CreatedAt = time.Now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.index(it)
+	return q.save()
+}
+
+// resolve 处理审核结果：通过时移出队列，拒绝时保留记录以继续拦截下载
+func (q *moderationQueue) resolve(profile, id string, approve bool) (*moderationItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	it, ok := q.items[id]
+	if !ok || it.Profile != profile || it.Status != moderationPending {
+		return nil, errModerationNotFound
+	}
+	if approve {
+		delete(q.items, id)
+		delete(q.byFile, it.FileID)
+		for _, part := range it.Parts {
+			delete(q.byFile, part)
+		}
+	} else {
+		it.Status = moderationRejected
+	}
+	return it, q.save()
+}
+
+// status 返回文件（分块、变体按所属清单）的审核状态，不在队列中（已通过或非匿名上传）时返回空字符串
+func (q *moderationQueue) status(fileID string) string {
+	if q == nil {
+		return ""
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if it, ok := q.byFile[fileID]; ok {
+		return it.Status
+	}
+	return ""
+}
+
+// messageID 匿名上传文件在 CHAT_ID 中的消息 ID，不是匿名上传的文件返回 0
+func (q *moderationQueue) messageID(profile, fileID string) int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if it, ok := q.byFile[fileID]; ok && it.Profile == profile && it.FileID == fileID {
+		return it.MessageID
+	}
+	return 0
+}
+
+func (q *moderationQueue) pending(profile string) []moderationItem {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := []moderationItem{}
+	for _, it := range q.items {
+		if it.Profile == profile && it.Status == moderationPending {
+			list = append(list, *it)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// holdForReview 匿名上传完成后加入审核队列，并向管理员发送带“通过/拒绝”按钮的消息
+func (p *profile) holdForReview(r *http.Request, result *UploadResult, chunked bool) error {
+	it := &moderationItem{
+		Profile:   p.Name,
+		FileID:    result.FileID,
+		Filename:  result.Filename,
+		Chunked:   chunked,
+		Parts:     result.parts,
+		MessageID: result.MessageID,
+		ClientIP:  clientIP(r),
+	}
+	if err := p.srv.moderation.add(it); err != nil {
+		return fmt.Errorf("加入审核队列失败: %v", err)
+	}
+	result.Pending = true
+
+	msg := tgbotapi.NewMessage(p.ChatID, fmt.Sprintf("收到匿名上传，等待审核：\n文件：%s\n来源 IP：%s", it.Filename, it.ClientIP))
+	msg.ReplyToMessageID = it.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ 通过", "approve:"+it.ID),
+		tgbotapi.NewInlineKeyboardButtonData("❌ 拒绝", "reject:"+it.ID),
+	))
+	if _, err := p.bot.Send(msg); err != nil {
+		log.Printf("发送审核消息失败: %v", err)
+	}
+	return nil
+}
+
+// moderate 审核文件，拒绝时同时删除 Telegram 中的文件消息
+func (p *profile) moderate(id string, approve bool) (*moderationItem, error) {
+	it, err := p.srv.moderation.resolve(p.Name, id, approve)
+	if err != nil {
+		return nil, err
+	}
+	p.events.publish(eventModerated, it)
+	if !approve && it.MessageID != 0 {
+		if _, err := p.bot.Request(tgbotapi.NewDeleteMessage(p.ChatID, it.MessageID)); err != nil {
+			log.Printf("删除被拒绝的文件消息失败: %v", err)
+		}
+	}
+	return it, nil
+}
+
+// handleModerationCallback 处理审核消息上的按钮，与管理命令一样只有管理员可以操作
+func (p *profile) handleModerationCallback(cb *tgbotapi.CallbackQuery) {
+	if cb.From == nil || !p.isAdmin(cb.From.ID) {
+		_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, "您无权限使用此机器人"))
+		return
+	}
+	action, id, _ := strings.Cut(cb.Data, ":")
+	if action != "approve" && action != "reject" {
+		return
+	}
+	// 与 /api/moderation 一样，维护模式中不修改审核队列，也不删除文件消息
+	if st := maintenanceStatus(); st.Enabled {
+		_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, "维护模式中，暂不能审核："+st.Message))
+		return
+	}
+	it, err := p.moderate(id, action == "approve")
+	if err != nil {
+		_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, err.Error()))
+		return
+	}
+
+	text := "已拒绝并删除：" + it.Filename
+	if action == "approve" {
+		text = "已通过：" + it.Filename
+		if base := p.linkBase(); base != "" {
+			text += "\n" + p.uploadDownloadURL(base, it)
+		}
+	}
+	_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, "已处理"))
+	if cb.Message != nil {
+		_, _ = p.bot.Send(tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, text))
+	}
+}
+
+// uploadDownloadURL 审核记录对应的下载链接
+func (p *profile) uploadDownloadURL(base string, it *moderationItem) string {
+	if it.Chunked {
+		return p.chunkedDownloadURL(base, it.FileID, it.Filename)
+	}
+	return p.downloadURL(base, it.FileID, it.Filename)
+}
+
+// handleModeration GET /api/moderation 列出待审核文件，
+// POST /api/moderation/{id}/approve 或 /reject 审核，需要访问密码
+func (p *profile) handleModeration(w http.ResponseWriter, r *http.Request) {
+	if p.srv.moderation == nil {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未开启公开上传", nil)
+		return
+	}
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/moderation"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET", nil)
+			return
+		}
+		type pendingFile struct {
+			moderationItem
+			DownloadURL string `json:"download_url"`
+		}
+		files := []pendingFile{}
+		for _, it := range p.srv.moderation.pending(p.Name) {
+			files = append(files, pendingFile{it, p.uploadDownloadURL(p.requestBase(r), &it)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	if action != "approve" && action != "reject" {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未知操作", nil)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 POST", nil)
+		return
+	}
+	it, err := p.moderate(id, action == "approve")
+	if errors.Is(err, errModerationNotFound) {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(it)
+}
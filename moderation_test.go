@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestModerationCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    int64
+		paired  int64
+		allowed bool
+	}{
+		{"admin_user_ids 中的用户", 42, 0, true},
+		{"配对用户", 7, 7, true},
+		{"其他用户", 99, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, err := loadModerationQueue(filepath.Join(t.TempDir(), "moderation.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tg := newFakeTelegram()
+			// CHAT_ID 为频道时没有用户的 ID 与之相同
+			p := &profile{Name: "default", BotToken: "token", ChatID: -1001234567890, AdminUserIDs: []int64{42}, pairedUserID: tt.paired}
+			newTestServer(t, tg, serverOptions{moderation: queue}, p)
+			it := &moderationItem{Profile: p.Name, FileID: "file-1", Filename: "a.txt"}
+			if err := queue.add(it); err != nil {
+				t.Fatal(err)
+			}
+
+			p.handleModerationCallback(&tgbotapi.CallbackQuery{ID: "cb", From: &tgbotapi.User{ID: tt.from}, Data: "approve:" + it.ID})
+
+			want := moderationPending
+			if tt.allowed {
+				want = ""
+			}
+			if got := queue.status("file-1"); got != want {
+				t.Errorf("审核状态 = %q，期望 %q", got, want)
+			}
+			if n := tg.called("token", "answerCallbackQuery"); n != 1 {
+				t.Errorf("answerCallbackQuery 调用 %d 次，期望 1 次", n)
+			}
+		})
+	}
+}
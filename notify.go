@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 告警事件
+const (
+	eventUploadFailed = "upload_failed"
+	eventBrokenChunk  = "broken_chunk"
+	eventQuotaBreach  = "quota_breach"
+)
+
+// notification 一条发给管理员的告警
+type notification struct {
+	Event   string    `json:"event"`
+	Profile string    `json:"profile"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+
+	profile *profile
+}
+
+// notifier 告警渠道，通过 NOTIFY_CHANNELS 组合启用
+type notifier interface {
+	Notify(n notification) error
+}
+
+// notifiers 已启用的告警渠道，默认只发 Telegram 消息
+var notifiers = []notifier{telegramNotifier{}}
+
+// newNotifiers 按逗号分隔的渠道名创建告警渠道，渠道所需的配置从环境变量读取
+func newNotifiers(channels string) ([]notifier, error) {
+	var list []notifier
+	for _, name := range strings.Split(channels, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "telegram":
+			list = append(list, telegramNotifier{})
+		case "webhook":
+			u := os.Getenv("NOTIFY_WEBHOOK_URL")
+			if u == "" {
+				return nil, fmt.Errorf("启用 webhook 告警需要配置 NOTIFY_WEBHOOK_URL")
+			}
+			list = append(list, webhookNotifier{url: u})
+		case "gotify":
+			u, token := os.Getenv("GOTIFY_URL"), os.Getenv("GOTIFY_TOKEN")
+			if u == "" || token == "" {
+				return nil, fmt.Errorf("启用 gotify 告警需要配置 GOTIFY_URL 与 GOTIFY_TOKEN")
+			}
+			list = append(list, gotifyNotifier{url: strings.TrimRight(u, "/"), token: token})
+		case "email":
+			n := emailNotifier{
+				addr:     os.Getenv("SMTP_ADDR"),
+				user:     os.Getenv("SMTP_USER"),
+				password: os.Getenv("SMTP_PASSWORD"),
+				from:     os.Getenv("SMTP_FROM"),
+				to:       strings.Split(os.Getenv("NOTIFY_EMAIL_TO"), ","),
+			}
+			if n.addr == "" || n.from == "" || os.Getenv("NOTIFY_EMAIL_TO") == "" {
+				return nil, fmt.Errorf("启用 email 告警需要配置 SMTP_ADDR、SMTP_FROM 与 NOTIFY_EMAIL_TO")
+			}
+			list = append(list, n)
+		default:
+			return nil, fmt.Errorf("不支持的告警渠道: %s", name)
+		}
+	}
+	return list, nil
+}
+
+// alertThrottle 相同告警 10 分钟内只发送一次，避免损坏的热门文件反复触发
+var alertThrottle = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+const alertInterval = 10 * time.Minute
+
+// alert 异步发送告警到所有渠道，key 用于去重（例如文件 ID）
+func (p *profile) alert(event, key, title, message string) {
+	dedup := p.Name + "|" + event + "|" + key
+	alertThrottle.Lock()
+	if t, ok := alertThrottle.last[dedup]; ok && time.Since(t) < alertInterval {
+		alertThrottle.Unlock()
+		return
+	}
+	alertThrottle.last[dedup] = time.Now()
+	alertThrottle.Unlock()
+	recordError(event, title+"："+message)
+
+	n := notification{Event: event, Profile: p.Name, Title: title, Message: message, Time: time.Now(), profile: p}
+	for _, nt := range notifiers {
+		go func(nt notifier) {
+			if err := nt.Notify(n); err != nil {
+				log.Printf("发送告警失败（%T）: %v", nt, err)
+			}
+		}(nt)
+	}
+}
+
+// alertBrokenChunk 分块重试后仍下载失败时告警，列出所有失败的分块；客户端断开等写入错误以及因此取消的下载忽略，熔断期间的失败已统一记录，也不逐个告警
+func (p *profile) alertBrokenChunk(fileID, filename string, err error) {
+	var broken *chunkErrors
+	if errors.As(err, &broken) && !isCanceled(err) && !errors.Is(err, errTelegramUnreachable) {
+		p.alert(eventBrokenChunk, fileID, "分块下载失败", fmt.Sprintf("%s（file_id: %s）%v", filename, fileID, broken))
+	}
+}
+
+// telegramNotifier 通过该 profile 的机器人发送到 CHAT_ID
+type telegramNotifier struct{}
+
+func (telegramNotifier) Notify(n notification) error {
+	if n.profile == nil || !n.profile.isReady() {
+		return fmt.Errorf("机器人未就绪")
+	}
+	_, err := n.profile.bot.Send(tgbotapi.NewMessage(n.profile.ChatID, "⚠️"+n.Title+"\n"+n.Message))
+	return err
+}
+
+// webhookNotifier 以 JSON POST 到指定地址
+type webhookNotifier struct {
+	url string
+}
+
+func (wn webhookNotifier) Notify(n notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return postJSON(wn.url, body)
+}
+
+// gotifyNotifier 推送到 Gotify 服务
+type gotifyNotifier struct {
+	url   string
+	token string
+}
+
+func (g gotifyNotifier) Notify(n notification) error {
+	body, err := json.Marshal(map[string]any{"title": n.Title, "message": n.Message, "priority": 5})
+	if err != nil {
+		return err
+	}
+	return postJSON(g.url+"/message?token="+url.QueryEscape(g.token), body)
+}
+
+func postJSON(u string, body []byte) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态异常: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// emailNotifier 通过 SMTP 发送邮件
+type emailNotifier struct {
+	addr     string // host:port
+	user     string
+	password string
+	from     string
+	to       []string
+}
+
+func (e emailNotifier) Notify(n notification) error {
+	var auth smtp.Auth
+	if e.user != "" {
+		host, _, _ := strings.Cut(e.addr, ":")
+		auth = smtp.PlainAuth("", e.user, e.password, host)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[tg-disk] "+n.Title))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nprofile: %s\r\n时间: %s\r\n", n.Message, n.Profile, n.Time.Format(time.RFC3339))
+	return smtp.SendMail(e.addr, auth, e.from, e.to, []byte(msg.String()))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pairingState 配对结果，保存在 PAIRING_FILE 中，下次启动时代替 CHAT_ID
+type pairingState struct {
+	ChatID   int64     `json:"chat_id"`
+	UserID   int64     `json:"user_id"`
+	PairedAt time.Time `json:"paired_at"`
+}
+
+// loadPairing 读取配对结果，文件不存在时返回 nil
+func loadPairing(path string) (*pairingState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取配对结果失败: %v", err)
+	}
+	var st pairingState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("解析配对结果失败: %v", err)
+	}
+	if st.ChatID == 0 {
+		return nil, fmt.Errorf("配对结果 %s 缺少 chat_id", path)
+	}
+	return &st, nil
+}
+
+// newPairingCode 生成 6 位数字配对码
+func newPairingCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// waitForPairing 未配置 CHAT_ID 时等待在目标会话中发送 /pair <配对码>，
+// 记下会话 ID 与发送者并保存到 pairPath。配对完成前 ready 不会关闭，依赖 Bot 的接口返回 503
+func (p *profile) waitForPairing() {
+	log.Printf("未配置 CHAT_ID，进入配对模式：在要保存文件的会话中向 @%s 发送 /pair %s", p.bot.Self.UserName, p.pairCode)
+
+	// 自行轮询而不使用 GetUpdatesChan：后者停止后无法再次启动，配对完成后 listenUpdates 还要接收更新
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	for {
+		updates, err := p.bot.GetUpdates(u)
+		if err != nil {
+			log.Printf("获取配对消息失败，3 秒后重试: %v", err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		for _, update := range updates {
+			u.Offset = update.UpdateID + 1
+			msg := update.Message
+			if msg == nil || msg.From == nil || msg.Command() != "pair" {
+				continue
+			}
+			if strings.TrimSpace(msg.CommandArguments()) != p.pairCode {
+				_, _ = p.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "配对码错误"))
+				continue
+			}
+			st := pairingState{ChatID: msg.Chat.ID, UserID: msg.From.ID, PairedAt: time.Now()}
+			if err := writeJSONFile(p.pairPath, st); err != nil {
+				log.Printf("保存配对结果失败: %v", err)
+				_, _ = p.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "保存配对结果失败: "+err.Error()))
+				continue
+			}
+			// 确认已处理的更新，listenUpdates 不会再收到这条 /pair
+			_, _ = p.bot.GetUpdates(tgbotapi.UpdateConfig{Offset: u.Offset})
+
+			p.ChatID, p.pairedUserID = st.ChatID, st.UserID
+			log.Printf("配对成功（%s）: chat_id=%d，用户 %d，已保存到 %s", p.Name, st.ChatID, st.UserID, p.pairPath)
+			_, _ = p.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("配对成功，文件将保存到此会话（chat_id: %d）", st.ChatID)))
+			return
+		}
+	}
+}
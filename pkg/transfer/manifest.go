@@ -0,0 +1,219 @@
+// Package transfer 大文件上传流水线：分块、构建 fileAll.txt 清单、并发发送分块。
+// 与 HTTP、Telegram Bot 解耦，发送分块通过 Bot 接口完成，方便替换实现
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrBadManifest fileAll.txt 内容不符合格式
+var ErrBadManifest = errors.New("fileAll.txt 格式错误，至少应有文件名和一个分块ID")
+
+// Manifest 大文件分块上传后生成的 fileAll.txt：第一行为原始文件名，之后每行一个分块 file_id，
+// 以 # 开头的行为 key=value 形式的元数据（file_id 不会以 # 开头）
+type Manifest struct {
+	Filename string
+	Chunks   []string
+	SHA256   string // 整个文件的 SHA-256，旧版本生成的清单没有该字段
+	Size     int64  // 原始文件大小，分块经过压缩时必须记录，旧清单为 0
+	Codec    string // 分块编码，为空表示原样存储
+	// ChunkSizes 每个分块解码后的字节数，Range 请求据此直接定位分块，旧清单为空时按固定分块大小推算
+	ChunkSizes []int64
+	// ChunkHashes 每个分块原始内容的 SHA-256
+	ChunkHashes []string
+	Variants    []Variant
+	Source      *Source   // 上传来源，旧清单为空
+	Storage     string    // 分块所在的存储会话名称，为空表示默认会话（CHAT_ID）
+	UploadedAt  time.Time // 清单发送时间，精确到秒，旧清单为零值
+}
+
+// Variant 与原始文件一同保存的其他版本，例如预览图
+type Variant struct {
+	Name     string
+	FileID   string
+	Filename string
+}
+
+// Source 文件进入系统的方式
+type Source struct {
+	Source string `json:"source"`
+	IP     string `json:"ip,omitempty"`
+	User   string `json:"user,omitempty"` // 匿名上传为 anonymous，机器人收到的文件为发送者的用户名
+}
+
+// String 以空格连接各字段，例如 web 1.2.3.4 anonymous
+func (s Source) String() string {
+	line := s.Source
+	if s.IP != "" {
+		line += " " + s.IP
+	}
+	if s.User != "" {
+		line += " " + s.User
+	}
+	return line
+}
+
+// String 序列化为 fileAll.txt 内容
+func (m *Manifest) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(m.Filename + "\n")
+	if m.SHA256 != "" {
+		builder.WriteString("#sha256=" + m.SHA256 + "\n")
+	}
+	if m.Size > 0 {
+		builder.WriteString("#size=" + strconv.FormatInt(m.Size, 10) + "\n")
+	}
+	if m.Codec != "" {
+		builder.WriteString("#codec=" + m.Codec + "\n")
+	}
+	if len(m.ChunkSizes) == len(m.Chunks) {
+		sizes := make([]string, len(m.ChunkSizes))
+		for i, n := range m.ChunkSizes {
+			sizes[i] = strconv.FormatInt(n, 10)
+		}
+		builder.WriteString("#chunk_sizes=" + strings.Join(sizes, ",") + "\n")
+	}
+	if len(m.ChunkHashes) == len(m.Chunks) {
+		builder.WriteString("#chunk_sha256=" + strings.Join(m.ChunkHashes, ",") + "\n")
+	}
+	for _, v := range m.Variants {
+		builder.WriteString("#variant=" + v.Name + "," + v.FileID + "," + v.Filename + "\n")
+	}
+	if m.Source != nil {
+		builder.WriteString("#source=" + m.Source.Source + "\n")
+		if m.Source.IP != "" {
+			builder.WriteString("#source_ip=" + m.Source.IP + "\n")
+		}
+		if m.Source.User != "" {
+			builder.WriteString("#source_user=" + m.Source.User + "\n")
+		}
+	}
+	if m.Storage != "" {
+		builder.WriteString("#storage=" + m.Storage + "\n")
+	}
+	if !m.UploadedAt.IsZero() {
+		builder.WriteString("#uploaded_at=" + strconv.FormatInt(m.UploadedAt.Unix(), 10) + "\n")
+	}
+	for _, fid := range m.Chunks {
+		builder.WriteString(fid + "\n")
+	}
+	return builder.String()
+}
+
+// ParseManifest 解析 fileAll.txt 内容
+func ParseManifest(content string) (*Manifest, error) {
+	linesStr := strings.Split(strings.TrimSpace(content), "\n")
+
+	// 去掉空行
+	var cleanLines []string
+	for _, line := range linesStr {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			cleanLines = append(cleanLines, line)
+		}
+	}
+
+	if len(cleanLines) < 2 {
+		return nil, ErrBadManifest
+	}
+	m := &Manifest{Filename: cleanLines[0]}
+	for _, line := range cleanLines[1:] {
+		if !strings.HasPrefix(line, "#") {
+			m.Chunks = append(m.Chunks, line)
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, "#"), "=")
+		switch key {
+		case "sha256":
+			m.SHA256 = value
+		case "size":
+			m.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "codec":
+			m.Codec = value
+		case "chunk_sizes":
+			m.ChunkSizes = parseChunkSizes(value)
+		case "chunk_sha256":
+			m.ChunkHashes = strings.Split(value, ",")
+		case "source", "source_ip", "source_user":
+			if m.Source == nil {
+				m.Source = &Source{}
+			}
+			switch key {
+			case "source":
+				m.Source.Source = value
+			case "source_ip":
+				m.Source.IP = value
+			default:
+				m.Source.User = value
+			}
+		case "storage":
+			m.Storage = value
+		case "uploaded_at":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil && sec > 0 {
+				m.UploadedAt = time.Unix(sec, 0)
+			}
+		case "variant":
+			// 文件名放在最后，可以包含逗号
+			if parts := strings.SplitN(value, ",", 3); len(parts) == 3 {
+				m.Variants = append(m.Variants, Variant{Name: parts[0], FileID: parts[1], Filename: parts[2]})
+			}
+		}
+	}
+	if len(m.Chunks) == 0 {
+		return nil, ErrBadManifest
+	}
+	// 分块大小与分块数对不上时视为没有记录，退回按固定分块大小推算
+	if len(m.ChunkSizes) != len(m.Chunks) {
+		m.ChunkSizes = nil
+	}
+	if len(m.ChunkHashes) != len(m.Chunks) {
+		m.ChunkHashes = nil
+	}
+	return m, nil
+}
+
+func parseChunkSizes(value string) []int64 {
+	parts := strings.Split(value, ",")
+	sizes := make([]int64, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || n <= 0 {
+			return nil
+		}
+		sizes[i] = n
+	}
+	return sizes
+}
+
+// Caption 分块消息的说明文字：blob 后附带 JSON 元数据（所属上传、序号、总数等），
+// fileAll.txt 丢失时可以用 MTProto 客户端导出聊天记录，按说明文字重新拼出清单
+type Caption struct {
+	Upload string `json:"upload"`
+	Name   string `json:"name"`
+	Index  int    `json:"index"`
+	Total  int    `json:"total,omitempty"` // 流式上传时事先不知道总数，为 0
+	Size   int64  `json:"size"`
+	Codec  string `json:"codec,omitempty"`
+	SHA256 string `json:"sha256"` // 分块原始内容的 SHA-256
+}
+
+// CaptionLimit Telegram 消息说明文字的长度上限（字符数）
+const CaptionLimit = 1024
+
+func (c Caption) String() string {
+	for {
+		data, _ := json.Marshal(c)
+		caption := "blob " + string(data)
+		// 文件名过长时截断文件名，保证其余字段完整
+		if n := utf8.RuneCountInString(caption); n <= CaptionLimit || c.Name == "" {
+			return caption
+		}
+		runes := []rune(c.Name)
+		c.Name = string(runes[:len(runes)/2])
+	}
+}
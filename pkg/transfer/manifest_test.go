@@ -0,0 +1,133 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Manifest
+	}{
+		{"只有分块", Manifest{Filename: "a.bin", Chunks: []string{"f1"}}},
+		{"中文文件名", Manifest{Filename: "年度报告 2024.pdf", Chunks: []string{"f1", "f2"}}},
+		{"emoji 与空格", Manifest{Filename: "  📦 备份 (1).tar.gz", Chunks: []string{"f1"}}},
+		{"完整元数据", Manifest{
+			Filename:    "视频.mp4",
+			Chunks:      []string{"f1", "f2"},
+			SHA256:      "abc",
+			Size:        30,
+			Codec:       "gzip",
+			ChunkSizes:  []int64{20, 10},
+			ChunkHashes: []string{"h1", "h2"},
+			Variants:    []Variant{{Name: "preview", FileID: "p1", Filename: "预览,缩略图.jpg"}},
+			Source:      &Source{Source: "web", IP: "1.2.3.4", User: "张三"},
+			Storage:     "archive",
+			UploadedAt:  time.Unix(1700000000, 0),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseManifest(tt.m.String())
+			if err != nil {
+				t.Fatalf("ParseManifest: %v", err)
+			}
+			want := tt.m
+			// 文件名首尾空白在解析时被去掉
+			want.Filename = strings.TrimSpace(want.Filename)
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("ParseManifest(String()) =\n%+v\n期望\n%+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Manifest
+		wantErr error
+	}{
+		{"空内容", "", nil, ErrBadManifest},
+		{"只有文件名", "a.bin\n", nil, ErrBadManifest},
+		{"只有元数据", "a.bin\n#size=3\n", nil, ErrBadManifest},
+		{"空行与 CRLF", "\r\na.bin\r\n\r\nf1\r\nf2\r\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1", "f2"}}, nil},
+		{"未知元数据", "a.bin\n#future=1\nf1\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1"}}, nil},
+		{"分块大小数量不符", "a.bin\n#chunk_sizes=1,2\nf1\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1"}}, nil},
+		{"分块大小非法", "a.bin\n#chunk_sizes=0\nf1\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1"}}, nil},
+		{"分块哈希数量不符", "a.bin\n#chunk_sha256=h1,h2\nf1\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1"}}, nil},
+		{"上传时间非法", "a.bin\n#uploaded_at=-1\nf1\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1"}}, nil},
+		{"变体字段不足", "a.bin\n#variant=preview,p1\nf1\n", &Manifest{Filename: "a.bin", Chunks: []string{"f1"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseManifest(tt.content)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v，期望 %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseManifest = %+v，期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceString(t *testing.T) {
+	tests := []struct {
+		s    Source
+		want string
+	}{
+		{Source{Source: "bot"}, "bot"},
+		{Source{Source: "web", IP: "1.2.3.4"}, "web 1.2.3.4"},
+		{Source{Source: "web", IP: "1.2.3.4", User: "anonymous"}, "web 1.2.3.4 anonymous"},
+		{Source{Source: "bot", User: "李四"}, "bot 李四"},
+	}
+	for _, tt := range tests {
+		if got := tt.s.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q，期望 %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCaption(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{"ASCII", "report.pdf"},
+		{"中文", "年度报告.pdf"},
+		{"超长中文", strings.Repeat("文", 2000)},
+		{"超长 emoji", strings.Repeat("📷", 2000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Caption{Upload: "u1", Name: tt.filename, Index: 3, Total: 5, Size: 1 << 20, SHA256: strings.Repeat("0", 64)}
+			caption := c.String()
+			if n := utf8.RuneCountInString(caption); n > CaptionLimit {
+				t.Fatalf("说明文字 %d 个字符，超过上限 %d", n, CaptionLimit)
+			}
+			data, ok := strings.CutPrefix(caption, "blob ")
+			if !ok {
+				t.Fatalf("说明文字应以 blob 开头: %q", caption)
+			}
+			var got Caption
+			if err := json.Unmarshal([]byte(data), &got); err != nil {
+				t.Fatalf("元数据不是有效的 JSON: %v", err)
+			}
+			if !utf8.ValidString(got.Name) || !strings.HasPrefix(tt.filename, got.Name) {
+				t.Errorf("文件名 %q 不是原文件名的前缀", got.Name)
+			}
+			got.Name = c.Name
+			if got != c {
+				t.Errorf("其余字段 = %+v，期望 %+v", got, c)
+			}
+		})
+	}
+}
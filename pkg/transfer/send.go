@@ -0,0 +1,128 @@
+package transfer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bot 把分块文件发送到存储会话，返回 Telegram 的 file_id
+type Bot interface {
+	SendDocument(path, caption string) (fileID string, err error)
+}
+
+// Clock 提供当前时间，用于统计上传耗时
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock 使用系统时间
+var SystemClock Clock = systemClock{}
+
+// ChunkError 某个分块上传失败
+type ChunkError struct {
+	Index int
+	Err   error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("第 %d 个分块上传失败: %v", e.Index, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error { return e.Err }
+
+// Uploader 并发发送分块，除 Bot 外的字段均可为零值
+type Uploader struct {
+	Bot     Bot
+	Clock   Clock // 为 nil 时使用 SystemClock
+	Workers int   // 同时发送的分块数，小于 1 时按 1 处理
+
+	// Caption 生成分块消息的说明文字
+	Caption func(c Chunk, total int) string
+	// Resume 返回之前已经上传过的分块的 file_id，命中时跳过发送
+	Resume func(c Chunk) (fileID string, ok bool)
+	// BeforeSend 在发送前调用，可用于限速
+	BeforeSend func(c Chunk)
+	// AfterSend 发送成功后调用，返回错误时视为该分块上传失败，可用于校验、记录进度
+	AfterSend func(c Chunk, fileID string) error
+	// OnResult 每个分块发送结束（包括 AfterSend）后调用，err 为该分块最终的错误，elapsed 为耗时
+	OnResult func(c Chunk, err error, elapsed time.Duration)
+}
+
+// Upload 上传结果，FileIDs 与分块一一对应
+type Upload struct {
+	FileIDs []string
+	Resumed int
+	Elapsed time.Duration
+}
+
+// Upload 发送全部分块，任一分块失败时返回序号最小的 *ChunkError
+func (u *Uploader) Upload(chunks []Chunk) (*Upload, error) {
+	clock := u.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	workers := u.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	start := clock.Now()
+
+	fileIDs := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	resumed := make([]bool, len(chunks))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, c := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c Chunk) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if u.Resume != nil {
+				if fid, ok := u.Resume(c); ok {
+					fileIDs[i], resumed[i] = fid, true
+					return
+				}
+			}
+			if u.BeforeSend != nil {
+				u.BeforeSend(c)
+			}
+			caption := ""
+			if u.Caption != nil {
+				caption = u.Caption(c, len(chunks))
+			}
+			sendStart := clock.Now()
+			fid, err := u.Bot.SendDocument(c.Path, caption)
+			if err == nil && u.AfterSend != nil {
+				err = u.AfterSend(c, fid)
+			}
+			if u.OnResult != nil {
+				u.OnResult(c, err, clock.Now().Sub(sendStart))
+			}
+			if err != nil {
+				errs[i] = &ChunkError{Index: c.Index, Err: err}
+				return
+			}
+			fileIDs[i] = fid
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := &Upload{FileIDs: fileIDs, Elapsed: clock.Now().Sub(start)}
+	for _, ok := range resumed {
+		if ok {
+			result.Resumed++
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,172 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBot 记录收到的分块，按路径返回 file_id，fail 中的路径返回错误
+type fakeBot struct {
+	mu       sync.Mutex
+	sent     map[string]string // path -> caption
+	fail     map[string]error
+	inflight int
+	peak     int
+}
+
+func (b *fakeBot) SendDocument(path, caption string) (string, error) {
+	b.mu.Lock()
+	b.inflight++
+	b.peak = max(b.peak, b.inflight)
+	b.mu.Unlock()
+	time.Sleep(time.Millisecond)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inflight--
+	if err := b.fail[path]; err != nil {
+		return "", err
+	}
+	if b.sent == nil {
+		b.sent = make(map[string]string)
+	}
+	b.sent[path] = caption
+	return "fid:" + path, nil
+}
+
+// fakeClock 每次调用 Now 前进 1 秒，保证耗时总为正数
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func testChunks(n int) []Chunk {
+	chunks := make([]Chunk, n)
+	for i := range chunks {
+		chunks[i] = Chunk{Index: i, Path: fmt.Sprintf("blob_%d", i), Size: 4}
+	}
+	return chunks
+}
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  int
+		workers int
+		resumed map[int]bool
+	}{
+		{"单个分块", 1, 1, nil},
+		{"并发小于分块数", 5, 2, nil},
+		{"并发大于分块数", 3, 8, nil},
+		{"并发为零", 3, 0, nil},
+		{"部分续传", 4, 2, map[int]bool{0: true, 2: true}},
+		{"全部续传", 2, 2, map[int]bool{0: true, 1: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &fakeBot{}
+			var results sync.Map
+			u := &Uploader{
+				Bot:     bot,
+				Clock:   &fakeClock{},
+				Workers: tt.workers,
+				Caption: func(c Chunk, total int) string { return fmt.Sprintf("%d/%d", c.Index, total) },
+				Resume: func(c Chunk) (string, bool) {
+					if tt.resumed[c.Index] {
+						return "old:" + c.Path, true
+					}
+					return "", false
+				},
+				OnResult: func(c Chunk, err error, elapsed time.Duration) {
+					if err != nil || elapsed <= 0 {
+						t.Errorf("OnResult(%d) err = %v, elapsed = %v", c.Index, err, elapsed)
+					}
+					results.Store(c.Index, true)
+				},
+			}
+			chunks := testChunks(tt.chunks)
+			up, err := u.Upload(chunks)
+			if err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+			if len(up.FileIDs) != tt.chunks || up.Resumed != len(tt.resumed) || up.Elapsed <= 0 {
+				t.Fatalf("Upload = %+v", up)
+			}
+			for i, c := range chunks {
+				want, sent := "fid:"+c.Path, true
+				if tt.resumed[i] {
+					want, sent = "old:"+c.Path, false
+				}
+				if up.FileIDs[i] != want {
+					t.Errorf("FileIDs[%d] = %q，期望 %q", i, up.FileIDs[i], want)
+				}
+				caption, ok := bot.sent[c.Path]
+				if ok != sent {
+					t.Errorf("分块 %d 是否发送 = %v，期望 %v", i, ok, sent)
+				}
+				if ok && caption != fmt.Sprintf("%d/%d", i, tt.chunks) {
+					t.Errorf("分块 %d 说明文字 = %q", i, caption)
+				}
+				if _, ok := results.Load(i); ok != sent {
+					t.Errorf("分块 %d 是否调用 OnResult = %v，期望 %v", i, ok, sent)
+				}
+			}
+			if workers := max(tt.workers, 1); bot.peak > workers {
+				t.Errorf("同时发送 %d 个分块，超过并发数 %d", bot.peak, workers)
+			}
+		})
+	}
+}
+
+func TestUploadNoChunks(t *testing.T) {
+	up, err := (&Uploader{Bot: &fakeBot{}, Clock: &fakeClock{}}).Upload(nil)
+	if err != nil || len(up.FileIDs) != 0 || up.Resumed != 0 {
+		t.Fatalf("Upload(nil) = %+v, %v", up, err)
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	errSend := errors.New("send failed")
+	errVerify := errors.New("verify failed")
+	tests := []struct {
+		name      string
+		fail      map[string]error
+		verify    map[int]error
+		wantIndex int
+		wantErr   error
+	}{
+		{"发送失败", map[string]error{"blob_2": errSend}, nil, 2, errSend},
+		{"返回序号最小的错误", map[string]error{"blob_3": errSend, "blob_1": errSend}, nil, 1, errSend},
+		{"AfterSend 失败", nil, map[int]error{0: errVerify}, 0, errVerify},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Uploader{
+				Bot:     &fakeBot{fail: tt.fail},
+				Clock:   &fakeClock{},
+				Workers: 2,
+				AfterSend: func(c Chunk, fileID string) error {
+					return tt.verify[c.Index]
+				},
+			}
+			up, err := u.Upload(testChunks(4))
+			if up != nil {
+				t.Errorf("失败时不应返回结果: %+v", up)
+			}
+			var ce *ChunkError
+			if !errors.As(err, &ce) || ce.Index != tt.wantIndex || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v，期望第 %d 个分块的 %v", err, tt.wantIndex, tt.wantErr)
+			}
+		})
+	}
+}
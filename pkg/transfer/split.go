@@ -0,0 +1,94 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrEmptyFile 没有读到任何内容，空文件无法生成有效的清单
+var ErrEmptyFile = errors.New("文件为空")
+
+// Chunk 写入临时目录的单个分块
+type Chunk struct {
+	Index  int
+	Path   string
+	Size   int64  // 编码前的字节数
+	SHA256 string // 编码前内容的 SHA-256
+}
+
+// Splitter 把文件切分为固定大小的分块并写入 Dir
+type Splitter struct {
+	ChunkSize int
+	Dir       string
+	// Codec 根据第一块内容决定整个文件使用的编码，为 nil 或返回空字符串时原样存储
+	Codec func(first []byte) string
+	// Encode 按编码转换分块内容，Codec 返回非空时必须设置
+	Encode func(codec string, data []byte) ([]byte, error)
+}
+
+// Split 切分结果
+type Split struct {
+	Chunks []Chunk
+	Codec  string
+	Size   int64
+	SHA256 string // 整个文件的 SHA-256
+}
+
+// Split 读取 r 直到结束，依次写出 blob_0、blob_1……
+func (s Splitter) Split(r io.Reader) (*Split, error) {
+	if s.ChunkSize <= 0 {
+		return nil, fmt.Errorf("分块大小无效: %d", s.ChunkSize)
+	}
+	result := &Split{}
+	hasher := sha256.New()
+	buf := make([]byte, s.ChunkSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, fmt.Errorf("读取文件失败: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		if index == 0 && s.Codec != nil {
+			result.Codec = s.Codec(buf[:n])
+		}
+		data := buf[:n]
+		if result.Codec != "" {
+			if data, err = s.Encode(result.Codec, buf[:n]); err != nil {
+				return nil, fmt.Errorf("压缩分块失败: %v", err)
+			}
+		}
+		chunkPath := filepath.Join(s.Dir, fmt.Sprintf("blob_%d", index))
+		if err := os.WriteFile(chunkPath, data, 0644); err != nil {
+			return nil, fmt.Errorf("写入临时分块失败: %v", err)
+		}
+		hasher.Write(buf[:n])
+		sum := sha256.Sum256(buf[:n])
+		result.Chunks = append(result.Chunks, Chunk{Index: index, Path: chunkPath, Size: int64(n), SHA256: hex.EncodeToString(sum[:])})
+		result.Size += int64(n)
+		if n < s.ChunkSize {
+			break
+		}
+	}
+	if len(result.Chunks) == 0 {
+		return nil, ErrEmptyFile
+	}
+	result.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return result, nil
+}
+
+// Manifest 根据切分结果和各分块的 file_id 构建清单
+func (s *Split) Manifest(filename string, fileIDs []string) *Manifest {
+	m := &Manifest{Filename: filename, Chunks: fileIDs, SHA256: s.SHA256, Size: s.Size, Codec: s.Codec}
+	for _, c := range s.Chunks {
+		m.ChunkSizes = append(m.ChunkSizes, c.Size)
+		m.ChunkHashes = append(m.ChunkHashes, c.SHA256)
+	}
+	return m
+}
@@ -0,0 +1,136 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		chunkSize int
+		want      []int64 // 每个分块的字节数
+	}{
+		{"小于分块大小", 3, 4, []int64{3}},
+		{"恰好一个分块", 4, 4, []int64{4}},
+		{"恰好两个分块", 8, 4, []int64{4, 4}},
+		{"最后一块不满", 9, 4, []int64{4, 4, 1}},
+		{"一字节分块", 3, 1, []int64{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			dir := t.TempDir()
+			split, err := Splitter{ChunkSize: tt.chunkSize, Dir: dir}.Split(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			if len(split.Chunks) != len(tt.want) {
+				t.Fatalf("分块数 = %d，期望 %d", len(split.Chunks), len(tt.want))
+			}
+			if split.Size != int64(tt.size) || split.SHA256 != sha256Hex(data) || split.Codec != "" {
+				t.Errorf("Split = {Size: %d, SHA256: %s, Codec: %q}", split.Size, split.SHA256, split.Codec)
+			}
+			var joined []byte
+			for i, c := range split.Chunks {
+				if c.Index != i || c.Size != tt.want[i] || c.Path != filepath.Join(dir, fmt.Sprintf("blob_%d", i)) {
+					t.Errorf("分块 %d = %+v", i, c)
+				}
+				got, err := os.ReadFile(c.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.SHA256 != sha256Hex(got) {
+					t.Errorf("分块 %d SHA256 不匹配", i)
+				}
+				joined = append(joined, got...)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Error("分块拼接后与原文件不一致")
+			}
+		})
+	}
+}
+
+func TestSplitEmpty(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Splitter{ChunkSize: 4, Dir: dir}.Split(bytes.NewReader(nil))
+	if !errors.Is(err, ErrEmptyFile) {
+		t.Fatalf("err = %v，期望 ErrEmptyFile", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("空文件不应写出分块，实际 %d 个", len(entries))
+	}
+}
+
+func TestSplitInvalidChunkSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		if _, err := (Splitter{ChunkSize: size, Dir: t.TempDir()}).Split(bytes.NewReader([]byte("x"))); err == nil {
+			t.Errorf("ChunkSize=%d 应返回错误", size)
+		}
+	}
+}
+
+func TestSplitCodec(t *testing.T) {
+	data := []byte("hello world")
+	var firsts [][]byte
+	s := Splitter{
+		ChunkSize: 4,
+		Dir:       t.TempDir(),
+		Codec: func(first []byte) string {
+			firsts = append(firsts, append([]byte(nil), first...))
+			return "rev"
+		},
+		Encode: func(codec string, data []byte) ([]byte, error) {
+			out := make([]byte, len(data))
+			for i, b := range data {
+				out[len(data)-1-i] = b
+			}
+			return out, nil
+		},
+	}
+	split, err := s.Split(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(firsts) != 1 || string(firsts[0]) != "hell" {
+		t.Errorf("Codec 应只用第一块调用一次，实际 %q", firsts)
+	}
+	if split.Codec != "rev" || split.Size != int64(len(data)) || split.SHA256 != sha256Hex(data) {
+		t.Errorf("Split = %+v", split)
+	}
+	// 分块文件为编码后的内容，Size 与 SHA256 仍对应编码前的内容
+	got, _ := os.ReadFile(split.Chunks[0].Path)
+	if string(got) != "lleh" || split.Chunks[0].SHA256 != sha256Hex([]byte("hell")) {
+		t.Errorf("分块 0 = %q, %+v", got, split.Chunks[0])
+	}
+}
+
+func TestSplitManifest(t *testing.T) {
+	split, err := Splitter{ChunkSize: 4, Dir: t.TempDir()}.Split(bytes.NewReader([]byte("abcdefghij")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := split.Manifest("照片 📷.jpg", []string{"a", "b", "c"})
+	if m.Filename != "照片 📷.jpg" || m.Size != 10 || m.SHA256 != split.SHA256 {
+		t.Errorf("Manifest = %+v", m)
+	}
+	if len(m.ChunkSizes) != 3 || m.ChunkSizes[2] != 2 || len(m.ChunkHashes) != 3 || m.ChunkHashes[0] != sha256Hex([]byte("abcd")) {
+		t.Errorf("ChunkSizes = %v, ChunkHashes = %v", m.ChunkSizes, m.ChunkHashes)
+	}
+}
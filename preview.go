@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// 单个文件的预览设置
+const (
+	previewAuto       = "auto"       // 按预览规则
+	previewInline     = "inline"     // 总是内联
+	previewAttachment = "attachment" // 总是下载
+)
+
+// previewOverrideStore 单个文件的预览设置，按 profile/file_id 保存在 JSON 文件中，没有记录即为 auto
+type previewOverrideStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]string
+}
+
+func loadPreviewOverrideStore(path string) (*previewOverrideStore, error) {
+	st := &previewOverrideStore{path: path, items: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取预览设置失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.items); err != nil {
+		return nil, fmt.Errorf("解析预览设置失败: %v", err)
+	}
+	return st, nil
+}
+
+func (st *previewOverrideStore) get(profile, fileID string) string {
+	if st == nil {
+		return previewAuto
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if mode, ok := st.items[profile+"/"+fileID]; ok {
+		return mode
+	}
+	return previewAuto
+}
+
+// set 保存预览设置，auto 删除记录
+func (st *previewOverrideStore) set(profile, fileID, mode string) error {
+	if st == nil {
+		return errors.New("未开启单个文件的预览设置")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + fileID
+	old, had := st.items[key]
+	if mode == previewAuto {
+		delete(st.items, key)
+	} else {
+		st.items[key] = mode
+	}
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		if had {
+			st.items[key] = old
+		} else {
+			delete(st.items, key)
+		}
+		return fmt.Errorf("保存预览设置失败: %v", err)
+	}
+	return nil
+}
+
+// previewByDefault 未带 dl、inline 参数时文件是否内联展示：单个文件的设置优先，其次按预览规则，
+// 分块大文件只有 PDF 默认内联
+func (p *profile) previewByDefault(fileID, filename, contentType string, chunked bool) bool {
+	switch p.srv.previewOverrides.get(p.Name, fileID) {
+	case previewInline:
+		return true
+	case previewAttachment:
+		return false
+	}
+	if chunked {
+		return p.srv.mimeTypes.isInlineChunked(filename, contentType)
+	}
+	return p.srv.mimeTypes.isPreviewable(filename, contentType)
+}
+
+// handlePreviewSetting /api/files/{id}/preview：GET 返回该文件的预览设置，
+// PUT 修改（请求体 {"mode":"inline|attachment|auto"}），需要访问密码
+func (p *profile) handlePreviewSetting(w http.ResponseWriter, r *http.Request, fileID string) {
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
+			(req.Mode != previewAuto && req.Mode != previewInline && req.Mode != previewAttachment) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体应为 {\"mode\":\"inline|attachment|auto\"}", nil)
+			return
+		}
+		if err := p.srv.previewOverrides.set(p.Name, fileID, req.Mode); err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET、PUT", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"mode": p.srv.previewOverrides.get(p.Name, fileID), "force_download": p.srv.mimeTypes.forceDownload})
+}
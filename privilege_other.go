@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+// setUmask 其他平台没有 umask
+func setUmask(mask int) error {
+	return errors.New("UMASK 仅在 Linux、macOS、FreeBSD 上生效")
+}
+
+// dropPrivileges 其他平台不支持切换用户
+func dropPrivileges(name string) error {
+	return errors.New("-user 仅在 Linux、macOS、FreeBSD 上生效")
+}
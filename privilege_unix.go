@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// setUmask 设置进程的 umask，之后创建的临时目录、分块文件、存储文件都按该掩码去掉权限位
+func setUmask(mask int) error {
+	syscall.Umask(mask)
+	return nil
+}
+
+// dropPrivileges 以 root 启动时切换到指定用户（用户名或 UID），先清空附加组再依次切换 GID、UID
+func dropPrivileges(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return fmt.Errorf("找不到用户 %s", name)
+		}
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("用户 %s 的 UID 无效: %s", name, u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("用户 %s 的 GID 无效: %s", name, u.Gid)
+	}
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("清空附加组失败: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("切换到 GID %d 失败: %v", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("切换到 UID %d 失败: %v", uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// profile 一套独立的 Bot/Chat/密码配置，多租户模式下每个 profile 挂载在自己的路径前缀或域名下
+type profile struct {
+	Name       string `json:"name"`
+	BotToken   string `json:"bot_token"`
+	ChatID     int64  `json:"chat_id"`
+	AccessPwd  string `json:"access_pwd"`
+	BaseURL    string `json:"base_url"`
+	PathPrefix string `json:"path_prefix"` // 例如 /alice，为空表示挂载在根路径
+	Host       string `json:"host"`        // 按域名区分时填写，例如 alice.example.com
+
+	// DownloadTokenSecret 非空时 /d 必须带上由该密钥生成的 token 参数，仅凭 file_id 无法下载
+	DownloadTokenSecret string `json:"download_token_secret"`
+	// DownloadAuth 为 true 时为私有实例，/d 与 /api 也需要访问密码或登录 Cookie
+	DownloadAuth bool `json:"download_auth"`
+	// PublicUpload 为 true 时允许不带密码上传，匿名上传的文件审核通过后才能下载
+	PublicUpload bool `json:"public_upload"`
+	// StorageChats 上传时通过 storage 参数选择的其他存储会话，名称到 chat_id，不从全局配置继承
+	StorageChats map[string]int64 `json:"storage_chats"`
+	// AdminUserIDs 除 ChatID 外可以使用管理命令的 Telegram 用户，不从全局配置继承
+	AdminUserIDs []int64 `json:"admin_user_ids"`
+	// AllowedUserIDs 除 ChatID 与管理员外允许通过 Telegram 登录的用户，不从全局配置继承
+	AllowedUserIDs []int64 `json:"allowed_user_ids"`
+
+	srv     *server // 所属的服务实例，提供各 profile 共享的缓存、任务日志等
+	bot     *tgbotapi.BotAPI
+	ready   chan struct{} // Bot 初始化完成后关闭
+	handler http.Handler
+
+	// pairCode 非空时为配对模式，Bot 连接后等待 /pair 命令确定 ChatID，结果保存到 pairPath
+	pairCode     string
+	pairPath     string
+	pairedUserID int64 // 配对时发送 /pair 的用户，与 AdminUserIDs 一样可以使用管理命令
+
+	uploadsPaused atomic.Bool            // 通过 /pause-uploads 命令暂停上传
+	runtimeBase   atomic.Pointer[string] // 通过 /setbase 命令设置的链接地址
+	seenBase      atomic.Pointer[string] // 未配置 BASE_URL 时最近一次登录后访问的地址
+	quota         *uploadQuota
+	events        *eventHub
+}
+
+// loadProfiles 读取多租户配置文件（JSON 数组），未单独配置的下载令牌密钥、私有下载模式、公开上传沿用 defaults 中的全局配置
+func loadProfiles(path string, defaults *profile) ([]*profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取多租户配置失败: %v", err)
+	}
+	var profiles []*profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("解析多租户配置失败: %v", err)
+	}
+	for i, p := range profiles {
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("profile-%d", i+1)
+		}
+		if p.BotToken == "" || p.AccessPwd == "" || p.ChatID == 0 {
+			return nil, fmt.Errorf("profile %s 缺少 bot_token、access_pwd 或 chat_id", p.Name)
+		}
+		if p.PathPrefix != "" {
+			p.PathPrefix = "/" + strings.Trim(p.PathPrefix, "/")
+		}
+		if p.DownloadTokenSecret == "" {
+			p.DownloadTokenSecret = defaults.DownloadTokenSecret
+		}
+		p.DownloadAuth = p.DownloadAuth || defaults.DownloadAuth
+		p.PublicUpload = p.PublicUpload || defaults.PublicUpload
+	}
+	return profiles, nil
+}
+
+// init 初始化该 profile 的 Bot，client 为 nil 时使用默认 HTTP 客户端
+func (p *profile) init(client *http.Client) error {
+	var err error
+	if client != nil {
+		p.bot, err = tgbotapi.NewBotAPIWithClient(p.BotToken, tgbotapi.APIEndpoint, client)
+	} else {
+		p.bot, err = tgbotapi.NewBotAPI(p.BotToken)
+	}
+	if err != nil {
+		return err
+	}
+	// 不绑定具体请求的调用（机器人消息、上传等）也受 TELEGRAM_TIMEOUT 限制
+	p.bot.Client = contextClient{ctx: context.Background(), next: p.bot.Client, breaker: p.srv.breaker, timeout: p.srv.telegramTimeout}
+	return nil
+}
+
+// profileRouter 先按域名、再按最长路径前缀把请求分发给对应 profile，
+// 都不匹配时交给未设置域名和前缀的默认 profile
+type profileRouter struct {
+	byHost   map[string]*profile
+	byPrefix []*profile
+	fallback *profile
+}
+
+func newProfileRouter(profiles []*profile) (*profileRouter, error) {
+	pr := &profileRouter{byHost: make(map[string]*profile)}
+	for _, p := range profiles {
+		switch {
+		case p.Host != "":
+			host := strings.ToLower(p.Host)
+			if _, dup := pr.byHost[host]; dup {
+				return nil, fmt.Errorf("域名 %s 被多个 profile 使用", p.Host)
+			}
+			pr.byHost[host] = p
+		case p.PathPrefix != "":
+			for _, other := range pr.byPrefix {
+				if other.PathPrefix == p.PathPrefix {
+					return nil, fmt.Errorf("路径前缀 %s 被多个 profile 使用", p.PathPrefix)
+				}
+			}
+			pr.byPrefix = append(pr.byPrefix, p)
+		default:
+			if pr.fallback != nil {
+				return nil, fmt.Errorf("profile %s 与 %s 都未设置 host 和 path_prefix", pr.fallback.Name, p.Name)
+			}
+			pr.fallback = p
+		}
+	}
+	sort.Slice(pr.byPrefix, func(i, j int) bool {
+		return len(pr.byPrefix[i].PathPrefix) > len(pr.byPrefix[j].PathPrefix)
+	})
+	return pr, nil
+}
+
+func (pr *profileRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if p, ok := pr.byHost[strings.ToLower(host)]; ok {
+		p.handler.ServeHTTP(w, r)
+		return
+	}
+
+	for _, p := range pr.byPrefix {
+		if r.URL.Path == p.PathPrefix {
+			http.Redirect(w, r, p.PathPrefix+"/", http.StatusMovedPermanently)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, p.PathPrefix+"/") {
+			http.StripPrefix(p.PathPrefix, p.handler).ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if pr.fallback != nil {
+		pr.fallback.handler.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// passwordPage 私有实例中浏览器直接打开下载链接时显示的密码页，提交到 /verify，
+// 校验通过后下发登录 Cookie 并跳回原链接继续下载
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>需要访问密码</title>
+    <style>
+        body { margin: 0; font-family: sans-serif; background: #f5f5f5; color: #333; }
+        form { max-width: 320px; margin: 15vh auto 0; padding: 24px; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+        h1 { font-size: 18px; margin: 0 0 16px; }
+        input { box-sizing: border-box; width: 100%; padding: 10px; margin-bottom: 12px; font-size: 16px; border: 1px solid #ccc; border-radius: 4px; }
+        button { width: 100%; padding: 10px; font-size: 16px; border: 0; border-radius: 4px; background: #2481cc; color: #fff; }
+        .error { color: #d33; font-size: 14px; margin-bottom: 12px; }
+    </style>
+</head>
+<body>
+<form method="post" action="{{.Action}}" enctype="multipart/form-data">
+    <h1>下载需要访问密码</h1>
+    {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+    <input type="password" name="pwd" placeholder="访问密码" autofocus required>
+    <input type="hidden" name="next" value="{{.Next}}">
+    <button type="submit">继续下载</button>
+</form>
+</body>
+</html>
+`))
+
+// wantsHTML 是否为浏览器（包括移动端 WebView）直接打开的页面请求，脚本与下载工具仍收到普通的 401
+func wantsHTML(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// writePasswordPage 返回密码页，状态码仍为 401；next 为校验通过后跳回的原链接
+func (p *profile) writePasswordPage(w http.ResponseWriter, next, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusUnauthorized)
+	data := struct{ Action, Next, Error string }{p.PathPrefix + "/verify", next, errMsg}
+	if err := passwordPage.Execute(w, data); err != nil {
+		log.Printf("渲染密码页失败: %v", err)
+	}
+}
+
+// safeRedirect 只允许跳回站内路径，避免 /verify 被用作开放重定向
+func safeRedirect(next string) bool {
+	return strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\")
+}
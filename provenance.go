@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"tg-disk/pkg/transfer"
+)
+
+// 文件来源
+const (
+	sourceWeb     = "web"         // 网页或 /upload 接口上传
+	sourceBot     = "bot"         // 直接发送给机器人
+	sourceForward = "bot_forward" // 从其他会话转发给机器人
+	sourceLink    = "upload_link" // 通过 /u/{token} 上传链接上传，用户为链接的标签
+)
+
+// provenance 文件进入系统的方式，分块上传时记录在 fileAll.txt 中
+type provenance = transfer.Source
+
+// uploadProvenance 通过 HTTP 上传的文件来源
+func uploadProvenance(r *http.Request, anonymous bool) provenance {
+	pv := provenance{Source: sourceWeb, IP: clientIP(r)}
+	if l := uploadLinkFrom(r); l != nil {
+		pv.Source, pv.User = sourceLink, l.Label
+	} else if anonymous {
+		pv.User = "anonymous"
+	}
+	return pv
+}
+
+// messageProvenance 根据 Telegram 消息推断来源，机器人自己发出的消息（网页上传）返回 nil
+func messageProvenance(msg *tgbotapi.Message) *provenance {
+	if msg == nil || msg.From == nil || msg.From.IsBot {
+		return nil
+	}
+	pv := &provenance{Source: sourceBot, User: msg.From.UserName}
+	switch {
+	case msg.ForwardFrom != nil:
+		pv.Source = sourceForward
+		pv.User = msg.ForwardFrom.UserName
+	case msg.ForwardFromChat != nil:
+		pv.Source = sourceForward
+		pv.User = msg.ForwardFromChat.UserName
+	case msg.ForwardSenderName != "":
+		pv.Source = sourceForward
+		pv.User = msg.ForwardSenderName
+	}
+	return pv
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 分块消息记录：每发送一个分块，在 UPLOAD_WAL_DIR 下该 profile、存储会话与 upload_id 对应的 .msgs 文件追加一行「chat_id message_id」，
+// 上传成功后删除。上传失败或中断时留下的记录用于 /purge 删除这些不会被任何清单引用的分块消息，
+// 超过 TEMP_MAX_AGE 未更新的记录与上传日志一起被清理
+var chunkMessagesMu sync.Mutex
+
+// recordChunkMessage 记录上传发出的分块消息，写入失败只记日志，不影响上传
+func (p *profile) recordChunkMessage(uploadID string, chatID int64, messageID int) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return
+	}
+	chunkMessagesMu.Lock()
+	defer chunkMessagesMu.Unlock()
+	if err := os.MkdirAll(walDir, 0700); err != nil {
+		log.Printf("记录分块消息失败（%s）: %v", uploadID, err)
+		return
+	}
+	f, err := os.OpenFile(p.uploadFile(uploadID, chatID, ".msgs"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("记录分块消息失败（%s）: %v", uploadID, err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%d %d\n", chatID, messageID)
+}
+
+// forgetChunkMessages 上传成功后删除分块消息记录，之后 /purge 不会再删除这些分块
+func (p *profile) forgetChunkMessages(uploadID string, chatID int64) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return
+	}
+	chunkMessagesMu.Lock()
+	defer chunkMessagesMu.Unlock()
+	os.Remove(p.uploadFile(uploadID, chatID, ".msgs"))
+}
+
+type chunkMessage struct {
+	chatID    int64
+	messageID int
+}
+
+// purgeUpload 删除该上传在该 profile 各存储会话中发出的全部分块消息，并删除消息记录与上传日志，
+// 返回删除成功与失败的消息数。没有记录时（上传已成功或已被清理）返回错误
+func (p *profile) purgeUpload(uploadID string) (deleted, failed int, err error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return 0, 0, fmt.Errorf("upload_id 格式错误: %s", uploadID)
+	}
+	// 进行中的上传还会继续发送分块，此时清理会留下漏删的消息，也会让续传引用已删除的分块
+	unlock, err := p.lockUpload(uploadID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+	chunkMessagesMu.Lock()
+	defer chunkMessagesMu.Unlock()
+	chats := []int64{p.ChatID}
+	for _, id := range p.StorageChats {
+		if !slices.Contains(chats, id) {
+			chats = append(chats, id)
+		}
+	}
+	var ids []chunkMessage
+	var paths []string
+	for _, chatID := range chats {
+		path := p.uploadFile(uploadID, chatID, ".msgs")
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("读取分块记录失败: %v", err)
+		}
+		paths = append(paths, path, p.uploadFile(uploadID, chatID, ".wal"))
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			chat, msg, ok := strings.Cut(sc.Text(), " ")
+			if !ok {
+				continue
+			}
+			if id, err := strconv.Atoi(msg); err == nil && chat == strconv.FormatInt(chatID, 10) {
+				ids = append(ids, chunkMessage{chatID, id})
+			}
+		}
+		f.Close()
+	}
+	if len(paths) == 0 {
+		return 0, 0, fmt.Errorf("没有 %s 的分块记录，上传可能已经成功或记录已被清理", uploadID)
+	}
+	if len(ids) == 0 {
+		return 0, 0, fmt.Errorf("%s 没有发送到当前存储会话的分块", uploadID)
+	}
+
+	for _, m := range ids {
+		if _, err := p.bot.Request(tgbotapi.NewDeleteMessage(m.chatID, m.messageID)); err != nil {
+			log.Printf("删除分块消息 %d 失败（%s）: %v", m.messageID, uploadID, err)
+			failed++
+			continue
+		}
+		deleted++
+	}
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	return deleted, failed, nil
+}
+
+// purgeCommand 处理 /purge <upload_id> 命令
+func (p *profile) purgeCommand(args []string) string {
+	if len(args) == 0 {
+		return "用法：/purge upload_id（上传失败时响应的 X-Upload-Id，也可在任务日志中查看）"
+	}
+	deleted, failed, err := p.purgeUpload(args[0])
+	if err != nil {
+		return err.Error()
+	}
+	reply := fmt.Sprintf("已删除 %s 的 %d 个分块消息", args[0], deleted)
+	if failed > 0 {
+		reply += fmt.Sprintf("，%d 个删除失败（机器人需要删除消息的权限，私聊中只能删除 48 小时内的消息）", failed)
+	}
+	return reply
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// uploadQuota 每日上传额度，按服务器本地日期在零点重置，limit 为 0 表示不限制
+type uploadQuota struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	day   string
+}
+
+func newUploadQuota(limit int64) *uploadQuota {
+	return &uploadQuota{limit: limit, day: time.Now().Format("2006-01-02")}
+}
+
+func (q *uploadQuota) rollover() {
+	if today := time.Now().Format("2006-01-02"); today != q.day {
+		q.day = today
+		q.used = 0
+	}
+}
+
+// allow 本次上传 n 字节后是否仍在额度内
+func (q *uploadQuota) allow(n int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	return q.limit == 0 || q.used+n <= q.limit
+}
+
+// add 记录上传成功的字节数
+func (q *uploadQuota) add(n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	q.used += n
+}
+
+func (q *uploadQuota) setLimit(limit int64) {
+	q.mu.Lock()
+	q.limit = limit
+	q.mu.Unlock()
+}
+
+// usage 返回今日已用字节数和额度
+func (q *uploadQuota) usage() (used, limit int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	return q.used, q.limit
+}
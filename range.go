@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// parseRange 解析单段 Range 头（bytes=start-end / bytes=start- / bytes=-suffix），
+// 返回闭区间 [start, end]，不支持多段范围
+func parseRange(header string, size int64) (start, end int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") || size <= 0 {
+		return 0, 0, false
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+	startStr = strings.TrimSpace(startStr)
+	endStr = strings.TrimSpace(endStr)
+
+	if startStr == "" {
+		// 后缀范围：最后 N 个字节
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// chunkedSize 计算分块文件总大小：优先使用清单中记录的大小，
+// 旧清单除最后一块外均为 chunkSize，只需查询最后一块的大小
+func chunkedSize(bot *tgbotapi.BotAPI, m *manifest) (int64, error) {
+	if m.Size > 0 {
+		return m.Size, nil
+	}
+	if m.ChunkSizes != nil {
+		var total int64
+		for _, n := range m.ChunkSizes {
+			total += n
+		}
+		return total, nil
+	}
+	blobFileIDs := m.Chunks
+	last, err := bot.GetFile(tgbotapi.FileConfig{FileID: blobFileIDs[len(blobFileIDs)-1]})
+	if err != nil {
+		return 0, fmt.Errorf("获取分块 %s 失败: %v", blobFileIDs[len(blobFileIDs)-1], err)
+	}
+	return int64(len(blobFileIDs)-1)*chunkSize + int64(last.FileSize), nil
+}
+
+// chunkOffsets 每个分块在文件中的起始偏移，最后追加文件总大小，
+// 清单记录了分块大小时按实际大小累加，否则按固定的 chunkSize 推算
+func chunkOffsets(m *manifest, size int64) []int64 {
+	offsets := make([]int64, len(m.Chunks)+1)
+	for i := range m.Chunks {
+		if m.ChunkSizes != nil {
+			offsets[i+1] = offsets[i] + m.ChunkSizes[i]
+		} else {
+			offsets[i+1] = int64(i+1) * chunkSize
+		}
+	}
+	offsets[len(m.Chunks)] = size
+	return offsets
+}
+
+// serveChunkedRange 将 Range 请求映射到对应的分块及块内偏移，只拉取覆盖该范围的分块，
+// 调用前需已设置 Content-Type 与 Content-Disposition。分块下载失败时返回 *chunkErrors
+func (p *profile) serveChunkedRange(bot *tgbotapi.BotAPI, w http.ResponseWriter, r *http.Request, m *manifest) error {
+	size, err := chunkedSize(bot, m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	start, end, ok := parseRange(r.Header.Get("Range"), size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, "Range 参数无效", http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	offsets := chunkOffsets(m, size)
+	first := sort.Search(len(m.Chunks), func(i int) bool { return offsets[i+1] > start })
+	errs := make([]error, len(m.Chunks))
+	failed := false
+	for i := first; i < len(m.Chunks) && offsets[i] <= end; i++ {
+		data, err := p.fetchChunkWithRetry(bot, m.Chunks[i], m.Codec)
+		if err != nil {
+			errs[i], failed = err, true
+			continue
+		}
+		// 已有分块失败时只继续确认范围内其余分块，不再写出
+		if failed {
+			continue
+		}
+		chunkStart := offsets[i]
+		from := int64(0)
+		if start > chunkStart {
+			from = start - chunkStart
+		}
+		to := int64(len(data))
+		if end+1-chunkStart < to {
+			to = end + 1 - chunkStart
+		}
+		if from >= to {
+			continue
+		}
+		if _, err := w.Write(data[from:to]); err != nil {
+			return nil
+		}
+	}
+	if err := collectChunkErrors(errs); err != nil {
+		// 响应头已发出，只能中断连接
+		reqLog(r, "范围下载失败: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// connect 在后台初始化 Bot，Telegram 不可达（例如代理容器尚未就绪）时按指数退避重试，
+// 期间 Web 页面照常提供，依赖 Bot 的接口返回 503
+func (p *profile) connect(client *http.Client) {
+	backoff := time.Second
+	for {
+		err := p.init(client)
+		if err == nil {
+			break
+		}
+		log.Printf("初始化 Bot 失败（%s），%v 后重试: %v", p.Name, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+	if p.pairCode != "" {
+		p.waitForPairing()
+	}
+	close(p.ready)
+	log.Printf("Bot 已连接（%s）: @%s", p.Name, p.bot.Self.UserName)
+	p.listenUpdates()
+}
+
+// isReady Bot 是否已初始化完成，ready 关闭后读取 p.bot 不存在数据竞争
+func (p *profile) isReady() bool {
+	select {
+	case <-p.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// requireBot Bot 尚未连接或 Telegram 熔断时直接返回 503
+func (p *profile) requireBot(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.isReady() {
+			w.Header().Set("Retry-After", "10")
+			writeError(w, r, http.StatusServiceUnavailable, errCodeUnavailable, "Telegram 尚未连接，请稍后重试")
+			return
+		}
+		if p.srv.breaker.rejecting() {
+			w.Header().Set("Retry-After", strconv.Itoa(p.srv.breaker.retryAfter()))
+			writeError(w, r, http.StatusServiceUnavailable, errCodeUnavailable, errTelegramUnreachable.Error())
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleReadyz 所有 profile 的 Bot 均已连接且 Telegram 未熔断时返回 200，否则返回 503 并列出各 profile 状态，
+// telegram 为 ok 或 unreachable
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := "ok"
+	states := make(map[string]string, len(s.profiles))
+	for _, p := range s.profiles {
+		if p.isReady() {
+			states[p.Name] = "ok"
+		} else {
+			states[p.Name] = "connecting"
+			status = "degraded"
+		}
+	}
+	telegram := "ok"
+	if s.breaker.isOpen() {
+		telegram, status = "unreachable", "degraded"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "profiles": states, "telegram": telegram})
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 举报状态：下架后文件的所有链接都不能再下载，删除时还会删除 Telegram 中已知的文件消息
+const (
+	reportPending   = "pending"
+	reportDisabled  = "disabled"
+	reportDeleted   = "deleted"
+	reportDismissed = "dismissed"
+)
+
+// reportReasonLimit 举报理由的最大字符数
+const reportReasonLimit = 500
+
+var errReportNotFound = errors.New("举报不存在或已处理")
+
+// reportItem 针对某个分享链接的滥用举报
+type reportItem struct {
+	ID        string    `json:"id"` // 短 ID，用于内联按钮的回调数据
+	Profile   string    `json:"profile"`
+	FileID    string    `json:"file_id"`
+	Filename  string    `json:"filename,omitempty"`
+	URL       string    `json:"url"`
+	Reason    string    `json:"reason"`
+	ClientIP  string    `json:"client_ip"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	HandledAt time.Time `json:"handled_at"`
+	Parts     []string  `json:"parts,omitempty"` // 下架分块文件时，清单引用的分块与变体
+}
+
+// reportStore 举报记录，保存在 JSON 文件中，重启后已下架的文件仍不能下载
+type reportStore struct {
+	mu      sync.Mutex
+	path    string
+	items   map[string]*reportItem
+	blocked map[string]string // file_id（含下架清单的分块、变体）-> 下架或删除
+}
+
+func loadReportStore(path string) (*reportStore, error) {
+	st := &reportStore{path: path, items: make(map[string]*reportItem), blocked: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取举报记录失败: %v", err)
+	}
+	var items []*reportItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("解析举报记录失败: %v", err)
+	}
+	for _, it := range items {
+		st.items[it.ID] = it
+		if it.Status == reportDisabled || it.Status == reportDeleted {
+			st.blocked[it.FileID] = it.Status
+			for _, part := range it.Parts {
+				st.blocked[part] = it.Status
+			}
+		}
+	}
+	return st, nil
+}
+
+// save 保存举报记录，调用方需持有锁
+func (st *reportStore) save() error {
+	items := make([]*reportItem, 0, len(st.items))
+	for _, it := range st.items {
+		items = append(items, it)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return writeJSONFile(st.path, items)
+}
+
+// add 记录举报，文件已下架或同一 IP 对同一文件还有未处理的举报时不重复记录，返回 false
+func (st *reportStore) add(it *reportItem) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.blocked[it.FileID] != "" {
+		return false, nil
+	}
+	for _, old := range st.items {
+		if old.Status == reportPending && old.Profile == it.Profile && old.FileID == it.FileID && old.ClientIP == it.ClientIP {
+			return false, nil
+		}
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	it.ID = hex.EncodeToString(b)
+	it.Status = reportPending
+	it.CreatedAt = time.Now()
+	st.items[it.ID] = it
+	if err := st.save(); err != nil {
+		delete(st.items, it.ID)
+		return false, err
+	}
+	return true, nil
+}
+
+// resolve 处理举报：下架或删除时拦截该文件的下载，同一文件其他未处理的举报一并关闭
+func (st *reportStore) resolve(profile, id, status string) (*reportItem, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	it, ok := st.items[id]
+	if !ok || it.Profile != profile || it.Status != reportPending {
+		return nil, errReportNotFound
+	}
+	now := time.Now()
+	it.Status, it.HandledAt = status, now
+	if status != reportDismissed {
+		st.blocked[it.FileID] = status
+		for _, other := range st.items {
+			if other.Status == reportPending && other.Profile == profile && other.FileID == it.FileID {
+				other.Status, other.HandledAt = status, now
+			}
+		}
+	}
+	return it, st.save()
+}
+
+// blockParts 已下架的是分块文件时，一并拦截清单引用的分块与变体，避免绕过清单直接通过 /chunk 下载
+func (st *reportStore) blockParts(id string, parts []string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	it, ok := st.items[id]
+	if !ok || (it.Status != reportDisabled && it.Status != reportDeleted) {
+		return errReportNotFound
+	}
+	it.Parts = parts
+	for _, part := range parts {
+		st.blocked[part] = it.Status
+	}
+	return st.save()
+}
+
+// isBlocked 文件是否因举报被下架
+func (st *reportStore) isBlocked(fileID string) bool {
+	if st == nil {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.blocked[fileID] != ""
+}
+
+func (st *reportStore) pending(profile string) []reportItem {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	list := []reportItem{}
+	for _, it := range st.items {
+		if it.Profile == profile && it.Status == reportPending {
+			list = append(list, *it)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// reportTarget 解析被举报的链接，支持 /s/{slug}、/d/{slug}、路径形式的 /d/{file_id}/... 与 /d?file_id=
+func (p *profile) reportTarget(raw string) (fileID, filename string, err error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Path == "" {
+		return "", "", fmt.Errorf("链接格式错误")
+	}
+	var e slugEntry
+	ok := false
+	switch {
+	case strings.HasPrefix(u.Path, "/s/"):
+		e, ok = p.srv.shareSlugs.resolve(strings.TrimPrefix(u.Path, "/s/"))
+	case u.Path == "/d":
+		e, ok = slugEntry{Profile: p.Name, FileID: u.Query().Get("file_id"), Filename: u.Query().Get("filename")}, u.Query().Get("file_id") != ""
+	case strings.HasPrefix(u.Path, "/d/"):
+		rest := strings.TrimPrefix(u.Path, "/d/")
+		if id, name, found := parseDownloadPath(rest); found {
+			e, ok = slugEntry{Profile: p.Name, FileID: id, Filename: name}, true
+		} else if p.srv.slugs != nil {
+			e, ok = p.srv.slugs.resolve(rest)
+		}
+	}
+	if !ok || e.Profile != p.Name {
+		return "", "", fmt.Errorf("不是本站的分享链接")
+	}
+	return e.FileID, e.Filename, nil
+}
+
+// handleReport POST /api/report 举报分享链接，不需要登录。
+// 请求体为 {"url": "...", "reason": "..."}，记录后向管理员发送带处理按钮的消息
+func (p *profile) handleReport(w http.ResponseWriter, r *http.Request) {
+	if p.srv.reports == nil {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未开启举报", nil)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 POST", nil)
+		return
+	}
+	var req struct {
+		URL    string `json:"url"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil || req.URL == "" || strings.TrimSpace(req.Reason) == "" {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "需要 url 与 reason", nil)
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > reportReasonLimit {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, fmt.Sprintf("举报理由不能超过 %d 字", reportReasonLimit), nil)
+		return
+	}
+	fileID, filename, err := p.reportTarget(req.URL)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	it := &reportItem{Profile: p.Name, FileID: fileID, Filename: filename, URL: req.URL, Reason: reason, ClientIP: clientIP(r)}
+	added, err := p.srv.reports.add(it)
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, fmt.Sprintf("保存举报失败: %v", err), nil)
+		return
+	}
+	if added {
+		p.notifyReport(it)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+}
+
+// notifyReport 向管理员发送举报消息，带“下架/删除/忽略”按钮
+func (p *profile) notifyReport(it *reportItem) {
+	name := it.Filename
+	if name == "" {
+		name = "（分块文件）"
+	}
+	msg := tgbotapi.NewMessage(p.ChatID, fmt.Sprintf("收到举报：\n链接：%s\n文件：%s\n理由：%s\n来源 IP：%s", it.URL, name, it.Reason, it.ClientIP))
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🚫 下架", "report-disable:"+it.ID),
+		tgbotapi.NewInlineKeyboardButtonData("🗑 删除", "report-delete:"+it.ID),
+		tgbotapi.NewInlineKeyboardButtonData("忽略", "report-dismiss:"+it.ID),
+	))
+	if _, err := p.bot.Send(msg); err != nil {
+		log.Printf("发送举报消息失败: %v", err)
+	}
+}
+
+// handleAbuseReport 处理举报：下架后所有指向该文件的链接返回 451，分块文件的分块与变体一并下架；删除时还会删除 Telegram 中的文件消息，
+// 只有匿名上传（审核队列中记录了消息 ID）的文件能自动删除，其他文件需要在存储会话中手动删除
+func (p *profile) handleAbuseReport(id, action string) (*reportItem, string, error) {
+	status := map[string]string{"disable": reportDisabled, "delete": reportDeleted, "dismiss": reportDismissed}[action]
+	if status == "" {
+		return nil, "", fmt.Errorf("未知操作: %s", action)
+	}
+	if p.srv.reports == nil {
+		return nil, "", fmt.Errorf("未开启举报")
+	}
+	it, err := p.srv.reports.resolve(p.Name, id, status)
+	if err != nil {
+		return nil, "", err
+	}
+	if status == reportDismissed {
+		return it, "已忽略举报：" + it.URL, nil
+	}
+	// 链接没有文件名时指向 fileAll.txt，与 /d 的判断一致
+	if it.Filename == "" {
+		if m, err := readManifest(p.bot, it.FileID); err != nil {
+			log.Printf("读取被举报的清单失败，分块仍可通过 /chunk 下载: %v", err)
+		} else if err := p.srv.reports.blockParts(it.ID, manifestParts(m)); err != nil {
+			log.Printf("保存被举报清单的分块失败: %v", err)
+		}
+	}
+	if status == reportDisabled {
+		return it, "已下架：" + it.URL, nil
+	}
+	messageID := p.srv.moderation.messageID(p.Name, it.FileID)
+	if messageID == 0 {
+		return it, "已下架，文件消息需要在存储会话中手动删除：" + it.URL, nil
+	}
+	if _, err := p.bot.Request(tgbotapi.NewDeleteMessage(p.ChatID, messageID)); err != nil {
+		log.Printf("删除被举报的文件消息失败: %v", err)
+		return it, "已下架，但删除文件消息失败，请在存储会话中手动删除：" + it.URL, nil
+	}
+	return it, "已下架并删除文件：" + it.URL, nil
+}
+
+// handleReportCallback 处理举报消息上的按钮
+func (p *profile) handleReportCallback(cb *tgbotapi.CallbackQuery) {
+	if cb.From == nil || !p.isAdmin(cb.From.ID) {
+		_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, "您无权限使用此机器人"))
+		return
+	}
+	// 与 /api/reports 一样，维护模式中不下架、删除文件，也不修改举报记录
+	if st := maintenanceStatus(); st.Enabled {
+		_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, "维护模式中，暂不能处理举报："+st.Message))
+		return
+	}
+	action, id, _ := strings.Cut(strings.TrimPrefix(cb.Data, "report-"), ":")
+	_, text, err := p.handleAbuseReport(id, action)
+	if err != nil {
+		_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, err.Error()))
+		return
+	}
+	_, _ = p.bot.Request(tgbotapi.NewCallback(cb.ID, "已处理"))
+	if cb.Message != nil {
+		_, _ = p.bot.Send(tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, cb.Message.Text+"\n\n"+text))
+	}
+}
+
+// handleReports GET /api/reports 列出未处理的举报，
+// POST /api/reports/{id}/disable、/delete 或 /dismiss 处理举报，需要访问密码
+func (p *profile) handleReports(w http.ResponseWriter, r *http.Request) {
+	if p.srv.reports == nil {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未开启举报", nil)
+		return
+	}
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/reports"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET", nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.srv.reports.pending(p.Name))
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	if action != "disable" && action != "delete" && action != "dismiss" {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未知操作", nil)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 POST", nil)
+		return
+	}
+	it, text, err := p.handleAbuseReport(id, action)
+	if errors.Is(err, errReportNotFound) {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*reportItem
+		Message string `json:"message"`
+	}{it, text})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// withRequestID 为每个请求分配请求 ID：沿用客户端或上游代理传入的 X-Request-Id（格式不合法时重新生成），
+// 写回请求头供后续处理使用，并在响应的 X-Request-Id 头中返回，用户报告问题时可以据此在日志中查找
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestID(id) {
+			r.Header.Del("X-Request-Id")
+			id = requestID(r)
+			r.Header.Set("X-Request-Id", id)
+		}
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID 只接受不超过 64 个字符的字母、数字和 -_.，避免日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// reqLog 与 log.Printf 相同，日志前加上请求 ID
+func reqLog(r *http.Request, format string, args ...any) {
+	log.Printf("[%s] %s", requestID(r), fmt.Sprintf(format, args...))
+}
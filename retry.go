@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fetchChunkWithRetry 下载分块，失败时按 1s、2s、4s... 退避重试，最多重试 CHUNK_RETRIES 次，分块已失效、请求方已断开或 Telegram 熔断时不重试。
+// 本 profile 的同一分块已在下载时等待并共用其结果
+func (p *profile) fetchChunkWithRetry(bot *tgbotapi.BotAPI, fileID, codec string) ([]byte, error) {
+	return coalesceFetch(chunkCacheKey(p.Name, fileID, codec), func() ([]byte, error) {
+		return withChunkRetry(fileID, p.srv.chunkRetries, func() ([]byte, error) { return p.fetchChunk(bot, fileID, codec) })
+	})
+}
+
+// downloadBlobWithRetry 与 fetchChunkWithRetry 相同，但返回未解码的原始内容，用于导出备份
+func (p *profile) downloadBlobWithRetry(bot *tgbotapi.BotAPI, fileID string) ([]byte, error) {
+	return withChunkRetry(fileID, p.srv.chunkRetries, func() ([]byte, error) { return downloadBlob(bot, fileID) })
+}
+
+// withChunkRetry 最多重试 retries 次
+func withChunkRetry(fileID string, retries int, fetch func() ([]byte, error)) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Second << (attempt - 1))
+			log.Printf("重试下载分块 %s（第 %d 次）: %v", fileID, attempt, lastErr)
+		}
+		data, err := fetch()
+		if err == nil {
+			return data, nil
+		}
+		if isFileGone(err) || isCanceled(err) || errors.Is(err, errTelegramUnreachable) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("重试 %d 次后仍失败: %w", retries, lastErr)
+}
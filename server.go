@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// server 一个 HTTP 服务实例：各 profile 的 Bot、Chat、密码都是 profile 的字段，路由注册在各自的 ServeMux 上，
+// 就绪检查与调试接口挂在实例自己的根 ServeMux 上，同一进程中可以创建多个实例。
+// 不使用 http.DefaultServeMux，避免 pprof、expvar 在 init 中注册的调试接口被公开访问。
+// 分块缓存、任务日志、熔断器以及各个 JSON 存储等由实例的各 profile 共享，通过 serverOptions 传入，profile 经 srv 访问
+type server struct {
+	serverOptions
+	profiles []*profile
+	handler  http.Handler
+}
+
+// serverOptions newServer 的配置，零值表示不开启对应功能
+type serverOptions struct {
+	static     http.Handler // 静态页面，为 nil 时返回 404
+	quotaLimit int64        // 每个 profile 的每日上传额度
+	adminToken string       // 非空时开启 /api/admin/status、/api/admin/maintenance
+	debug      bool         // 同时配置了 adminToken 时开启 /debug/pprof、/debug/vars
+	basicUser  string       // 与 basicPass 同时非空时开启 HTTP Basic 认证
+	basicPass  string
+
+	cache      *chunkCache      // 分块缓存，为 nil 时不缓存
+	scanner    virusScanner     // 病毒扫描，为 nil 时不扫描
+	jobs       *jobStore        // 上传任务日志，为 nil 时不记录
+	uploads    *uploadGate      // 同时进行的上传数，为 nil 时不限制
+	buffers    *memoryBudget    // 传输缓冲内存，为 nil 时不限制
+	moderation *moderationQueue // 公开上传的审核队列，为 nil 时不审核
+	reports    *reportStore     // 滥用举报，为 nil 时不接受举报
+	slugs      *slugStore       // 短链接，为 nil 时不生成
+	breaker    *circuitBreaker  // Telegram 熔断，为 nil 时不熔断
+	mimeTypes  *mimeTypes       // Content-Type 与内联展示规则，为 nil 时使用默认规则
+	hashes     *chunkCache      // 小文件的 SHA-256，为 nil 时缓存最近 fileHashCacheSize 个
+
+	downloadAuth     *downloadAuthStore    // 单个文件的下载鉴权设置，为 nil 时都按 profile 的 download_auth
+	previewOverrides *previewOverrideStore // 单个文件的预览设置，为 nil 时都按 MIME 类型与扩展名的规则
+	shareSlugs       *slugStore            // 自定义分享链接 /s/{slug}，为 nil 时不能生成
+	announcements    *announcementStore    // 公告，为 nil 时没有公告
+	mediaIndex       *mediaStore           // 图片、视频的元数据索引，为 nil 时不记录
+	sidecars         *sidecarStore         // 字幕等附属文件，为 nil 时不能添加
+	uploadLinks      *uploadLinkStore      // 只能上传的 /u/{token} 链接，为 nil 时不能创建
+	comments         *commentStore         // 文件备注，为 nil 时不能添加
+
+	telegramTimeout time.Duration // 单次 Telegram 请求的超时，getUpdates 长轮询除外
+	chunkRetries    int           // 分块下载失败后的最大重试次数
+	callbackSecret  string        // 上传完成回调的签名密钥，为空时不接受 callback_url
+	cdnMode         bool          // /d 的成功响应带上长期缓存头
+	hotlinkAllowed  []string      // 允许引用下载链接的网站，为空时不检查
+}
+
+func newServer(profiles []*profile, opts serverOptions) (*server, error) {
+	if opts.static == nil {
+		opts.static = http.NotFoundHandler()
+	}
+	if opts.cache == nil {
+		opts.cache = newChunkCache(0)
+	}
+	if opts.jobs == nil {
+		opts.jobs = newJobStore(0)
+	}
+	if opts.uploads == nil {
+		opts.uploads = newUploadGate(0, 0)
+	}
+	if opts.buffers == nil {
+		opts.buffers = newMemoryBudget(0)
+	}
+	if opts.breaker == nil {
+		opts.breaker = newCircuitBreaker(0, 0)
+	}
+	if opts.mimeTypes == nil {
+		opts.mimeTypes = newMimeTypes()
+	}
+	if opts.hashes == nil {
+		opts.hashes = newChunkCache(fileHashCacheSize)
+	}
+	s := &server{serverOptions: opts, profiles: profiles}
+	for _, p := range profiles {
+		p.srv = s
+		p.ready = make(chan struct{})
+		p.quota = newUploadQuota(opts.quotaLimit)
+		p.events = newEventHub()
+		p.handler = p.rememberBase(guardMaintenance(p.routes(opts.static)))
+	}
+	router, err := newProfileRouter(profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	root := http.NewServeMux()
+	root.Handle("/", withCompression(router))
+	root.HandleFunc("/readyz", s.handleReadyz)
+	if opts.adminToken != "" {
+		if opts.debug {
+			root.Handle("/debug/", debugHandler(opts.adminToken))
+		}
+		root.Handle("/api/admin/status", requireAdmin(opts.adminToken, http.HandlerFunc(s.handleAdminStatus)))
+		root.Handle("/api/admin/maintenance", requireAdmin(opts.adminToken, http.HandlerFunc(handleAdminMaintenance)))
+	}
+	var handler http.Handler = root
+	if opts.basicUser != "" && opts.basicPass != "" {
+		handler = withBasicAuth(opts.basicUser, opts.basicPass, root)
+	}
+	s.handler = withRequestID(handler)
+	return s, nil
+}
+
+// start 在后台连接各 profile 的 Bot，client 为 nil 时使用默认 HTTP 客户端
+func (s *server) start(client *http.Client) {
+	for _, p := range s.profiles {
+		go p.connect(client)
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 不经过 main 加载各个存储时，newServer 使用零值选项也能正常处理请求
+func TestNewServerZeroOptions(t *testing.T) {
+	p := &profile{Name: "default", BotToken: "token", AccessPwd: "secret"}
+	s := newTestServer(t, newFakeTelegram(), serverOptions{}, p)
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", http.StatusNotFound},
+		{"/api/announcement", http.StatusOK},
+		{"/api/media?pwd=secret", http.StatusOK},
+		{"/s/some-slug", http.StatusNotFound},
+		{"/u/some-token", http.StatusNotFound},
+		{"/api/upload-links?pwd=secret", http.StatusNotFound},
+		{"/api/files/some-file/comments", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s 返回 %d，期望 %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
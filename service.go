@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	serviceName  = "tg-disk"
+	launchdLabel = "com.tg-disk"
+)
+
+// runService tg-disk service install|uninstall|start|stop：注册为开机运行的服务并启动、停止，
+// Linux 使用 systemd，macOS 使用 launchd，Windows 使用开机触发的计划任务。
+// 服务的工作目录为执行 install 时的目录，从该目录读取 .env，-port 一并写入启动命令
+func runService(action, port, runAs, umask string) int {
+	switch action {
+	case "install", "uninstall", "start", "stop":
+	default:
+		fmt.Fprintln(os.Stderr, "用法：tg-disk service install|uninstall|start|stop [-port 端口] [-user 运行用户]")
+		return 2
+	}
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		err = systemdService(action, port, runAs, umask)
+	case "darwin":
+		err = launchdService(action, port, runAs)
+	case "windows":
+		err = windowsService(action, port)
+	default:
+		err = fmt.Errorf("不支持在 %s 上安装服务", runtime.GOOS)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runTool 执行服务管理命令，输出直接显示给用户
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s 失败: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// systemdService 服务文件写入 /etc/systemd/system，与 systemd-unit 输出的内容相同，需要 root
+func systemdService(action, port, runAs, umask string) error {
+	path := "/etc/systemd/system/" + serviceName + ".service"
+	switch action {
+	case "install":
+		unit, err := systemdUnit(port, runAs, umask)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(unit), 0644); err != nil {
+			return fmt.Errorf("写入服务文件失败（需要 root）: %v", err)
+		}
+		if err := runTool("systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		if err := runTool("systemctl", "enable", serviceName); err != nil {
+			return err
+		}
+		fmt.Printf("已安装 %s，执行 tg-disk service start 启动\n", path)
+		return nil
+	case "uninstall":
+		if err := runTool("systemctl", "disable", "--now", serviceName); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("删除服务文件失败: %v", err)
+		}
+		return runTool("systemctl", "daemon-reload")
+	default:
+		return runTool("systemctl", action, serviceName)
+	}
+}
+
+// launchdService 以 root 安装时写入 /Library/LaunchDaemons，开机时以 -user 指定的用户运行；
+// 以普通用户安装时写入 ~/Library/LaunchAgents，登录后以当前用户运行。
+// 异常退出后由 launchd 重新启动，stop 卸载任务，下次开机或 start 时再次运行
+func launchdService(action, port, runAs string) error {
+	path := filepath.Join("/Library/LaunchDaemons", launchdLabel+".plist")
+	if os.Geteuid() != 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("获取用户目录失败: %v", err)
+		}
+		path = filepath.Join(home, "Library/LaunchAgents", launchdLabel+".plist")
+		runAs = ""
+	}
+	switch action {
+	case "install":
+		if os.Geteuid() == 0 && runAs == "" {
+			return fmt.Errorf("以 root 安装时请通过 -user 指定服务的运行用户")
+		}
+		plist, err := launchdPlist(port, runAs)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("创建 %s 失败: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, plist, 0644); err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", path, err)
+		}
+		if err := runTool("launchctl", "load", "-w", path); err != nil {
+			return err
+		}
+		fmt.Printf("已安装并启动 %s\n", path)
+		return nil
+	case "uninstall":
+		runTool("launchctl", "unload", "-w", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("删除 %s 失败: %v", path, err)
+		}
+		return nil
+	case "start":
+		return runTool("launchctl", "load", path)
+	default:
+		return runTool("launchctl", "unload", path)
+	}
+}
+
+// launchdPlist 日志写入工作目录下的 tg-disk.log
+func launchdPlist(port, runAs string) ([]byte, error) {
+	exe, dir, err := serviceTarget()
+	if err != nil {
+		return nil, err
+	}
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	args := []string{exe}
+	if port != "" {
+		args = append(args, "-port", port)
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", launchdLabel)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range args {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", esc(a))
+	}
+	b.WriteString("\t</array>\n")
+	fmt.Fprintf(&b, "\t<key>WorkingDirectory</key>\n\t<string>%s</string>\n", esc(dir))
+	if runAs != "" {
+		fmt.Fprintf(&b, "\t<key>UserName</key>\n\t<string>%s</string>\n", esc(runAs))
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	logPath := esc(filepath.Join(dir, serviceName+".log"))
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", logPath)
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", logPath)
+	b.WriteString("</dict>\n</plist>\n")
+	return []byte(b.String()), nil
+}
+
+// windowsService 注册开机触发、以 SYSTEM 运行的计划任务，需要在管理员命令行中执行。
+// 计划任务从 System32 启动且没有控制台，因此通过 -workdir 指定工作目录，日志通过 -log 追加到工作目录下的 tg-disk.log
+func windowsService(action, port string) error {
+	switch action {
+	case "install":
+		exe, dir, err := serviceTarget()
+		if err != nil {
+			return err
+		}
+		run := fmt.Sprintf(`"%s" -workdir "%s" -log "%s"`, exe, dir, filepath.Join(dir, serviceName+".log"))
+		if port != "" {
+			run += " -port " + port
+		}
+		if err := runTool("schtasks", "/Create", "/TN", serviceName, "/SC", "ONSTART", "/RU", "SYSTEM", "/RL", "HIGHEST", "/F", "/TR", run); err != nil {
+			return err
+		}
+		fmt.Println("已安装计划任务 tg-disk，开机时自动启动，执行 tg-disk service start 立即启动")
+		return nil
+	case "uninstall":
+		runTool("schtasks", "/End", "/TN", serviceName)
+		return runTool("schtasks", "/Delete", "/TN", serviceName, "/F")
+	case "start":
+		return runTool("schtasks", "/Run", "/TN", serviceName)
+	default:
+		return runTool("schtasks", "/End", "/TN", serviceName)
+	}
+}
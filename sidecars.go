@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 附属文件类型
+const (
+	sidecarSubtitle = "subtitle"
+	sidecarCover    = "cover"
+	sidecarChecksum = "checksum"
+	sidecarOther    = "other"
+)
+
+// sidecar 挂在主文件下的附属文件（字幕、校验文件、封面等），本身是单独上传的小文件
+type sidecar struct {
+	Kind     string `json:"kind"`
+	FileID   string `json:"file_id"`
+	Filename string `json:"filename"`
+}
+
+// sidecarStore 主文件与附属文件的对应关系，按 profile/file_id 保存在 JSON 文件中
+type sidecarStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string][]sidecar
+}
+
+func loadSidecarStore(path string) (*sidecarStore, error) {
+	st := &sidecarStore{path: path, items: make(map[string][]sidecar)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取附属文件列表失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.items); err != nil {
+		return nil, fmt.Errorf("解析附属文件列表失败: %v", err)
+	}
+	return st, nil
+}
+
+// sidecarKind 未指定类型时按扩展名推断
+func (p *profile) sidecarKind(filename string) string {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".srt", ".vtt", ".ass", ".ssa":
+		return sidecarSubtitle
+	case ".sha256", ".sha1", ".md5", ".sfv":
+		return sidecarChecksum
+	default:
+		if strings.HasPrefix(p.srv.mimeTypes.contentTypeFor(filename), "image/") {
+			return sidecarCover
+		}
+	}
+	return sidecarOther
+}
+
+func (st *sidecarStore) list(profile, fileID string) []sidecar {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]sidecar(nil), st.items[profile+"/"+fileID]...)
+}
+
+func (st *sidecarStore) find(profile, fileID, sidecarID string) (sidecar, bool) {
+	for _, s := range st.list(profile, fileID) {
+		if s.FileID == sidecarID {
+			return s, true
+		}
+	}
+	return sidecar{}, false
+}
+
+// attach 添加附属文件，同一 file_id 重复添加时更新文件名和类型
+func (st *sidecarStore) attach(profile, fileID string, s sidecar) error {
+	if st == nil {
+		return errors.New("未开启附属文件")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + fileID
+	old := st.items[key]
+	list := make([]sidecar, 0, len(old)+1)
+	for _, e := range old {
+		if e.FileID != s.FileID {
+			list = append(list, e)
+		}
+	}
+	st.items[key] = append(list, s)
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		st.items[key] = old
+		return fmt.Errorf("保存附属文件列表失败: %v", err)
+	}
+	return nil
+}
+
+func (st *sidecarStore) detach(profile, fileID, sidecarID string) (bool, error) {
+	if st == nil {
+		return false, nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + fileID
+	old := st.items[key]
+	var list []sidecar
+	for _, e := range old {
+		if e.FileID != sidecarID {
+			list = append(list, e)
+		}
+	}
+	if len(list) == len(old) {
+		return false, nil
+	}
+	if len(list) == 0 {
+		delete(st.items, key)
+	} else {
+		st.items[key] = list
+	}
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		st.items[key] = old
+		return false, fmt.Errorf("保存附属文件列表失败: %v", err)
+	}
+	return true, nil
+}
+
+// handleSidecars /api/files/{id}/sidecars[/{sidecar_id}]：
+// GET 列出附属文件或返回某个附属文件的内容（.srt 字幕转换为 WebVTT），权限与下载主文件相同；
+// POST 添加、DELETE 移除需要访问密码
+func (p *profile) handleSidecars(w http.ResponseWriter, r *http.Request, fileID, sidecarID string) {
+	switch {
+	case r.Method == http.MethodGet:
+		if !p.authorizeDownload(w, r, fileID) {
+			return
+		}
+		if sidecarID != "" {
+			p.serveSidecar(w, r, fileID, sidecarID)
+			return
+		}
+		list := p.srv.sidecars.list(p.Name, fileID)
+		if list == nil {
+			list = []sidecar{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && sidecarID == "":
+		if !p.isAuthenticated(r) {
+			writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+			return
+		}
+		var s sidecar
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.FileID == "" || s.Filename == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体应为 {\"file_id\":...,\"filename\":...}", nil)
+			return
+		}
+		if s.Kind == "" {
+			s.Kind = p.sidecarKind(s.Filename)
+		}
+		if err := p.srv.sidecars.attach(p.Name, fileID, s); err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s)
+	case r.Method == http.MethodDelete && sidecarID != "":
+		if !p.isAuthenticated(r) {
+			writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+			return
+		}
+		ok, err := p.srv.sidecars.detach(p.Name, fileID, sidecarID)
+		if err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+		if !ok {
+			writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "附属文件不存在", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "不支持的请求方法", nil)
+	}
+}
+
+// serveSidecar 返回附属文件内容，只有登记在该主文件下的 file_id 可以通过主文件的权限访问
+func (p *profile) serveSidecar(w http.ResponseWriter, r *http.Request, fileID, sidecarID string) {
+	bot := p.botFor(r)
+	s, ok := p.srv.sidecars.find(p.Name, fileID, sidecarID)
+	if !ok {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "附属文件不存在", nil)
+		return
+	}
+	data, err := downloadBlob(bot, s.FileID)
+	if isFileGone(err) {
+		p.writeGone(w, r, s.FileID)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadGateway, errCodeTelegram, err.Error(), nil)
+		return
+	}
+	contentType := p.srv.mimeTypes.contentTypeFor(s.Filename)
+	if s.Kind == sidecarSubtitle && strings.EqualFold(filepath.Ext(s.Filename), ".srt") {
+		data = srtToVTT(data)
+		contentType = "text/vtt; charset=utf-8"
+	} else if strings.EqualFold(filepath.Ext(s.Filename), ".vtt") {
+		contentType = "text/vtt; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if guardActiveContent(w, contentType) {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": s.Filename}))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(data)
+}
+
+// sidecarURL 附属文件的访问链接，沿用主文件链接中的令牌参数
+func sidecarURL(base, fileID, sidecarID, token, exp string) string {
+	link := strings.TrimRight(base, "/") + "/api/files/" + url.PathEscape(fileID) + "/sidecars/" + url.PathEscape(sidecarID)
+	q := url.Values{}
+	if token != "" {
+		q.Set("token", token)
+	}
+	if exp != "" {
+		q.Set("exp", exp)
+	}
+	if len(q) > 0 {
+		link += "?" + q.Encode()
+	}
+	return link
+}
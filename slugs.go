@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const slugAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// slugEntry 短链接指向的文件，filename 为空表示分块文件清单
+type slugEntry struct {
+	Profile  string `json:"profile"`
+	FileID   string `json:"file_id"`
+	Filename string `json:"filename,omitempty"`
+	Exp      int64  `json:"exp,omitempty"` // 自定义分享链接的过期时间（Unix 秒）
+}
+
+// slugStore 短链接与 file_id 的对应关系，保存在 JSON 文件中。
+// 链接中不再出现 file_id（其中包含机器人的标识信息），也短得多
+type slugStore struct {
+	mu     sync.Mutex
+	path   string
+	bySlug map[string]slugEntry
+	byFile map[slugEntry]string
+}
+
+func loadSlugStore(path string) (*slugStore, error) {
+	st := &slugStore{path: path, bySlug: make(map[string]slugEntry), byFile: make(map[slugEntry]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取短链接失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.bySlug); err != nil {
+		return nil, fmt.Errorf("解析短链接失败: %v", err)
+	}
+	for slug, e := range st.bySlug {
+		st.byFile[e] = slug
+	}
+	return st, nil
+}
+
+// shorten 返回文件的短链接 ID，同一文件重复生成时复用已有的 ID
+func (st *slugStore) shorten(profile, fileID, filename string) (string, error) {
+	if filename == "fileAll.txt" {
+		filename = ""
+	}
+	e := slugEntry{Profile: profile, FileID: fileID, Filename: filename}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if slug, ok := st.byFile[e]; ok {
+		return slug, nil
+	}
+	var slug string
+	for {
+		b := make([]byte, 6)
+		_, _ = rand.Read(b)
+		for i := range b {
+			b[i] = slugAlphabet[int(b[i])%len(slugAlphabet)]
+		}
+		if slug = string(b); st.bySlug[slug] == (slugEntry{}) {
+			break
+		}
+	}
+	st.bySlug[slug] = e
+	st.byFile[e] = slug
+	if err := writeJSONFile(st.path, st.bySlug); err != nil {
+		delete(st.bySlug, slug)
+		delete(st.byFile, e)
+		return "", fmt.Errorf("保存短链接失败: %v", err)
+	}
+	return slug, nil
+}
+
+// vanitySlugPattern 自定义链接只允许小写字母、数字和短横线
+var vanitySlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,63}$`)
+
+// reservedSlugs 容易与页面、接口混淆的保留词
+var reservedSlugs = map[string]bool{
+	"api": true, "admin": true, "debug": true, "upload": true, "verify": true,
+	"readyz": true, "login": true, "static": true, "index": true, "share": true,
+}
+
+// claim 占用自定义链接，已被其他文件占用且未过期时报错，同一文件重复分享时更新有效期
+func (st *slugStore) claim(slug string, e slugEntry) error {
+	if !vanitySlugPattern.MatchString(slug) {
+		return fmt.Errorf("自定义链接只能包含小写字母、数字和短横线，长度 3-64")
+	}
+	if reservedSlugs[slug] {
+		return fmt.Errorf("%s 为保留词，请换一个", slug)
+	}
+	if st == nil {
+		return errors.New("未开启自定义分享链接")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	old, taken := st.bySlug[slug]
+	if taken && (old.Profile != e.Profile || old.FileID != e.FileID) && time.Now().Unix() <= old.Exp {
+		return fmt.Errorf("%s 已被使用", slug)
+	}
+	st.bySlug[slug] = e
+	if err := writeJSONFile(st.path, st.bySlug); err != nil {
+		if taken {
+			st.bySlug[slug] = old
+		} else {
+			delete(st.bySlug, slug)
+		}
+		return fmt.Errorf("保存分享链接失败: %v", err)
+	}
+	return nil
+}
+
+func (st *slugStore) resolve(slug string) (slugEntry, bool) {
+	if st == nil {
+		return slugEntry{}, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.bySlug[slug]
+	return e, ok
+}
+
+// find 指向该文件且未过期的全部链接，key 为链接 ID
+func (st *slugStore) find(profile, fileID string) map[string]slugEntry {
+	if st == nil {
+		return nil
+	}
+	now := time.Now().Unix()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	found := make(map[string]slugEntry)
+	for slug, e := range st.bySlug {
+		if e.Profile == profile && e.FileID == fileID && (e.Exp == 0 || now <= e.Exp) {
+			found[slug] = e
+		}
+	}
+	return found
+}
+
+// ShareLink 文件已生成的短链接（/d/）或自定义分享链接（/s/，带过期时间）
+type ShareLink struct {
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// shareLinks 该文件已生成的短链接与未过期的自定义分享链接，按链接排序，不会生成新的链接
+func (p *profile) shareLinks(base, fileID string) []ShareLink {
+	base = strings.TrimRight(base, "/")
+	var links []ShareLink
+	for slug := range p.srv.slugs.find(p.Name, fileID) {
+		links = append(links, ShareLink{URL: base + "/d/" + slug})
+	}
+	for slug, e := range p.srv.shareSlugs.find(p.Name, fileID) {
+		exp := time.Unix(e.Exp, 0)
+		links = append(links, ShareLink{URL: base + "/s/" + slug, ExpiresAt: &exp})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].URL < links[j].URL })
+	return links
+}
+
+// writeJSONFile 先写临时文件再重命名，避免写到一半崩溃导致文件损坏
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fileLink 生成文件链接并附加 extra 参数：开启短链接时为 /d/{slug}，LINK_STYLE=query 时为带 file_id 的 /d 链接，
+// 否则为路径形式的链接
+func (p *profile) fileLink(base, fileID, filename string, extra url.Values) string {
+	return p.namedFileLink(base, fileID, filename, "", extra)
+}
+
+// namedFileLink 与 fileLink 相同，name 为分块文件的原始文件名，路径形式的链接以它结尾
+func (p *profile) namedFileLink(base, fileID, filename, name string, extra url.Values) string {
+	if p.srv.slugs != nil {
+		slug, err := p.srv.slugs.shorten(p.Name, fileID, filename)
+		if err == nil {
+			link := strings.TrimRight(base, "/") + "/d/" + slug
+			if len(extra) > 0 {
+				link += "?" + extra.Encode()
+			}
+			return link
+		}
+		log.Println(err)
+	}
+	if !queryLinks {
+		link := buildPathDownloadURL(base, fileID, filename, name)
+		if len(extra) > 0 {
+			link += "?" + extra.Encode()
+		}
+		return link
+	}
+	link := buildDownloadURL(base, fileID, filename)
+	if len(extra) > 0 {
+		link += "&" + extra.Encode()
+	}
+	return link
+}
+
+// handleShortLink GET /d/{slug}，换成对应的 file_id、filename 参数后按普通下载处理；
+// 路径中还有 / 时为路径形式的下载链接，交给 handlePathDownload
+func (p *profile) handleShortLink(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/d/")
+	if fileID, filename, ok := parseDownloadPath(slug); ok {
+		p.handlePathDownload(w, r, fileID, filename)
+		return
+	}
+	var e slugEntry
+	ok := p.srv.slugs != nil
+	if ok {
+		e, ok = p.srv.slugs.resolve(slug)
+	}
+	if !ok || e.Profile != p.Name {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	q.Set("file_id", e.FileID)
+	if e.Filename != "" {
+		q.Set("filename", e.Filename)
+	} else {
+		q.Del("filename")
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	p.handleDownload(w, r2)
+}
+
+// vanityShareURL 生成 /s/{slug} 形式的限时分享链接，与普通分享链接一样需要配置 DOWNLOAD_TOKEN_SECRET
+func (p *profile) vanityShareURL(base, fileID, filename, slug string, ttl time.Duration) (string, time.Time, error) {
+	if p.DownloadTokenSecret == "" {
+		return "", time.Time{}, fmt.Errorf("未配置 DOWNLOAD_TOKEN_SECRET，无法生成限时链接")
+	}
+	if filename == "fileAll.txt" {
+		filename = ""
+	}
+	expAt := time.Now().Add(ttl)
+	if err := p.srv.shareSlugs.claim(slug, slugEntry{Profile: p.Name, FileID: fileID, Filename: filename, Exp: expAt.Unix()}); err != nil {
+		return "", time.Time{}, err
+	}
+	return strings.TrimRight(base, "/") + "/s/" + slug, expAt, nil
+}
+
+// handleShareSlug GET /s/{slug}，过期后返回 410，未过期时补上限时令牌按普通下载处理
+func (p *profile) handleShareSlug(w http.ResponseWriter, r *http.Request) {
+	e, ok := p.srv.shareSlugs.resolve(strings.TrimPrefix(r.URL.Path, "/s/"))
+	if !ok || e.Profile != p.Name {
+		http.NotFound(w, r)
+		return
+	}
+	if time.Now().Unix() > e.Exp {
+		http.Error(w, "分享链接已过期", http.StatusGone)
+		return
+	}
+	q := r.URL.Query()
+	q.Set("file_id", e.FileID)
+	if e.Filename != "" {
+		q.Set("filename", e.Filename)
+	} else {
+		q.Del("filename")
+	}
+	q.Set("exp", strconv.FormatInt(e.Exp, 10))
+	q.Set("token", expiringToken(p.DownloadTokenSecret, e.FileID, e.Exp))
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	p.handleDownload(w, r2)
+}
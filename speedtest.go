@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// speedtestDefaultSize 下载测速默认返回的字节数
+	speedtestDefaultSize = 10 << 20
+	// speedtestMaxSize 单次测速最多传输的字节数
+	speedtestMaxSize = 100 << 20
+)
+
+// speedtestBlock 下载测速反复写出的随机数据，随机内容不会被中间的代理压缩，测出的是真实传输速度
+var speedtestBlock = func() []byte {
+	b := make([]byte, 64<<10)
+	_, _ = rand.Read(b)
+	return b
+}()
+
+// speedtestResult 测速结果，BPS 为字节/秒
+type speedtestResult struct {
+	Bytes   int64   `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+	BPS     float64 `json:"bps"`
+}
+
+func newSpeedtestResult(n int64, elapsed time.Duration) speedtestResult {
+	res := speedtestResult{Bytes: n, Seconds: elapsed.Seconds()}
+	if elapsed > 0 {
+		res.BPS = float64(n) / elapsed.Seconds()
+	}
+	return res
+}
+
+// handleSpeedtest /api/speedtest/down、/up 测量客户端与服务器之间的速度，
+// /api/speedtest/telegram 测量服务器到 Telegram 的速度，用于区分传输慢的原因。需要访问密码
+func (p *profile) handleSpeedtest(w http.ResponseWriter, r *http.Request) {
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/speedtest"), "/") {
+	case "down":
+		limitPerIP(downloadLimiter, p.speedtestDown)(w, r)
+	case "up":
+		limitPerIP(uploadLimiter, p.speedtestUp)(w, r)
+	case "telegram":
+		p.requireBot(p.speedtestTelegram)(w, r)
+	default:
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "只支持 down、up、telegram", nil)
+	}
+}
+
+// speedtestDown GET /api/speedtest/down?size=字节数，返回指定大小的随机数据，客户端自行计时
+func (p *profile) speedtestDown(w http.ResponseWriter, r *http.Request) {
+	size := int64(speedtestDefaultSize)
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > speedtestMaxSize {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "size 应为 1 到 "+strconv.Itoa(speedtestMaxSize)+" 之间的字节数", nil)
+			return
+		}
+		size = n
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	for size > 0 {
+		b := speedtestBlock
+		if size < int64(len(b)) {
+			b = b[:size]
+		}
+		if _, err := w.Write(b); err != nil {
+			return
+		}
+		size -= int64(len(b))
+	}
+}
+
+// speedtestUp POST /api/speedtest/up，丢弃请求体并返回服务器端测得的接收速度
+func (p *profile) speedtestUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 POST", nil)
+		return
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, speedtestMaxSize))
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "读取请求体失败: "+err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(newSpeedtestResult(n, time.Since(start)))
+}
+
+// speedtestTelegram GET /api/speedtest/telegram 测量调用 Bot API 的延迟；
+// 带 file_id 时额外从 Telegram 下载该文件（不经过缓存）测量下载速度，可以使用任意分块的 file_id
+func (p *profile) speedtestTelegram(w http.ResponseWriter, r *http.Request) {
+	bot := p.botFor(r)
+	type result struct {
+		APILatencyMs float64          `json:"api_latency_ms"`
+		Download     *speedtestResult `json:"download,omitempty"`
+	}
+	var res result
+
+	start := time.Now()
+	if _, err := bot.GetMe(); err != nil {
+		writeAPIError(w, r, http.StatusBadGateway, errCodeTelegram, "调用 Telegram 失败: "+err.Error(), nil)
+		return
+	}
+	res.APILatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if fileID := r.URL.Query().Get("file_id"); fileID != "" {
+		start = time.Now()
+		data, err := downloadBlob(bot, fileID)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadGateway, errCodeTelegram, err.Error(), nil)
+			return
+		}
+		dl := newSpeedtestResult(int64(len(data)), time.Since(start))
+		res.Download = &dl
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(res)
+}
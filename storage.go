@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseStorageChats 解析 STORAGE_CHATS，格式为逗号分隔的 名称:chat_id，例如 media:-1001234,backups:-1005678
+func parseStorageChats(s string) (map[string]int64, error) {
+	chats := make(map[string]int64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, id, ok := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		chatID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if !ok || name == "" || err != nil {
+			return nil, fmt.Errorf("STORAGE_CHATS 格式错误，应为 名称:chat_id: %s", part)
+		}
+		chats[name] = chatID
+	}
+	return chats, nil
+}
+
+// storageChat 按上传请求的 storage 参数选择存储会话，为空时使用 CHAT_ID，未配置的名称返回错误
+func (p *profile) storageChat(name string) (int64, error) {
+	if name == "" {
+		return p.ChatID, nil
+	}
+	if id, ok := p.StorageChats[name]; ok {
+		return id, nil
+	}
+	names := make([]string, 0, len(p.StorageChats))
+	for n := range p.StorageChats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return 0, fmt.Errorf("未配置存储会话 %s（STORAGE_CHATS 为空）", name)
+	}
+	return 0, fmt.Errorf("未配置存储会话 %s，可选：%s", name, strings.Join(names, "、"))
+}
+
+// isStorageChat chatID 是否为该 profile 的存储会话（CHAT_ID 或 STORAGE_CHATS 中的任一个）
+func (p *profile) isStorageChat(chatID int64) bool {
+	if chatID == p.ChatID {
+		return true
+	}
+	for _, id := range p.StorageChats {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
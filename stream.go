@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chunkResult 单个分块的下载结果
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// chunkErrors 汇总多个分块的下载错误（重试后仍失败），key 为分块序号（从 0 开始），
+// 区别于客户端断开导致的写入失败
+type chunkErrors struct {
+	total int
+	errs  map[int]error
+}
+
+// collectChunkErrors 从按分块序号排列的错误切片中收集失败的分块，全部成功时返回 nil
+func collectChunkErrors(errs []error) error {
+	ce := &chunkErrors{total: len(errs), errs: make(map[int]error)}
+	for i, err := range errs {
+		if err != nil {
+			ce.errs[i] = err
+		}
+	}
+	if len(ce.errs) == 0 {
+		return nil
+	}
+	return ce
+}
+
+// indexes 失败的分块序号，从小到大
+func (ce *chunkErrors) indexes() []int {
+	indexes := make([]int, 0, len(ce.errs))
+	for i := range ce.errs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (ce *chunkErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "共 %d 个分块，其中 %d 个下载失败:", ce.total, len(ce.errs))
+	for _, i := range ce.indexes() {
+		fmt.Fprintf(&b, "\n分块 %d: %v", i, ce.errs[i])
+	}
+	return b.String()
+}
+
+// Unwrap 返回各分块的错误，errors.Is、errors.As 可据此判断分块是否已失效、请求是否已取消
+func (ce *chunkErrors) Unwrap() []error {
+	errs := make([]error, 0, len(ce.errs))
+	for _, i := range ce.indexes() {
+		errs = append(errs, ce.errs[i])
+	}
+	return errs
+}
+
+// streamChunks 以流水线方式下载分块：最多 workers 个分块同时下载，按序号依次写出，
+// 前面的分块一写完就释放名额开始下载后面的分块，内存中最多同时保留 workers 个分块。
+// 某个分块下载失败后不再写出，但仍等待其余分块的结果，返回的 *chunkErrors 列出所有失败的分块。
+// 返回已写出的分块数，调用方据此判断响应头是否已经发出
+func (p *profile) streamChunks(bot *tgbotapi.BotAPI, w io.Writer, flush func(), chunks []string, codec string, workers int) (int, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	slots := make([]chan chunkResult, len(chunks))
+	for i := range slots {
+		slots[i] = make(chan chunkResult, 1)
+	}
+	sem := make(chan struct{}, workers)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for i, fid := range chunks {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, fid string) {
+				data, err := p.fetchChunkWithRetry(bot, fid, codec)
+				slots[i] <- chunkResult{data: data, err: err}
+			}(i, fid)
+		}
+	}()
+
+	errs := make([]error, len(chunks))
+	failed := -1 // 第一个失败的分块序号，也是已写出的分块数，之后的分块不再写出
+	for i := range chunks {
+		res := <-slots[i]
+		switch {
+		case res.err != nil:
+			errs[i] = res.err
+			if failed < 0 {
+				failed = i
+			}
+		case failed < 0:
+			if _, err := w.Write(res.data); err != nil {
+				return i, fmt.Errorf("写入响应失败（分块 %d）: %v", i, err)
+			}
+			flush()
+		}
+		<-sem
+	}
+	if failed < 0 {
+		return len(chunks), nil
+	}
+	return failed, collectChunkErrors(errs)
+}
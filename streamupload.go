@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// needsStreaming 临时目录剩余空间不足时改用流式上传。
+// 普通上传时 multipart 解析会先把整个文件写入临时目录，分块时再写一份，因此按两倍大小估算
+func needsStreaming(contentLength int64) bool {
+	if contentLength <= chunkSize {
+		return false
+	}
+	free, ok := diskFree(os.TempDir())
+	return ok && free < uint64(contentLength)*2
+}
+
+// handleStreamingUpload 直接读取 multipart 请求体，每读满一个分块就从内存发送到 Telegram，不在磁盘上落地文件。
+// 表单字段需要位于文件之前（网页上传即如此）；病毒扫描与压缩包检查需要完整文件，开启时无法走流式上传
+func (p *profile) handleStreamingUpload(w http.ResponseWriter, r *http.Request) {
+	if p.srv.scanner != nil || blockedArchiveExts != nil {
+		http.Error(w, "临时目录空间不足，且已开启病毒扫描或压缩包检查，无法上传", http.StatusInsufficientStorage)
+		return
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "读取文件失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := make(map[string]string)
+	var file io.Reader
+	var origFilename string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "读取文件失败: 缺少 file 字段", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "读取文件失败: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			file, origFilename = part, part.FileName()
+			break
+		}
+		v, _ := io.ReadAll(io.LimitReader(part, 4096))
+		fields[part.FormName()] = string(v)
+	}
+
+	anonymous := !p.uploadAuthorized(r, fields["pwd"])
+	if anonymous && !p.PublicUpload {
+		http.Error(w, "密码错误", http.StatusUnauthorized)
+		return
+	}
+	if p.quotaExceeded(w, r) {
+		return
+	}
+	callbackURL := fields["callback_url"]
+	if callbackURL == "" {
+		callbackURL = r.URL.Query().Get("callback_url")
+	}
+	if err := setUploadCallback(w, r, callbackURL, anonymous); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	storage := fields["storage"]
+	if storage == "" {
+		storage = r.URL.Query().Get("storage")
+	}
+	chatID, err := p.storageChat(storage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reqLog(r, "临时目录空间不足，流式上传: %s", origFilename)
+
+	expectedHash := strings.ToLower(strings.TrimSpace(fields["sha256"]))
+	lowPriority := strings.EqualFold(fields["priority"], "low") || isLowPriority(r)
+	size := uploadChunkSize(fields["upload_id"])
+	uploadID, wal, done, err := p.beginUpload(fields["upload_id"], chatID)
+	if err != nil {
+		writeUploadIDError(w, err)
+		return
+	}
+	defer done()
+	w.Header().Set("X-Upload-Id", uploadID)
+	job := p.srv.jobs.start(p.Name, uploadID, origFilename, requestID(r))
+	job.add("info", -1, 0, "临时目录空间不足，流式上传")
+
+	workers := threadNumbers
+	if lowPriority {
+		workers = 1
+	}
+	// 读取缓冲加上最多 workers 个发送中的分块
+	release, ok := p.reserveBuffers(w, r, int64(workers+1)*int64(size))
+	if !ok {
+		job.finish(errors.New("内存缓冲已达上限"))
+		return
+	}
+	defer release()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sem     = make(chan struct{}, workers)
+		fileIDs = make(map[int]string)
+		sendErr error
+		stopped bool // 读取或压缩失败后置为 true，还没开始发送的分块不再发送
+	)
+	// abort 读取或压缩失败时调用：取消还没开始发送的分块，等发送中的分块结束后再结束任务，
+	// 避免请求返回后仍有 goroutine 写入任务日志与 WAL
+	abort := func(err error) {
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		wg.Wait()
+		job.finish(err)
+	}
+	hasher := sha256.New()
+	buf := make([]byte, size)
+	var chunkSizes []int64
+	var chunkHashes []string
+	var totalSize int64
+	codec := ""
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(file, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			abort(fmt.Errorf("读取文件失败: %v", err))
+			http.Error(w, "读取文件失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			break
+		}
+		if index == 0 && p.shouldCompress(origFilename, buf[:n]) {
+			codec = codecGzip
+		}
+		var data []byte
+		if codec == codecGzip {
+			if data, err = gzipBytes(buf[:n]); err != nil {
+				abort(fmt.Errorf("压缩分块失败: %v", err))
+				http.Error(w, "压缩分块失败: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			// buf 会被下一块复用，发送中的分块需要独立的副本
+			data = append([]byte(nil), buf[:n]...)
+		}
+		hasher.Write(buf[:n])
+		sum := sha256.Sum256(buf[:n])
+		chunkHash := hex.EncodeToString(sum[:])
+		chunkSizes = append(chunkSizes, int64(n))
+		chunkHashes = append(chunkHashes, chunkHash)
+		totalSize += int64(n)
+
+		if fid, ok := wal.lookup(index, chunkHash, codec); ok {
+			job.add("info", index, 0, "续传，复用已上传的分块")
+			mu.Lock()
+			fileIDs[index] = fid
+			mu.Unlock()
+		} else {
+			caption := chunkCaption{Upload: uploadID, Name: origFilename, Index: index, Size: int64(n), Codec: codec, SHA256: chunkHash}.String()
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(index int, data []byte, chunkHash string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				mu.Lock()
+				canceled := stopped
+				mu.Unlock()
+				if canceled {
+					return
+				}
+				if lowPriority {
+					throttleBackground(int64(len(data)))
+				}
+				sendStart := time.Now()
+				doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fmt.Sprintf("blob_%d", index), Bytes: data})
+				doc.Caption = caption
+				msg, err := p.bot.Send(doc)
+				if err == nil {
+					p.recordChunkMessage(uploadID, chatID, msg.MessageID)
+				}
+				if err == nil && msg.Document == nil {
+					err = fmt.Errorf("上传后未返回 Document")
+				}
+				if err == nil {
+					err = verifyBlob(p.bot, msg.Document.FileID, data)
+				}
+				job.chunk(index, time.Since(sendStart), err)
+				tuner.record(size, int64(len(data)), time.Since(sendStart), err)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					if sendErr == nil {
+						sendErr = fmt.Errorf("第 %d 个分块上传失败: %v", index, err)
+					}
+					return
+				}
+				fileIDs[index] = msg.Document.FileID
+				if err := wal.record(walEntry{Index: index, SHA256: chunkHash, Codec: codec, FileID: msg.Document.FileID}); err != nil {
+					reqLog(r, "写入上传日志失败（分块 %d）: %v", index, err)
+				}
+			}(index, data, chunkHash)
+		}
+		if err == io.EOF || n < size {
+			break
+		}
+	}
+	wg.Wait()
+
+	if sendErr != nil {
+		job.finish(sendErr)
+		p.alert(eventUploadFailed, origFilename, "文件上传失败", fmt.Sprintf("%s: %v", origFilename, sendErr))
+		http.Error(w, sendErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	// 分块已经发出，哈希不一致时不生成清单，这些分块不会被引用
+	fileHash := hex.EncodeToString(hasher.Sum(nil))
+	if hashMismatch(w, expectedHash, fileHash) {
+		job.finish(fmt.Errorf("SHA-256 校验失败，客户端: %s，服务端: %s", expectedHash, fileHash))
+		return
+	}
+
+	chunks := make([]string, len(chunkSizes))
+	for i := range chunks {
+		chunks[i] = fileIDs[i]
+	}
+	tmpDir, err := os.MkdirTemp("", "upload_")
+	if err != nil {
+		job.finish(err)
+		http.Error(w, "创建临时目录失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+	source := uploadProvenance(r, anonymous)
+	meta := &manifest{Filename: origFilename, Chunks: chunks, SHA256: fileHash, Size: totalSize, Codec: codec, ChunkSizes: chunkSizes, ChunkHashes: chunkHashes, Source: &source, Storage: storage}
+	msg, err := p.sendManifest(chatID, tmpDir, meta)
+	if err != nil {
+		job.finish(err)
+		p.alert(eventUploadFailed, origFilename, "文件上传失败", fmt.Sprintf("%s: %v", origFilename, err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wal.remove()
+	p.forgetChunkMessages(uploadID, chatID)
+	job.finish(nil)
+
+	fileID := msg.Document.FileID
+	result := UploadResult{
+		Filename:    origFilename,
+		FileID:      fileID,
+		DownloadURL: p.chunkedDownloadURL(p.requestBase(r), fileID, origFilename),
+		MessageID:   msg.MessageID,
+		MessageURL:  messageLink(msg.Chat, msg.MessageID),
+		SHA256:      fileHash,
+		Storage:     storage,
+		UploadPath:  "streaming",
+		parts:       manifestParts(meta),
+	}
+	p.finishUpload(w, r, &result, totalSize, anonymous, true)
+}
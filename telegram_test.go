@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram 代替 api.telegram.org 的 RoundTripper：每个 Bot 只能解析 files 中属于自己 token 的 file_id，
+// 其他 Bot API 方法一律返回成功，并按「token/方法」记录调用
+type fakeTelegram struct {
+	mu    sync.Mutex
+	files map[string]map[string][]byte // token -> file_id -> 内容
+	calls []string
+}
+
+func newFakeTelegram() *fakeTelegram {
+	return &fakeTelegram{files: make(map[string]map[string][]byte)}
+}
+
+// addFile 让 token 对应的 Bot 可以下载 fileID
+func (f *fakeTelegram) addFile(token, fileID string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.files[token] == nil {
+		f.files[token] = make(map[string][]byte)
+	}
+	f.files[token][fileID] = data
+}
+
+// called 该 Bot 调用 method 的次数
+func (f *fakeTelegram) called(token, method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == token+"/"+method {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeTelegram) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rest, ok := strings.CutPrefix(req.URL.Path, "/file/bot"); ok {
+		token, fileID, _ := strings.Cut(rest, "/")
+		f.calls = append(f.calls, token+"/download")
+		if data, ok := f.files[token][fileID]; ok {
+			return fakeResponse(http.StatusOK, string(data)), nil
+		}
+		return fakeResponse(http.StatusNotFound, "Not Found"), nil
+	}
+	token, method, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/bot"), "/")
+	f.calls = append(f.calls, token+"/"+method)
+	switch method {
+	case "getMe":
+		return fakeResponse(http.StatusOK, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`), nil
+	case "getFile":
+		_ = req.ParseForm()
+		fileID := req.PostForm.Get("file_id")
+		data, ok := f.files[token][fileID]
+		if !ok {
+			return fakeResponse(http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: invalid file_id"}`), nil
+		}
+		return fakeResponse(http.StatusOK, fmt.Sprintf(`{"ok":true,"result":{"file_id":%q,"file_size":%d,"file_path":%q}}`, fileID, len(data), fileID)), nil
+	}
+	return fakeResponse(http.StatusOK, `{"ok":true,"result":true}`), nil
+}
+
+func fakeResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+// newTestServer 为 profiles 创建连接到 tg 的 Bot 并组装服务实例，各 profile 直接处于就绪状态
+func newTestServer(t *testing.T, tg *fakeTelegram, opts serverOptions, profiles ...*profile) *server {
+	t.Helper()
+	for _, p := range profiles {
+		bot, err := tgbotapi.NewBotAPIWithClient(p.BotToken, tgbotapi.APIEndpoint, &http.Client{Transport: tg})
+		if err != nil {
+			t.Fatalf("创建 Bot 失败: %v", err)
+		}
+		p.bot = bot
+	}
+	s, err := newServer(profiles, opts)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	for _, p := range profiles {
+		close(p.ready)
+	}
+	return s
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// isLongPoll 是否为 getUpdates 长轮询请求，没有新消息时会一直等到轮询超时（60 秒）才返回
+func isLongPoll(req *http.Request) bool {
+	return strings.HasSuffix(req.URL.Path, "/getUpdates")
+}
+
+// contextClient 把 ctx 附加到 Bot 发出的每个请求上：tgbotapi 的方法不接受 context，
+// 但所有请求都经过 BotAPI.Client，请求方断开或超时后正在进行的 Telegram 调用随之取消。
+// 同时记录 Telegram 返回的 429，供 /api/admin/status 展示限流状态，并把每次请求的结果交给熔断器
+type contextClient struct {
+	ctx     context.Context
+	next    tgbotapi.HTTPClient
+	breaker *circuitBreaker // 为 nil 时不熔断
+	// timeout 单次 Telegram 请求（Bot API 调用或文件下载，包括读取响应体）的超时，为 0 时不限制。
+	// getUpdates 长轮询本身就会等待到轮询超时才返回，不受该超时限制
+	timeout time.Duration
+}
+
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	// 长轮询不受熔断限制，它的成功也用于判断 Telegram 是否恢复
+	longPoll := isLongPoll(req)
+	var probe bool
+	if !longPoll {
+		var err error
+		if probe, err = c.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := c.ctx, context.CancelFunc(func() {})
+	if c.timeout > 0 && !longPoll {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
+	resp, err := c.next.Do(req.WithContext(ctx))
+	if err != nil {
+		if !longPoll {
+			c.breaker.record(probe, 0, err)
+		}
+		cancel()
+		return nil, err
+	}
+	if longPoll {
+		c.breaker.recordPoll(resp.StatusCode)
+	} else {
+		c.breaker.record(probe, resp.StatusCode, nil)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// 限流响应很小，读出 retry_after 后放回
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		var body struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		json.Unmarshal(data, &body)
+		recordRateLimit(body.Parameters.RetryAfter)
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	// 超时覆盖读取响应体，关闭响应体时释放
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// withContext 返回共用 Token 与连接池、但请求绑定 ctx 的 Bot 副本，用于处理单个 HTTP 请求
+func withContext(ctx context.Context, bot *tgbotapi.BotAPI) *tgbotapi.BotAPI {
+	c, ok := bot.Client.(contextClient)
+	if !ok {
+		c = contextClient{next: bot.Client}
+	}
+	c.ctx = ctx
+	b := *bot
+	b.Client = c
+	return &b
+}
+
+// botFor 该请求使用的 Bot，客户端断开后不再继续从 Telegram 拉取
+func (p *profile) botFor(r *http.Request) *tgbotapi.BotAPI {
+	return withContext(r.Context(), p.bot)
+}
+
+// telegramGet 通过 Bot 的 HTTP 客户端下载 Telegram 文件，与 Bot API 调用共用代理、ctx 与超时
+func telegramGet(bot *tgbotapi.BotAPI, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return bot.Client.Do(req)
+}
+
+// isCanceled 请求方已断开，此时的失败不是 Telegram 的问题，不重试也不告警
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// telegramLimits Telegram 返回 429 的统计，retry_after 内视为仍在限流
+var telegramLimits struct {
+	sync.Mutex
+	count int64
+	last  time.Time
+	until time.Time
+}
+
+func recordRateLimit(retryAfter int) {
+	telegramLimits.Lock()
+	defer telegramLimits.Unlock()
+	now := time.Now()
+	telegramLimits.count++
+	telegramLimits.last = now
+	if until := now.Add(time.Duration(retryAfter) * time.Second); until.After(telegramLimits.until) {
+		telegramLimits.until = until
+	}
+}
+
+// TelegramLimitStatus Telegram 限流状态
+type TelegramLimitStatus struct {
+	Limited bool       `json:"limited"`
+	Until   *time.Time `json:"until,omitempty"`
+	Last    *time.Time `json:"last,omitempty"`
+	Count   int64      `json:"count"`
+}
+
+func telegramLimitStatus() TelegramLimitStatus {
+	telegramLimits.Lock()
+	defer telegramLimits.Unlock()
+	st := TelegramLimitStatus{Count: telegramLimits.count}
+	if !telegramLimits.last.IsZero() {
+		last := telegramLimits.last
+		st.Last = &last
+	}
+	if time.Now().Before(telegramLimits.until) {
+		until := telegramLimits.until
+		st.Limited, st.Until = true, &until
+	}
+	return st
+}
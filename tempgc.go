@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tempGCStats 临时目录清理的累计统计
+var tempGCStats struct {
+	Runs           atomic.Int64
+	RemovedDirs    atomic.Int64
+	ReclaimedBytes atomic.Int64
+}
+
+// runTempGC 启动时先清理一次，之后每隔 interval 清理超过 maxAge 未更新的 upload_* 临时目录，
+// maxAge 为 0 时关闭清理
+func runTempGC(maxAge, interval time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+	sweepTempDirs(maxAge)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sweepTempDirs(maxAge)
+	}
+}
+
+// sweepTempDirs 删除过期的临时上传目录，返回删除的目录数与回收的字节数
+func sweepTempDirs(maxAge time.Duration) (int, int64) {
+	tempGCStats.Runs.Add(1)
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		log.Println("读取临时目录失败:", err)
+		return 0, 0
+	}
+
+	var removed int
+	var reclaimed int64
+	deadline := time.Now().Add(-maxAge)
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), "upload_") {
+			continue
+		}
+		dir := filepath.Join(os.TempDir(), e.Name())
+		size, lastMod := dirUsage(dir)
+		if lastMod.After(deadline) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("删除过期临时目录 %s 失败: %v", dir, err)
+			continue
+		}
+		removed++
+		reclaimed += size
+	}
+
+	// 长时间没有续传的上传日志和分块消息记录也一并清理
+	if wals, err := os.ReadDir(walDir); err == nil {
+		for _, e := range wals {
+			info, err := e.Info()
+			if err != nil || e.IsDir() || !(strings.HasSuffix(e.Name(), ".wal") || strings.HasSuffix(e.Name(), ".msgs")) || info.ModTime().After(deadline) {
+				continue
+			}
+			if os.Remove(filepath.Join(walDir, e.Name())) == nil {
+				reclaimed += info.Size()
+			}
+		}
+	}
+
+	if removed > 0 {
+		tempGCStats.RemovedDirs.Add(int64(removed))
+		tempGCStats.ReclaimedBytes.Add(reclaimed)
+		log.Printf("已清理 %d 个过期临时目录，回收空间 %s", removed, formatSize(reclaimed))
+	}
+	return removed, reclaimed
+}
+
+// dirUsage 统计目录占用以及目录内最近一次修改时间，正在进行的上传会不断写入分块，不会被误删
+func dirUsage(dir string) (int64, time.Time) {
+	var size int64
+	var lastMod time.Time
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			size += info.Size()
+		}
+		if info.ModTime().After(lastMod) {
+			lastMod = info.ModTime()
+		}
+		return nil
+	})
+	return size, lastMod
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// telegramLogin 为 true 时登录页显示「使用 Telegram 登录」，需要先在 BotFather 中用 /setdomain 绑定域名
+	telegramLogin bool
+)
+
+// telegramAuthMaxAge 登录组件返回的数据超过该时间视为过期，防止截获的回调被重放
+const telegramAuthMaxAge = 24 * time.Hour
+
+// checkTelegramAuth 校验 Telegram 登录组件回传的数据：除 hash 外的字段按 key 排序拼成 key=value 换行分隔的字符串，
+// 以 Bot Token 的 SHA-256 为密钥计算 HMAC-SHA256，与 hash 比较。校验通过时返回用户 ID
+func checkTelegramAuth(botToken string, values url.Values) (int64, error) {
+	hash := values.Get("hash")
+	if hash == "" {
+		return 0, errors.New("缺少 hash")
+	}
+	var lines []string
+	for key := range values {
+		if key != "hash" {
+			lines = append(lines, key+"="+values.Get(key))
+		}
+	}
+	sort.Strings(lines)
+
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return 0, errors.New("签名校验失败")
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil || time.Since(time.Unix(authDate, 0)) > telegramAuthMaxAge {
+		return 0, errors.New("登录信息已过期，请重新登录")
+	}
+	id, err := strconv.ParseInt(values.Get("id"), 10, 64)
+	if err != nil {
+		return 0, errors.New("用户 ID 无效")
+	}
+	return id, nil
+}
+
+// canLogin CHAT_ID 对应的用户、管理员和该 profile 的 allowed_user_ids 可以通过 Telegram 登录
+func (p *profile) canLogin(userID int64) bool {
+	return p.isAdmin(userID) || slices.Contains(p.AllowedUserIDs, userID)
+}
+
+// handleTelegramLogin POST /auth/telegram，表单为登录组件回调中的用户字段，校验通过后与 /verify 一样下发登录 Cookie
+func (p *profile) handleTelegramLogin(w http.ResponseWriter, r *http.Request) {
+	if !telegramLogin {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "解析表单失败", http.StatusBadRequest)
+		return
+	}
+	userID, err := checkTelegramAuth(p.BotToken, r.PostForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !p.canLogin(userID) {
+		http.Error(w, "该 Telegram 账号无权访问", http.StatusForbidden)
+		return
+	}
+	p.setAuthCookie(w, r)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// handleLoginOptions GET /api/login-options，登录页据此决定是否显示 Telegram 登录组件
+func (p *profile) handleLoginOptions(w http.ResponseWriter, r *http.Request) {
+	options := struct {
+		TelegramBot string `json:"telegram_bot,omitempty"`
+	}{}
+	if telegramLogin {
+		options.TelegramBot = p.bot.Self.UserName
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
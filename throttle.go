@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶限速，rate 为每秒补充的令牌数，为 nil 时不限速
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait 取走 n 个令牌，不足时阻塞到补足为止；n 超过桶容量时允许余额为负，由后续请求等待偿还
+func (b *tokenBucket) wait(n float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= n
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	time.Sleep(delay)
+}
+
+var (
+	// backgroundBandwidth 低优先级上传发送到 Telegram 的总带宽（字节/秒）
+	backgroundBandwidth *tokenBucket
+	// backgroundChunkRate 低优先级上传每秒发送的分块数
+	backgroundChunkRate *tokenBucket
+)
+
+// isLowPriority 后台同步任务通过 priority=low 表单字段或 X-Upload-Priority: low 请求头标记上传，
+// 这类上传串行发送分块并受带宽、分块速率限制，避免后台同步占满 Telegram 接口
+func isLowPriority(r *http.Request) bool {
+	v := r.Header.Get("X-Upload-Priority")
+	if v == "" {
+		v = r.FormValue("priority")
+	}
+	return strings.EqualFold(v, "low")
+}
+
+// throttleBackground 低优先级上传发送 size 字节之前调用
+func throttleBackground(size int64) {
+	backgroundChunkRate.wait(1)
+	backgroundBandwidth.wait(float64(size))
+}
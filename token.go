@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileToken 由密钥和 file_id 计算的下载令牌（能力 URL），无需额外存储即可校验
+func fileToken(secret, fileID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fileID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// expiringToken 带过期时间的分享令牌，过期时间（Unix 秒）参与签名，无法被篡改
+func expiringToken(secret, fileID string, exp int64) string {
+	return fileToken(secret, fileID+"\n"+strconv.FormatInt(exp, 10))
+}
+
+// checkFileToken 校验 token 参数，带 exp 参数时按限时分享链接校验；未配置 DOWNLOAD_TOKEN_SECRET 时不校验
+func (p *profile) checkFileToken(fileID string, q url.Values) bool {
+	if p.DownloadTokenSecret == "" {
+		return true
+	}
+	token := q.Get("token")
+	if expStr := q.Get("exp"); expStr != "" {
+		exp, err := strconv.ParseInt(expStr, 10, 64)
+		if err != nil || time.Now().Unix() > exp {
+			return false
+		}
+		return hmac.Equal([]byte(token), []byte(expiringToken(p.DownloadTokenSecret, fileID, exp)))
+	}
+	return hmac.Equal([]byte(token), []byte(fileToken(p.DownloadTokenSecret, fileID)))
+}
+
+// downloadURL 生成下载链接，启用下载令牌时附带 token 参数
+func (p *profile) downloadURL(base, fileID, filename string) string {
+	return p.fileLink(base, fileID, filename, p.tokenParams(fileID))
+}
+
+// chunkedDownloadURL 分块文件的下载链接，路径形式的链接以原始文件名结尾，方便下载工具据此命名
+func (p *profile) chunkedDownloadURL(base, manifestID, name string) string {
+	return p.namedFileLink(base, manifestID, "", name, p.tokenParams(manifestID))
+}
+
+// tokenParams 启用下载令牌时链接需要附带的 token 参数
+func (p *profile) tokenParams(fileID string) url.Values {
+	if p.DownloadTokenSecret == "" {
+		return nil
+	}
+	return url.Values{"token": {fileToken(p.DownloadTokenSecret, fileID)}}
+}
+
+// shareURL 生成在 ttl 后失效的分享链接，需要配置 DOWNLOAD_TOKEN_SECRET，否则 /d 本身不校验令牌
+func (p *profile) shareURL(base, fileID, filename string, ttl time.Duration) (string, time.Time, error) {
+	if p.DownloadTokenSecret == "" {
+		return "", time.Time{}, fmt.Errorf("未配置 DOWNLOAD_TOKEN_SECRET，无法生成限时链接")
+	}
+	expAt := time.Now().Add(ttl)
+	exp := expAt.Unix()
+	link := p.fileLink(base, fileID, filename, url.Values{
+		"exp":   {strconv.FormatInt(exp, 10)},
+		"token": {expiringToken(p.DownloadTokenSecret, fileID, exp)},
+	})
+	return link, expAt, nil
+}
+
+// parseTTL 解析有效期，除 time.ParseDuration 支持的格式外还支持 7d、2w 这类按天、周的写法
+func parseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("有效期格式错误: %s", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("有效期格式错误: %s", s)
+	}
+	return d, nil
+}
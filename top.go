@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// topInterval tg-disk top 的刷新间隔
+const topInterval = 2 * time.Second
+
+// ANSI 颜色，设置 NO_COLOR 时不使用
+var (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiDim    = "\033[2m"
+)
+
+// runTop tg-disk top：每 2 秒请求一次 /api/admin/status，在终端中刷新显示进行中的传输、上传队列、
+// Telegram 限流状态与最近的错误，Ctrl+C 退出。使用与服务相同的 .env 读取 ADMIN_TOKEN 与端口
+func runTop(base, adminToken, basicUser, basicPass string) int {
+	if adminToken == "" {
+		fmt.Fprintln(os.Stderr, "需要配置 ADMIN_TOKEN（或 -admin_token）才能读取服务状态")
+		return 1
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		ansiReset, ansiBold, ansiRed, ansiGreen, ansiYellow, ansiDim = "", "", "", "", "", ""
+	}
+	base = strings.TrimRight(base, "/")
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	// 隐藏光标，退出时恢复
+	fmt.Print("\033[?25l")
+	defer fmt.Print("\033[?25h")
+
+	ticker := time.NewTicker(topInterval)
+	defer ticker.Stop()
+	for {
+		st, err := fetchAdminStatus(client, base, adminToken, basicUser, basicPass)
+		// 回到左上角覆盖上一屏，清除多余的行，避免整屏清空造成闪烁
+		fmt.Print("\033[H" + renderTop(base, st, err) + "\033[J")
+		select {
+		case <-interrupt:
+			fmt.Println()
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+func fetchAdminStatus(client *http.Client, base, adminToken, basicUser, basicPass string) (*AdminStatus, error) {
+	req, err := http.NewRequest(http.MethodGet, base+"/api/admin/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	// 同时开启 Basic 认证时 Authorization 头被占用，管理员令牌改用查询参数
+	if basicUser != "" && basicPass != "" {
+		req.SetBasicAuth(basicUser, basicPass)
+		req.URL.RawQuery = "admin_token=" + adminToken
+	} else {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("返回状态异常: %s", resp.Status)
+	}
+	var st AdminStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, fmt.Errorf("解析状态失败: %v", err)
+	}
+	return &st, nil
+}
+
+func colored(color, s string) string {
+	return color + s + ansiReset
+}
+
+// renderTop 生成一屏内容，行尾带 \033[K 清除上次残留
+func renderTop(base string, st *AdminStatus, fetchErr error) string {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format+"\033[K\n", args...)
+	}
+	now := time.Now()
+	if fetchErr != nil {
+		line("%s  %s  %s", colored(ansiBold, "tg-disk top"), base, now.Format("15:04:05"))
+		line("")
+		line("%s", colored(ansiRed, "无法获取状态: "+fetchErr.Error()))
+		return b.String()
+	}
+	line("%s  %s  版本 %s  运行 %s  %s", colored(ansiBold, "tg-disk top"), base, st.Version,
+		time.Duration(st.UptimeSeconds)*time.Second, now.Format("15:04:05"))
+	line("")
+
+	switch {
+	case st.Breaker.Open:
+		line("Telegram  %s", colored(ansiRed, fmt.Sprintf("无法连接，已熔断，%s 再次探测：%s", st.Breaker.Until.Local().Format("15:04:05"), truncateRunes(st.Breaker.LastError, 60))))
+	case st.Telegram.Limited:
+		line("Telegram  %s", colored(ansiRed, fmt.Sprintf("限流中，%s 解除", st.Telegram.Until.Local().Format("15:04:05"))))
+	case st.Telegram.Last != nil && now.Sub(*st.Telegram.Last) < 10*time.Minute:
+		line("Telegram  %s", colored(ansiYellow, fmt.Sprintf("正常，%s 前曾被限流（累计 %d 次）", now.Sub(*st.Telegram.Last).Round(time.Second), st.Telegram.Count)))
+	default:
+		line("Telegram  %s", colored(ansiGreen, fmt.Sprintf("正常（累计限流 %d 次）", st.Telegram.Count)))
+	}
+
+	if st.Maintenance.Enabled {
+		line("维护模式  %s", colored(ansiYellow, "开启，只能下载："+st.Maintenance.Message))
+	}
+
+	upColor := ansiGreen
+	if st.Uploads.Queued > 0 {
+		upColor = ansiYellow
+	}
+	limit := "不限"
+	if st.Uploads.Max > 0 {
+		limit = fmt.Sprint(st.Uploads.Max)
+	}
+	line("上传队列  %s", colored(upColor, fmt.Sprintf("进行中 %d / %s，排队 %d", st.Uploads.Active, limit, st.Uploads.Queued)))
+
+	if st.Buffers.Limit > 0 {
+		pct := st.Buffers.Used * 100 / st.Buffers.Limit
+		bufColor := ansiGreen
+		if pct >= 100 || st.Buffers.Rejected > 0 {
+			bufColor = ansiRed
+		} else if pct >= 80 {
+			bufColor = ansiYellow
+		}
+		line("传输缓冲  %s", colored(bufColor, fmt.Sprintf("%s / %s（%d%%），已拒绝 %d 次", formatSize(st.Buffers.Used), formatSize(st.Buffers.Limit), pct, st.Buffers.Rejected)))
+	} else {
+		line("传输缓冲  %s（不限）", formatSize(st.Buffers.Used))
+	}
+
+	for _, p := range st.Profiles {
+		state := colored(ansiGreen, "已连接")
+		if !p.Ready {
+			state = colored(ansiYellow, "连接中")
+		}
+		if p.UploadsPaused {
+			state += " " + colored(ansiYellow, "上传已暂停")
+		}
+		quota := formatSize(p.QuotaUsed)
+		if p.QuotaLimit > 0 {
+			quota += " / " + formatSize(p.QuotaLimit)
+			if p.QuotaUsed >= p.QuotaLimit {
+				quota = colored(ansiRed, quota)
+			}
+		}
+		line("Profile   %s  %s  今日上传 %s", p.Name, state, quota)
+	}
+
+	line("")
+	line("%s", colored(ansiBold, fmt.Sprintf("进行中的传输（%d）", len(st.Transfers))))
+	if len(st.Transfers) == 0 {
+		line("%s", colored(ansiDim, "  无"))
+	} else {
+		// 中文标题每个字占两列，宽度相应减少，与下方数据列对齐
+		line("%s", colored(ansiDim, fmt.Sprintf("  %-8s %7s %7s %8s  %-12s %s", "类型", "时长", "已传输", "速度", "客户端", "名称")))
+	}
+	for _, t := range st.Transfers {
+		elapsed := now.Sub(t.Started)
+		speed := "-"
+		if secs := elapsed.Seconds(); secs >= 1 {
+			speed = formatSize(int64(float64(t.Bytes)/secs)) + "/s"
+		}
+		kind := colored(ansiGreen, fmt.Sprintf("%-8s", "下载"))
+		if t.Kind == "upload" {
+			kind = colored(ansiYellow, fmt.Sprintf("%-8s", "上传"))
+		}
+		line("  %s %9s %10s %10s  %-15s %s", kind, elapsed.Round(time.Second), formatSize(t.Bytes), speed, t.ClientIP, truncateRunes(t.Name, 48))
+	}
+
+	line("")
+	line("%s", colored(ansiBold, "最近的错误"))
+	if len(st.Errors) == 0 {
+		line("%s", colored(ansiDim, "  无"))
+	}
+	for i, e := range st.Errors {
+		if i == 10 {
+			break
+		}
+		color := ansiRed
+		if now.Sub(e.Time) > 10*time.Minute {
+			color = ansiDim
+		}
+		line("  %s", colored(color, fmt.Sprintf("%s  %s  %s", e.Time.Local().Format("01-02 15:04:05"), e.Source, truncateRunes(e.Message, 80))))
+	}
+	line("")
+	line("%s", colored(ansiDim, "Ctrl+C 退出"))
+	return b.String()
+}
+
+// truncateRunes 超过 n 个字符时截断并加上省略号
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// activeTransfer 一个进行中的上传或下载，供 /api/admin/status 与 tg-disk top 展示
+type activeTransfer struct {
+	kind     string
+	name     string
+	clientIP string
+	started  time.Time
+	bytes    atomic.Int64
+}
+
+// TransferInfo 进行中传输的快照
+type TransferInfo struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	ClientIP string    `json:"client_ip"`
+	Started  time.Time `json:"started"`
+	Bytes    int64     `json:"bytes"`
+}
+
+var transfers = struct {
+	sync.Mutex
+	items map[*activeTransfer]struct{}
+}{items: make(map[*activeTransfer]struct{})}
+
+// trackTransfer 在处理期间登记传输，上传统计已读取的请求体字节数，下载统计已写出的字节数
+func trackTransfer(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := &activeTransfer{kind: kind, name: transferName(r), clientIP: clientIP(r), started: time.Now()}
+		transfers.Lock()
+		transfers.items[t] = struct{}{}
+		transfers.Unlock()
+		defer func() {
+			transfers.Lock()
+			delete(transfers.items, t)
+			transfers.Unlock()
+		}()
+		if r.Body != nil {
+			r.Body = &countingBody{ReadCloser: r.Body, n: &t.bytes}
+		}
+		if kind == "download" {
+			w = &countingWriter{ResponseWriter: w, n: &t.bytes}
+		}
+		next(w, r)
+	}
+}
+
+// transferName 日志与面板中显示的名称：文件名、file_id 或 upload_id，都没有时为请求路径
+func transferName(r *http.Request) string {
+	q := r.URL.Query()
+	for _, key := range []string{"filename", "file_id", "upload_id"} {
+		if v := q.Get(key); v != "" {
+			return v
+		}
+	}
+	return r.URL.Path
+}
+
+// activeTransfers 按开始时间排序的进行中传输
+func activeTransfers() []TransferInfo {
+	transfers.Lock()
+	list := make([]TransferInfo, 0, len(transfers.items))
+	for t := range transfers.items {
+		list = append(list, TransferInfo{Kind: t.kind, Name: t.name, ClientIP: t.clientIP, Started: t.started, Bytes: t.bytes.Load()})
+	}
+	transfers.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// countingWriter 统计写出的字节数，保留 Flush 以支持边下载边写出
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tuneMinSamples 每个候选分块大小至少发送的分块数，样本不足时优先尝试
+	tuneMinSamples = 5
+	// tuneExploreEvery 每隔多少次上传重新尝试样本最少的分块大小，网络状况变化后可以及时调整
+	tuneExploreEvery = 10
+	// tuneAlpha 吞吐量指数移动平均的权重
+	tuneAlpha = 0.2
+)
+
+// autoTuneChunks 为 true 时（CHUNK_SIZE_AUTO=true）根据各分块大小的实际吞吐量和失败率选择分块大小
+var autoTuneChunks bool
+
+// chunkTuner 按分块大小统计上传吞吐量。失败的分块计为吞吐量 0，
+// 因此移动平均同时反映速度与失败率：快但不稳定的线路会倾向更小的分块
+type chunkTuner struct {
+	mu    sync.Mutex
+	sizes []int
+	stats map[int]*chunkSizeStats
+	picks int
+}
+
+type chunkSizeStats struct {
+	Chunks   int64   `json:"chunks"`
+	Failures int64   `json:"failures"`
+	Bytes    int64   `json:"bytes"`
+	Seconds  float64 `json:"seconds"`  // 成功发送的分块累计耗时
+	EWMA     float64 `json:"ewma_bps"` // 吞吐量移动平均（字节/秒），失败计为 0
+	AvgBPS   float64 `json:"avg_bps"`  // 成功分块的平均吞吐量（字节/秒）
+}
+
+// 候选分块大小，不能超过 Telegram Bot API 的 20MB 下载上限
+var tuner = newChunkTuner([]int{5 * 1024 * 1024, 10 * 1024 * 1024, chunkSize})
+
+func newChunkTuner(sizes []int) *chunkTuner {
+	t := &chunkTuner{sizes: sizes, stats: make(map[int]*chunkSizeStats)}
+	for _, size := range sizes {
+		t.stats[size] = &chunkSizeStats{}
+	}
+	return t
+}
+
+// record 记录一个分块的发送结果，size 为该次上传使用的分块大小，n 为分块实际字节数
+func (t *chunkTuner) record(size int, n int64, elapsed time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[size]
+	if !ok {
+		s = &chunkSizeStats{}
+		t.stats[size] = s
+	}
+	sample := 0.0
+	if err != nil {
+		s.Failures++
+	} else {
+		s.Bytes += n
+		s.Seconds += elapsed.Seconds()
+		if elapsed > 0 {
+			sample = float64(n) / elapsed.Seconds()
+		}
+	}
+	if s.Chunks == 0 {
+		s.EWMA = sample
+	} else {
+		s.EWMA = (1-tuneAlpha)*s.EWMA + tuneAlpha*sample
+	}
+	s.Chunks++
+}
+
+// pick 选择本次上传的分块大小，未开启自动调整时固定为 chunkSize
+func (t *chunkTuner) pick() int {
+	if !autoTuneChunks {
+		return chunkSize
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.picks++
+
+	least := t.sizes[0]
+	for _, size := range t.sizes {
+		if t.stats[size].Chunks < t.stats[least].Chunks {
+			least = size
+		}
+	}
+	if t.stats[least].Chunks < tuneMinSamples || t.picks%tuneExploreEvery == 0 {
+		return least
+	}
+	return t.bestLocked()
+}
+
+func (t *chunkTuner) bestLocked() int {
+	best := t.sizes[len(t.sizes)-1]
+	for _, size := range t.sizes {
+		if t.stats[size].EWMA > t.stats[best].EWMA {
+			best = size
+		}
+	}
+	return best
+}
+
+// snapshot 各分块大小的统计，键为分块字节数，供 /debug/vars 使用
+func (t *chunkTuner) snapshot() map[string]chunkSizeStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]chunkSizeStats, len(t.stats))
+	for size, s := range t.stats {
+		c := *s
+		if c.Seconds > 0 {
+			c.AvgBPS = float64(c.Bytes) / c.Seconds
+		}
+		out[fmt.Sprint(size)] = c
+	}
+	return out
+}
+
+// statusText /status 中各分块大小的统计，没有数据时返回空字符串
+func (t *chunkTuner) statusText() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sizes := make([]int, 0, len(t.stats))
+	for size, s := range t.stats {
+		if s.Chunks > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		return ""
+	}
+	sort.Ints(sizes)
+	var b strings.Builder
+	if autoTuneChunks {
+		fmt.Fprintf(&b, "分块大小自动调整：当前最佳 %s\n", formatSize(int64(t.bestLocked())))
+	}
+	for _, size := range sizes {
+		s := t.stats[size]
+		avg := 0.0
+		if s.Seconds > 0 {
+			avg = float64(s.Bytes) / s.Seconds
+		}
+		fmt.Fprintf(&b, "分块 %s：%d 块，失败 %d，平均 %s/s\n", formatSize(int64(size)), s.Chunks, s.Failures, formatSize(int64(avg)))
+	}
+	return b.String()
+}
+
+// uploadChunkSize 本次上传使用的分块大小。带 upload_id 的上传可能中断后续传，
+// 续传时必须按相同大小分块才能复用已上传的分块，因此固定为 chunkSize
+func uploadChunkSize(uploadID string) int {
+	if uploadID != "" {
+		return chunkSize
+	}
+	return tuner.pick()
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadLink 限时上传链接，持有者不需要访问密码即可通过 /u/{token} 上传，但不能下载或管理其他文件
+type uploadLink struct {
+	Token     string    `json:"token"`
+	Label     string    `json:"label"`              // 上传的文件来源中记录的标签，例如对方的名字
+	MaxSize   int64     `json:"max_size,omitempty"` // 单个文件的大小上限，0 表示不限制
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (l *uploadLink) expired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
+
+// uploadLinkStore 上传链接，按 profile/token 保存在 JSON 文件中，过期的链接在下次保存时清理
+type uploadLinkStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*uploadLink
+}
+
+func loadUploadLinkStore(path string) (*uploadLinkStore, error) {
+	st := &uploadLinkStore{path: path, items: make(map[string]*uploadLink)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取上传链接失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st.items); err != nil {
+		return nil, fmt.Errorf("解析上传链接失败: %v", err)
+	}
+	return st, nil
+}
+
+// create 生成新的上传链接
+func (st *uploadLinkStore) create(profile, label string, maxSize int64, ttl time.Duration) (*uploadLink, error) {
+	if st == nil {
+		return nil, errors.New("未开启上传链接")
+	}
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	now := time.Now()
+	l := &uploadLink{Token: hex.EncodeToString(b), Label: label, MaxSize: maxSize, ExpiresAt: now.Add(ttl), CreatedAt: now}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, e := range st.items {
+		if e.expired() {
+			delete(st.items, key)
+		}
+	}
+	key := profile + "/" + l.Token
+	st.items[key] = l
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		delete(st.items, key)
+		return nil, fmt.Errorf("保存上传链接失败: %v", err)
+	}
+	return l, nil
+}
+
+// get 返回未过期的上传链接
+func (st *uploadLinkStore) get(profile, token string) (*uploadLink, bool) {
+	if st == nil {
+		return nil, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	l, ok := st.items[profile+"/"+token]
+	if !ok || l.expired() {
+		return nil, false
+	}
+	return l, true
+}
+
+// list 按创建时间返回该 profile 未过期的上传链接
+func (st *uploadLinkStore) list(profile string) []*uploadLink {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	list := []*uploadLink{}
+	for key, l := range st.items {
+		if strings.HasPrefix(key, profile+"/") && !l.expired() {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (st *uploadLinkStore) revoke(profile, token string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := profile + "/" + token
+	l, ok := st.items[key]
+	if !ok {
+		return false, nil
+	}
+	delete(st.items, key)
+	if err := writeJSONFile(st.path, st.items); err != nil {
+		st.items[key] = l
+		return false, fmt.Errorf("保存上传链接失败: %v", err)
+	}
+	return true, nil
+}
+
+type uploadLinkKey struct{}
+
+// uploadLinkFrom 通过 /u/{token} 上传时返回对应的上传链接
+func uploadLinkFrom(r *http.Request) *uploadLink {
+	l, _ := r.Context().Value(uploadLinkKey{}).(*uploadLink)
+	return l
+}
+
+// uploadAuthorized 上传是否带有访问密码、登录 Cookie，或来自有效的上传链接
+func (p *profile) uploadAuthorized(r *http.Request, pwd string) bool {
+	return pwd == p.AccessPwd || p.isAuthenticated(r) || uploadLinkFrom(r) != nil
+}
+
+// uploadLinkURL 上传链接的完整地址
+func (p *profile) uploadLinkURL(base string, l *uploadLink) string {
+	return strings.TrimRight(base, "/") + "/u/" + l.Token
+}
+
+// handleUploadLink /u/{token}：GET 返回上传页面（带 info=1 时返回标签、有效期等信息），
+// POST 与 /upload 相同，但不需要访问密码，文件大小不能超过链接的上限
+func (p *profile) handleUploadLink(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/u/")
+	l, ok := p.srv.uploadLinks.get(p.Name, token)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "上传链接不存在或已过期")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("info") == "1" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"label": l.Label, "max_size": l.MaxSize, "expires_at": l.ExpiresAt})
+			return
+		}
+		page, err := embeddedFiles.ReadFile("static/u.html")
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(page)
+	case http.MethodPost:
+		if l.MaxSize > 0 {
+			if r.ContentLength > l.MaxSize+multipartOverhead {
+				writeError(w, r, http.StatusRequestEntityTooLarge, errCodeTooLarge, "文件超过该上传链接的大小上限 "+formatSize(l.MaxSize))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, l.MaxSize+multipartOverhead)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), uploadLinkKey{}, l))
+		reqLog(r, "通过上传链接（%s）上传", l.Label)
+		p.requireBot(limitPerIP(uploadLimiter, p.queueUploads(trackTransfer("upload", p.handleUpload))))(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "只支持 GET、POST")
+	}
+}
+
+// multipartOverhead 表单字段与 multipart 边界占用的字节数估计，按请求体大小限制文件大小时留出余量
+const multipartOverhead = 64 << 10
+
+// handleUploadLinks /api/upload-links[/{token}]，需要访问密码：GET 列出未过期的上传链接，
+// POST 创建（请求体 {"label":...,"ttl":"7d","max_size":"500MB"}），DELETE 撤销
+func (p *profile) handleUploadLinks(w http.ResponseWriter, r *http.Request) {
+	if p.srv.uploadLinks == nil {
+		writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "未开启上传链接", nil)
+		return
+	}
+	if !p.isAuthenticated(r) {
+		writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "需要访问密码", nil)
+		return
+	}
+	token := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/upload-links"), "/")
+	base := p.BaseURL
+	if base == "" {
+		base = p.requestBase(r)
+	}
+	type linkView struct {
+		*uploadLink
+		URL string `json:"url"`
+	}
+	switch {
+	case r.Method == http.MethodGet && token == "":
+		list := p.srv.uploadLinks.list(p.Name)
+		views := make([]linkView, len(list))
+		for i, l := range list {
+			views[i] = linkView{l, p.uploadLinkURL(base, l)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(views)
+	case r.Method == http.MethodPost && token == "":
+		var req struct {
+			Label   string `json:"label"`
+			TTL     string `json:"ttl"`
+			MaxSize string `json:"max_size"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Label) == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, "请求体应为 {\"label\":...,\"ttl\":\"7d\",\"max_size\":\"500MB\"}", nil)
+			return
+		}
+		l, err := p.createUploadLink(req.Label, req.TTL, req.MaxSize)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(linkView{l, p.uploadLinkURL(base, l)})
+	case r.Method == http.MethodDelete && token != "":
+		ok, err := p.srv.uploadLinks.revoke(p.Name, token)
+		if err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+		if !ok {
+			writeAPIError(w, r, http.StatusNotFound, errCodeNotFound, "上传链接不存在", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAPIError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "不支持的请求方法", nil)
+	}
+}
+
+// createUploadLink 解析有效期（默认 7 天）与大小上限（默认不限制）后创建上传链接，API 与 /upload-link 命令共用
+func (p *profile) createUploadLink(label, ttl, maxSize string) (*uploadLink, error) {
+	d := 7 * 24 * time.Hour
+	if ttl != "" {
+		var err error
+		if d, err = parseTTL(ttl); err != nil {
+			return nil, err
+		}
+	}
+	var size int64
+	if maxSize != "" {
+		var err error
+		if size, err = parseSize(maxSize); err != nil {
+			return nil, err
+		}
+	}
+	return p.srv.uploadLinks.create(p.Name, strings.TrimSpace(label), size, d)
+}
+
+// uploadLinkCommand 处理 /upload-link 标签 [有效期] [大小上限] 命令，例如 /upload-link alice 3d 2GB
+func (p *profile) uploadLinkCommand(args []string) string {
+	if len(args) == 0 {
+		return "用法：/upload-link 标签 [有效期，默认 7d] [大小上限，如 2GB]"
+	}
+	base := p.linkBase()
+	if base == "" {
+		return baseURLMissing
+	}
+	var ttl, maxSize string
+	if len(args) > 1 {
+		ttl = args[1]
+	}
+	if len(args) > 2 {
+		maxSize = args[2]
+	}
+	l, err := p.createUploadLink(args[0], ttl, maxSize)
+	if err != nil {
+		return err.Error()
+	}
+	limit := "不限制大小"
+	if l.MaxSize > 0 {
+		limit = "单个文件不超过 " + formatSize(l.MaxSize)
+	}
+	return fmt.Sprintf("上传链接（%s，%s 前有效，%s）：\n%s", l.Label, l.ExpiresAt.Format("2006-01-02 15:04:05"), limit, p.uploadLinkURL(base, l))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"tg-disk/pkg/transfer"
+)
+
+// variantPreview 低清/压缩版本的变体名，/d?variant=preview 下载
+const variantPreview = "preview"
+
+// telegramPhotoLimit Telegram 照片消息的大小上限，超过后只能以文件形式发送
+const telegramPhotoLimit = 10 << 20
+
+var (
+	// photoPreview 为 true 时图片额外以 Telegram 照片形式保存一份，Telegram 会压缩为适合快速预览的版本
+	photoPreview bool
+	// previewCommand 为视频生成低清预览的外部命令，{in} 与 {out} 分别替换为原文件和输出文件路径
+	previewCommand []string
+)
+
+// uploadVariant 与原始文件一同保存的其他版本
+type uploadVariant = transfer.Variant
+
+// wantsVariants 判断该文件是否会生成变体，大文件需要先拼接出完整文件，不需要时避免多余的磁盘开销
+func (p *profile) wantsVariants(filename string, size int64) bool {
+	contentType := p.srv.mimeTypes.contentTypeFor(filename)
+	switch {
+	case strings.HasPrefix(contentType, "image/") && contentType != "image/svg+xml":
+		return photoPreview && size <= telegramPhotoLimit
+	case strings.HasPrefix(contentType, "video/"):
+		return len(previewCommand) > 0
+	}
+	return false
+}
+
+// uploadVariants 按规则生成变体并上传到存储会话 chatID，变体只是额外的便利，失败时记录日志后跳过，不影响原文件上传
+func (p *profile) uploadVariants(chatID int64, path, filename string, size int64) []uploadVariant {
+	if !p.wantsVariants(filename, size) {
+		return nil
+	}
+	if strings.HasPrefix(p.srv.mimeTypes.contentTypeFor(filename), "image/") {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(path))
+		photo.Caption = "preview"
+		msg, err := p.bot.Send(photo)
+		if err != nil || len(msg.Photo) == 0 {
+			log.Printf("上传图片预览失败: %s，%v", filename, err)
+			return nil
+		}
+		// Photo 按尺寸从小到大排列，取最大的一张
+		largest := msg.Photo[len(msg.Photo)-1]
+		return []uploadVariant{{Name: variantPreview, FileID: largest.FileID, Filename: strings.TrimSuffix(filename, filepath.Ext(filename)) + "_preview.jpg"}}
+	}
+
+	out := filepath.Join(filepath.Dir(path), "preview.mp4")
+	if err := runPreviewCommand(path, out); err != nil {
+		log.Printf("生成视频预览失败: %s，%v", filename, err)
+		return nil
+	}
+	if info, err := os.Stat(out); err != nil || info.Size() > chunkSize {
+		log.Printf("视频预览超过单个文件上限，跳过: %s", filename)
+		return nil
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(out))
+	doc.Caption = "preview"
+	msg, err := p.bot.Send(doc)
+	if err != nil || msg.Document == nil {
+		log.Printf("上传视频预览失败: %s，%v", filename, err)
+		return nil
+	}
+	return []uploadVariant{{Name: variantPreview, FileID: msg.Document.FileID, Filename: strings.TrimSuffix(filename, filepath.Ext(filename)) + "_preview.mp4"}}
+}
+
+// variantURLs 生成各个变体的下载链接
+func (p *profile) variantURLs(r *http.Request, manifestID string, variants []uploadVariant) map[string]string {
+	if len(variants) == 0 {
+		return nil
+	}
+	urls := make(map[string]string, len(variants))
+	for _, v := range variants {
+		params := p.tokenParams(manifestID)
+		if params == nil {
+			params = url.Values{}
+		}
+		params.Set("variant", v.Name)
+		urls[v.Name] = p.fileLink(p.requestBase(r), manifestID, "", params)
+	}
+	return urls
+}
+
+func runPreviewCommand(in, out string) error {
+	args := make([]string, len(previewCommand))
+	for i, a := range previewCommand {
+		args[i] = strings.NewReplacer("{in}", in, "{out}", out).Replace(a)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// joinChunkFiles 把未压缩的分块拼接成完整文件，供生成视频预览使用
+func joinChunkFiles(dst string, paths []string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
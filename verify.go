@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// verifyUploads 为 true 时每个分块上传后立即下载回来比对内容，
+// 在上传时就发现 Telegram 端的截断，而不是几个月后恢复时才发现
+var verifyUploads bool
+
+// verifyBlob 下载刚上传的文件并与发送的内容比对 SHA-256，未开启校验时直接返回
+func verifyBlob(bot *tgbotapi.BotAPI, fileID string, sent []byte) error {
+	if !verifyUploads {
+		return nil
+	}
+	got, err := downloadBlob(bot, fileID)
+	if err != nil {
+		return fmt.Errorf("回读校验失败: %v", err)
+	}
+	want, have := sha256.Sum256(sent), sha256.Sum256(got)
+	if !bytes.Equal(want[:], have[:]) {
+		return fmt.Errorf("回读校验不一致：发送 %d 字节，Telegram 返回 %d 字节", len(sent), len(got))
+	}
+	return nil
+}
+
+// verifyBlobFile 与 verifyBlob 相同，发送的内容从本地文件读取
+func verifyBlobFile(bot *tgbotapi.BotAPI, fileID, path string) error {
+	if !verifyUploads {
+		return nil
+	}
+	sent, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("回读校验失败: %v", err)
+	}
+	return verifyBlob(bot, fileID, sent)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// walDir 分块上传进度日志目录，进程崩溃后重新提交相同 upload_id 的上传时只发送未确认的分块
+var walDir = filepath.Join(os.TempDir(), "tg-disk-wal")
+
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// errUploadInProgress 同一 profile 下相同 upload_id 的上传还没结束
+var errUploadInProgress = errors.New("该 upload_id 正在上传中，请等上一次上传结束后再重试")
+
+// activeUploads 正在进行的上传，key 为 profile/upload_id。同一 upload_id 同时只允许一个上传写入日志，
+// /purge 也不会清理进行中的上传
+var activeUploads = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// lockUpload 标记该 upload_id 正在上传，已在上传中时返回 errUploadInProgress
+func (p *profile) lockUpload(uploadID string) (unlock func(), err error) {
+	key := p.Name + "/" + uploadID
+	activeUploads.Lock()
+	defer activeUploads.Unlock()
+	if activeUploads.keys[key] {
+		return nil, errUploadInProgress
+	}
+	activeUploads.keys[key] = true
+	return func() {
+		activeUploads.Lock()
+		delete(activeUploads.keys, key)
+		activeUploads.Unlock()
+	}, nil
+}
+
+// uploadFile 上传日志与分块消息记录的路径：upload_id 由客户端指定，不同 profile、不同存储会话中可能重复，
+// 因此文件名带上 profile 名称（十六进制编码，避免出现路径字符）与 chat_id
+func (p *profile) uploadFile(uploadID string, chatID int64, ext string) string {
+	return filepath.Join(walDir, fmt.Sprintf("%x_%d_%s%s", p.Name, chatID, uploadID, ext))
+}
+
+// walEntry 一个已确认发送到 Telegram 的分块，按序号和原始内容哈希匹配，内容变化的分块会重新上传
+type walEntry struct {
+	Index  int    `json:"index"`
+	SHA256 string `json:"sha256"`
+	Codec  string `json:"codec,omitempty"`
+	FileID string `json:"file_id"`
+}
+
+// uploadWAL 追加写入的 JSON Lines 文件，每确认一个分块写入一行
+type uploadWAL struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	entries map[int]walEntry
+}
+
+// beginUpload 为一次分块上传占用 upload_id：客户端指定了 upload_id 时同时打开进度日志，未指定时随机生成一个。
+// 同一 upload_id 已在上传中时返回 errUploadInProgress；上传结束后调用 done 关闭日志并释放 upload_id
+func (p *profile) beginUpload(uploadID string, chatID int64) (id string, wal *uploadWAL, done func(), err error) {
+	resumable := uploadID != ""
+	if !resumable {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		uploadID = hex.EncodeToString(b)
+	}
+	unlock, err := p.lockUpload(uploadID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if resumable {
+		if wal, err = p.openUploadWAL(uploadID, chatID); err != nil {
+			unlock()
+			return "", nil, nil, err
+		}
+	}
+	return uploadID, wal, func() {
+		wal.close()
+		unlock()
+	}, nil
+}
+
+// writeUploadIDError beginUpload 失败时的响应：upload_id 正在上传中返回 409，格式错误等返回 400
+func writeUploadIDError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUploadInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// openUploadWAL 打开（或创建）该 profile 在存储会话 chatID 中 upload_id 对应的进度日志并读取已确认的分块，
+// 调用方需要先通过 lockUpload 持有该 upload_id
+func (p *profile) openUploadWAL(uploadID string, chatID int64) (*uploadWAL, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return nil, fmt.Errorf("upload_id 只能包含字母、数字、下划线和短横线，且不超过 128 个字符")
+	}
+	if err := os.MkdirAll(walDir, 0700); err != nil {
+		return nil, fmt.Errorf("创建上传日志目录失败: %v", err)
+	}
+	path := p.uploadFile(uploadID, chatID, ".wal")
+	wal := &uploadWAL{path: path, entries: make(map[int]walEntry)}
+
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var e walEntry
+			// 崩溃时可能留下写了一半的最后一行，直接忽略
+			if json.Unmarshal(sc.Bytes(), &e) == nil && e.FileID != "" {
+				wal.entries[e.Index] = e
+			}
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开上传日志失败: %v", err)
+	}
+	wal.f = f
+	return wal, nil
+}
+
+// lookup 查找内容相同且已上传成功的分块
+func (w *uploadWAL) lookup(index int, sha256, codec string) (string, bool) {
+	if w == nil {
+		return "", false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.entries[index]
+	if !ok || e.SHA256 != sha256 || e.Codec != codec {
+		return "", false
+	}
+	return e.FileID, true
+}
+
+// record 记录分块已上传成功，写入后立即 fsync
+func (w *uploadWAL) record(e walEntry) error {
+	if w == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries[e.Index] = e
+	if _, err := w.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+func (w *uploadWAL) close() {
+	if w != nil {
+		w.f.Close()
+	}
+}
+
+// remove 整个文件上传完成后删除进度日志
+func (w *uploadWAL) remove() {
+	if w != nil {
+		w.f.Close()
+		os.Remove(w.path)
+	}
+}
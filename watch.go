@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// watchPage /watch/{id} 的播放页，视频直接指向支持 Range 的 /d 下载链接
+var watchPage = template.Must(template.New("watch").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Title}}</title>
+    <style>
+        body { margin: 0; background: #000; color: #eee; font-family: sans-serif; }
+        video { display: block; width: 100%; max-height: 90vh; background: #000; }
+        .bar { padding: 10px 15px; font-size: 14px; }
+        .bar a { color: #8ab4f8; }
+    </style>
+</head>
+<body>
+<video controls autoplay playsinline preload="metadata"{{if .Poster}} poster="{{.Poster}}"{{end}}>
+    <source src="{{.Src}}"{{if .Type}} type="{{.Type}}"{{end}}>
+    {{range .Subtitles}}<track kind="subtitles" src="{{.Src}}" label="{{.Label}}"{{if .Default}} default{{end}}>
+    {{end}}
+</video>
+<div class="bar">{{.Title}} · <a href="{{.Download}}">下载</a></div>
+</body>
+</html>
+`))
+
+type watchSubtitle struct {
+	Src     string
+	Label   string
+	Default bool
+}
+
+// handleWatch GET /watch/{id}，filename 与 /d 相同，小文件需要带上，分块文件省略。
+// 通过 /api/files/{id}/sidecars 登记的字幕与封面自动加载；也可以用 sub / sub_name / sub_token（可重复）
+// 与 poster / poster_name / poster_token 临时指定，令牌需要由调用方提供，页面不会为任意 file_id 签发令牌
+func (p *profile) handleWatch(w http.ResponseWriter, r *http.Request) {
+	bot := p.botFor(r)
+	fileID := strings.TrimPrefix(r.URL.Path, "/watch/")
+	if fileID == "" || strings.Contains(fileID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	q := r.URL.Query()
+	filename := q.Get("filename")
+	title := filename
+	if filename == "" {
+		m, err := readManifest(bot, fileID)
+		if isFileGone(err) {
+			p.writeGone(w, r, fileID)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		title = m.Filename
+	}
+
+	// 使用站内相对路径，视频与字幕和页面同源，不需要 CORS
+	base := p.PathPrefix
+	// 沿用访问页面时的令牌，限时分享链接的 exp 也一并带上
+	params := url.Values{}
+	for _, k := range []string{"token", "exp"} {
+		if v := q.Get(k); v != "" {
+			params.Set(k, v)
+		}
+	}
+	download := p.fileLink(base, fileID, filename, params)
+	params.Set("inline", "1")
+	data := struct {
+		Title     string
+		Src       string
+		Type      string
+		Poster    string
+		Download  string
+		Subtitles []watchSubtitle
+	}{
+		Title:    title,
+		Src:      p.fileLink(base, fileID, filename, params),
+		Type:     p.srv.mimeTypes.contentTypeFor(title),
+		Download: download,
+	}
+	// 登记过的字幕与封面自动加载，通过主文件的权限访问
+	for _, sc := range p.srv.sidecars.list(p.Name, fileID) {
+		switch sc.Kind {
+		case sidecarSubtitle:
+			data.Subtitles = append(data.Subtitles, watchSubtitle{
+				Src:     sidecarURL(base, fileID, sc.FileID, params.Get("token"), params.Get("exp")),
+				Label:   strings.TrimSuffix(sc.Filename, filepath.Ext(sc.Filename)),
+				Default: len(data.Subtitles) == 0,
+			})
+		case sidecarCover:
+			if data.Poster == "" {
+				data.Poster = sidecarURL(base, fileID, sc.FileID, params.Get("token"), params.Get("exp"))
+			}
+		}
+	}
+	if poster := q.Get("poster"); poster != "" {
+		data.Poster = buildDownloadURL(base, poster, q.Get("poster_name")) + tokenQuery(q.Get("poster_token"))
+	}
+	names, tokens := q["sub_name"], q["sub_token"]
+	for i, sub := range q["sub"] {
+		name, token := "", ""
+		if i < len(names) {
+			name = names[i]
+		}
+		if i < len(tokens) {
+			token = tokens[i]
+		}
+		sq := url.Values{"file_id": {sub}, "filename": {name}}
+		if token != "" {
+			sq.Set("token", token)
+		}
+		label := strings.TrimSuffix(name, filepath.Ext(name))
+		if label == "" {
+			label = "字幕 " + strconv.Itoa(i+1)
+		}
+		data.Subtitles = append(data.Subtitles, watchSubtitle{
+			Src:     strings.TrimRight(base, "/") + "/subtitle?" + sq.Encode(),
+			Label:   label,
+			Default: len(data.Subtitles) == 0,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := watchPage.Execute(&buf, data); err != nil {
+		log.Printf("渲染播放页失败: %v", err)
+		http.Error(w, "渲染播放页失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func tokenQuery(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "&token=" + url.QueryEscape(token)
+}
+
+// srtTimestamp SRT 时间戳使用逗号分隔毫秒，WebVTT 使用点
+var srtTimestamp = regexp.MustCompile(`(\d{2}:\d{2}:\d{2}),(\d{3})`)
+
+// srtToVTT 把 SRT 字幕转换为浏览器 <track> 支持的 WebVTT
+func srtToVTT(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	var out bytes.Buffer
+	out.WriteString("WEBVTT\n\n")
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.Contains(line, "-->") {
+			line = srtTimestamp.ReplaceAllString(line, "$1.$2")
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
+
+// handleSubtitle GET /subtitle?file_id=...&filename=...，返回 WebVTT 字幕，.srt 会在服务端转换
+func (p *profile) handleSubtitle(w http.ResponseWriter, r *http.Request) {
+	bot := p.botFor(r)
+	fileID := r.URL.Query().Get("file_id")
+	filename := r.URL.Query().Get("filename")
+	if fileID == "" {
+		http.Error(w, "缺少 file_id 参数", http.StatusBadRequest)
+		return
+	}
+	if !p.authorizeDownload(w, r, fileID) {
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".srt" && ext != ".vtt" {
+		http.Error(w, "只支持 .srt 与 .vtt 字幕", http.StatusBadRequest)
+		return
+	}
+	data, err := downloadBlob(bot, fileID)
+	if isFileGone(err) {
+		p.writeGone(w, r, fileID)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if ext == ".srt" {
+		data = srtToVTT(data)
+	}
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(data)
+}